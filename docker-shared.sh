@@ -29,6 +29,18 @@ then
   exit 30
 fi
 
+# Whether the image tagged $1 should also be tagged as latest. Decided by the
+# gdc docker rules when available, otherwise only the default branch is
+is_latest ()
+{
+  if [ -n "$gdc_latest" ]
+  then
+    [ "$gdc_latest" == "true" ]
+  else
+    [ "$1" == "$default_branch" ]
+  fi
+}
+
 # Login to DockerHub
 login ()
 {
@@ -48,8 +60,8 @@ build ()
 {
   before_build
 
-  if [ "$1" == "$default_branch" ]; then
-    echo "Building Docker image $org_name/$app_name:$1 (also latest because default branch)"
+  if is_latest $1; then
+    echo "Building Docker image $org_name/$app_name:$1 (also latest)"
     docker $TLS_OPTS build --build-arg gitref=$gitref --tag $org_name/$app_name:$1 --tag $org_name/$app_name:latest .
   else
     echo "Building Docker image $org_name/$app_name:$1"
@@ -68,8 +80,8 @@ clean ()
 # Push a named tag of this repo's image to DockerHub. This is a nearly-useless shortcut.
 push ()
 {
-  if [ "$1" == "$default_branch" ]; then
-    echo "Pushing Docker image $org_name/$app_name:$1 (also latest because default branch)"
+  if is_latest $1; then
+    echo "Pushing Docker image $org_name/$app_name:$1 (also latest)"
       docker $TLS_OPTS push $org_name/$app_name:latest && docker $TLS_OPTS push $org_name/$app_name:$1
   else
     echo "Pushing Docker image $org_name/$app_name:$1"
@@ -79,10 +91,16 @@ push ()
   return $?
 }
 
-# Promotes tag $1 to tag $2
+# Promotes tag $1 to tag $2. If $gdc points to a gdc binary, the tag is copied
+# inside the registry, otherwise the image is pulled, tagged and pushed again
 promote ()
 {
   echo "Promoting $org_name/$app_name:$1 to $org_name/$app_name:$2"
+  if [ -n "$gdc" ] && [ -x "$gdc" ]
+  then
+    $gdc image promote $org_name/$app_name:$1 $org_name/$app_name:$2
+    return $?
+  fi
   docker $TLS_OPTS pull $org_name/$app_name:$1
   docker $TLS_OPTS tag  $org_name/$app_name:$1 $org_name/$app_name:$2
   docker $TLS_OPTS push $org_name/$app_name:$2
@@ -94,10 +112,13 @@ promote ()
 #   - build and push an image
 ci ()
 {
-  if [[ "$2" != "false" ]]
+  if [[ "$2" != "false" && "$gdc_pull_requests" != "true" ]]
   then
     echo "Skipping Docker image build due to pull-request status ($2)"
-  elif [[ ! "$1" =~ (^(master|staging|production-|experimental|hotfix|latest|release))|((_cow|_minimoo|_master|_phase[1-9]|_prometheus)$) ]]
+  elif [[ -n "$gdc_build" && "$gdc_build" != "true" ]]
+  then
+    echo "Skipping Docker image build due to gdc docker rules for branch ($1)"
+  elif [[ -z "$gdc_build" && ! "$1" =~ (^(master|staging|production-|experimental|hotfix|latest|release))|((_cow|_minimoo|_master|_phase[1-9]|_prometheus)$) ]]
   then
     echo "Skipping Docker image build due to uninteresting branch name ($1)"
   else
@@ -153,15 +174,29 @@ main ()
     echo "Detected Git branch '$git_branch'"
   fi
 
-  # Map the git branch name to an image tag
-  case $git_branch in
-    production)
-      tag="${git_branch}-isolated"
-      ;;
-    *)
-      tag=$git_branch
-      ;;
-  esac
+  # Map the git branch name to an image tag. If $gdc points to a gdc binary the
+  # rules come from its config (see `gdc docker tag-for`)
+  if [ -n "$gdc" ] && [ -x "$gdc" ]
+  then
+    # Errors are not eval'ed: an empty tag must not reach the build
+    if ! gdc_out=$($gdc docker tag-for -shell -default-branch "$default_branch" "$git_branch")
+    then
+      [ -z "$gdc_out" ] || echo "$gdc_out"
+      echo "ERROR: gdc docker tag-for failed for branch '$git_branch'"
+      exit 50
+    fi
+    eval "$gdc_out"
+    tag=$gdc_tag
+  else
+    case $git_branch in
+      production)
+        tag="${git_branch}-isolated"
+        ;;
+      *)
+        tag=$git_branch
+        ;;
+    esac
+  fi
   echo "Derived Docker image tag '$tag' from Git branch name"
 
   pull_request_number=$3
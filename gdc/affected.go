@@ -0,0 +1,239 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2017 RightScale, Inc, All Rights Reserved Worldwide.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/rightscale/ci/gdc/graph"
+	"github.com/rightscale/ci/gdc/impact"
+	"github.com/rightscale/ci/gdc/repo"
+)
+
+// Returns go command patterns relative to the repo root for dirs: ./dir/...
+// when every package below dir is in dirs, ./dir otherwise
+func goPatterns(g *graph.Graph, dirs []string) []string {
+	var res, covered []string
+	isCovered := func(dir string) bool {
+		for _, c := range covered {
+			if c == "." || strings.HasPrefix(dir, c+"/") {
+				return true
+			}
+		}
+		return false
+	}
+	for _, dir := range dirs {
+		if isCovered(dir) {
+			continue
+		}
+		all := true
+		for _, sub := range g.TargetPackages(dir) {
+			if !contains(dirs, sub) {
+				all = false
+				break
+			}
+		}
+		switch {
+		case all && dir == ".":
+			res = append(res, "./...")
+			covered = append(covered, dir)
+		case all && len(g.TargetPackages(dir)) > 1:
+			res = append(res, "./"+dir+"/...")
+			covered = append(covered, dir)
+		default:
+			res = append(res, "./"+dir)
+		}
+	}
+	return res
+}
+
+// Formats a list of packages: dir gives repo relative directories, import
+// fully qualified import paths and gotest patterns for the go command
+func formatPackages(g *graph.Graph, dirs []string, format string) ([]string, error) {
+	switch format {
+	case "dir":
+		return dirs, nil
+	case "import":
+		var res []string
+		for _, dir := range dirs {
+			res = append(res, g.ImportPath(dir))
+		}
+		return res, nil
+	case "gotest":
+		return goPatterns(g, dirs), nil
+	default:
+		return nil, fmt.Errorf("unknown format %q, should be dir, import, gotest or json", format)
+	}
+}
+
+// Returns dirs sorted so that every package comes after the packages of
+// dirs it imports, directly or not. Ties are broken alphabetically
+func topoSort(g *graph.Graph, dirs []string) []string {
+	deps := dependenciesWithin(g, dirs)
+	done := make(map[string]bool)
+	var res []string
+	for len(res) < len(dirs) {
+		var ready []string
+		for _, dir := range dirs {
+			if done[dir] {
+				continue
+			}
+			ok := true
+			for _, dep := range deps[dir] {
+				if !done[dep] {
+					ok = false
+					break
+				}
+			}
+			if ok {
+				ready = append(ready, dir)
+			}
+		}
+		if len(ready) == 0 {
+			// Import cycle, the compiler will complain anyway
+			for _, dir := range dirs {
+				if !done[dir] {
+					ready = append(ready, dir)
+				}
+			}
+		}
+		sort.Strings(ready)
+		for _, dir := range ready {
+			done[dir] = true
+		}
+		res = append(res, ready...)
+	}
+	return res
+}
+
+// Returns, for every package of dirs, the other packages of dirs it imports
+// directly or not. Packages of an import cycle import each other: they don't
+// depend on each other, so that they can still be ordered and run
+func dependenciesWithin(g *graph.Graph, dirs []string) map[string][]string {
+	imports := make(map[string][]string)
+	for _, dir := range dirs {
+		imports[dir] = g.TransitiveImports([]string{dir}, false)
+	}
+	deps := make(map[string][]string)
+	for _, dir := range dirs {
+		for _, dep := range imports[dir] {
+			if dep != dir && contains(dirs, dep) && !contains(imports[dep], dir) {
+				deps[dir] = append(deps[dir], dep)
+			}
+		}
+	}
+	return deps
+}
+
+// Parses a commit range given as <sha1>..<sha2> or <sha1>...<sha2>
+func parseRange(commitRange string) (sha1, sha2 string, err error) {
+	rng, err := repo.ParseRange(commitRange)
+	return rng.From, rng.To, err
+}
+
+// ignoreFormatting : If true, changes that leave the AST of Go files untouched are dropped
+var ignoreFormatting = false
+
+// Returns the impact options of the config and the command line flags
+func impactOptions(opts impact.Options) impact.Options {
+	cfg := getConfig()
+	opts.IgnoreFormatting = ignoreFormatting
+	opts.ProjectDir = getCurrentRelativePath()
+	opts.Inputs = cfg.Inputs
+	opts.Generate = cfg.Generate
+	opts.Logger = cliLogger{}
+	return opts
+}
+
+// Returns the packages of the working directory affected by the changes between sha1 and sha2
+func getAffectedPackages(sha1, sha2 string, opts impact.Options) *impact.Result {
+	res, err := impact.Affected(context.Background(), getRepo(), repo.Range{From: sha1, To: sha2}, impactOptions(opts))
+	exitOnError(err)
+	return res
+}
+
+// Returns the files changed between sha1 and sha2, with the changes derived
+// from go.mod and generator inputs, see impact.Changed
+func getChanges(g *graph.Graph, sha1, sha2 string) *impact.Changes {
+	c, err := impact.Changed(context.Background(), getRepo(), repo.Range{From: sha1, To: sha2}, g, impactOptions(impact.Options{}))
+	exitOnError(err)
+	return c
+}
+
+// Parses the optional commit range argument of a command, defaulting to sha1 and sha2
+func rangeArg(fs *flag.FlagSet, sha1, sha2 string) (string, string) {
+	if fs.NArg() == 0 {
+		return sha1, sha2
+	}
+	from, to, err := parseRange(fs.Arg(0))
+	if err != nil {
+		fmt.Printf("ERROR! %v\n", err)
+		os.Exit(1)
+	}
+	return from, to
+}
+
+// Implements "gdc affected"
+func affectedCommand(sha1, sha2 string, args []string) {
+	fs := flag.NewFlagSet("affected", flag.ExitOnError)
+	format := fs.String("format", "dir", "output format: dir, import, gotest or json")
+	var opts impact.Options
+	fs.BoolVar(&opts.Tests, "tests", false, "list the packages whose tests are affected")
+	fs.BoolVar(&opts.Precise, "precise", false, "only follow importers using the changed declarations")
+	fs.Usage = func() {
+		fmt.Println("Usage: gdc affected [-format dir|import|gotest|json] [-tests] [-precise] [<sha1>..<sha2>]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	sha1, sha2 = rangeArg(fs, sha1, sha2)
+
+	affected := getAffectedPackages(sha1, sha2, opts)
+	if *format == "json" {
+		printJSON(affected)
+		return
+	}
+	res, err := formatPackages(affected.Graph, affected.Packages, *format)
+	if err != nil {
+		fmt.Printf("ERROR! %v\n", err)
+		os.Exit(1)
+	}
+	for _, line := range res {
+		fmt.Println(line)
+	}
+}
+
+// Prints v as indented JSON
+func printJSON(v interface{}) {
+	out, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		fmt.Printf("ERROR! %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Println(string(out))
+}
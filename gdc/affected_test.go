@@ -0,0 +1,55 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/rightscale/ci/gdc/graph"
+)
+
+func TestTopoSort(t *testing.T) {
+	g := buildGraph(testRepo, "github.com/org/repo")
+	res := topoSort(g, []string{"svc", "lib/a", "other", "lib/b", "lib/c"})
+	expected := []string{"lib/b", "lib/c", "lib/a", "other", "svc"}
+	if !reflect.DeepEqual(res, expected) {
+		t.Error("topological order should be", expected, "but got", res)
+	}
+}
+
+func TestDependenciesWithinCycle(t *testing.T) {
+	g := buildGraph(graph.MapSource{
+		"a/a.go":     "package a\n\nimport \"github.com/org/repo/b\"\n",
+		"b/b.go":     "package b\n\nimport \"github.com/org/repo/a\"\n",
+		"svc/svc.go": "package svc\n\nimport \"github.com/org/repo/a\"\n",
+	}, "github.com/org/repo")
+	targets := topoSort(g, []string{"svc", "a", "b"})
+	deps := dependenciesWithin(g, targets)
+	expected := map[string][]string{"svc": {"a", "b"}}
+	if !reflect.DeepEqual(deps, expected) {
+		t.Error("dependencies should be", expected, "but got", deps)
+	}
+	for _, res := range runTargets(targets, deps, 1, false, func(string) error { return nil }) {
+		if res.Status != "ok" {
+			t.Error("packages of an import cycle should run, got", res)
+		}
+	}
+}
+
+func TestFormatPackages(t *testing.T) {
+	g := buildGraph(testRepo, "github.com/org/repo")
+	dirs := []string{"lib/a", "lib/b", "svc", "svc/sub"}
+
+	res, _ := formatPackages(g, dirs, "import")
+	expected := []string{"github.com/org/repo/lib/a", "github.com/org/repo/lib/b", "github.com/org/repo/svc", "github.com/org/repo/svc/sub"}
+	if !reflect.DeepEqual(res, expected) {
+		t.Error("import paths should be", expected, "but got", res)
+	}
+	res, _ = formatPackages(g, dirs, "gotest")
+	expected = []string{"./lib/a", "./lib/b", "./svc/..."}
+	if !reflect.DeepEqual(res, expected) {
+		t.Error("go test patterns should be", expected, "but got", res)
+	}
+	if _, err := formatPackages(g, dirs, "xml"); err == nil {
+		t.Error("unknown formats should be rejected")
+	}
+}
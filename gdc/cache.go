@@ -0,0 +1,245 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2017 RightScale, Inc, All Rights Reserved Worldwide.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Remote cache of fingerprint results. The protocol is plain HTTP:
+//
+//	GET /v1/results/<fingerprint>  200 with the result as JSON, 404 if unknown
+//	PUT /v1/results/<fingerprint>  stores the JSON result, 204 when done
+//
+// PUT requests carry "Authorization: Bearer <token>" when the server has a token
+const cacheResultsPath = "/v1/results/"
+
+var validFingerprint = regexp.MustCompile(`^[0-9a-f]{16,128}$`)
+
+// cacheConfig is the "cache" section of .gdc.yml
+type cacheConfig struct {
+	URL      string        `yaml:"url"`       // remote cache, results are only kept locally if empty
+	TTL      time.Duration `yaml:"ttl"`       // results older than this are ignored, 0 keeps them forever
+	ReadOnly bool          `yaml:"read_only"` // never write to the remote cache
+}
+
+// Whether the remote cache must not be written: always for pull request
+// builds, since their content is not trusted
+func (cc cacheConfig) readOnly() bool {
+	pr := os.Getenv("TRAVIS_PULL_REQUEST")
+	return cc.ReadOnly || pr != "" && pr != "false"
+}
+
+// Whether a result is older than ttl
+func expired(result *fingerprintResult, ttl time.Duration) bool {
+	return ttl > 0 && !result.Time.IsZero() && time.Since(result.Time) > ttl
+}
+
+// httpResultStore is a resultStore client of the remote cache protocol
+type httpResultStore struct {
+	URL      string
+	Token    string
+	TTL      time.Duration
+	ReadOnly bool
+	HTTP     *http.Client
+}
+
+func (s *httpResultStore) url(fingerprint string) string {
+	return strings.TrimSuffix(s.URL, "/") + cacheResultsPath + fingerprint
+}
+
+func (s *httpResultStore) Get(fingerprint string) (*fingerprintResult, error) {
+	resp, err := s.HTTP.Get(s.url(fingerprint))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("GET %s failed: %s", s.url(fingerprint), resp.Status)
+	}
+
+	var result fingerprintResult
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, err
+	}
+	if result.Fingerprint != fingerprint || expired(&result, s.TTL) {
+		return nil, nil
+	}
+	return &result, nil
+}
+
+func (s *httpResultStore) Put(result fingerprintResult) error {
+	if s.ReadOnly {
+		return errors.New("remote cache is read-only")
+	}
+	body, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("PUT", s.url(result.Fingerprint), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+s.Token)
+	}
+	resp, err := s.HTTP.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		msg, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("PUT %s failed: %s %s", s.url(result.Fingerprint), resp.Status, bytes.TrimSpace(msg))
+	}
+	return nil
+}
+
+// tieredResultStore reads the local store first and the remote one if needed.
+// Writes go to both, unless the remote one is read-only
+type tieredResultStore struct {
+	local  resultStore
+	remote *httpResultStore
+	ttl    time.Duration
+}
+
+func (s *tieredResultStore) Get(fingerprint string) (*fingerprintResult, error) {
+	result, err := s.local.Get(fingerprint)
+	if err == nil && result != nil && !expired(result, s.ttl) {
+		return result, nil
+	}
+
+	result, err = s.remote.Get(fingerprint)
+	if err != nil || result == nil {
+		return nil, err
+	}
+	// Keep it locally, it's not going to change
+	if err := s.local.Put(*result); err != nil && Verbose {
+		fmt.Printf("WARNING! Cannot keep result of %s locally: %v\n", fingerprint, err)
+	}
+	return result, nil
+}
+
+func (s *tieredResultStore) Put(result fingerprintResult) error {
+	if err := s.local.Put(result); err != nil {
+		return err
+	}
+	if s.remote.ReadOnly {
+		fmt.Printf("Remote cache is read-only, result of %s only kept locally\n", result.Fingerprint)
+		return nil
+	}
+	return s.remote.Put(result)
+}
+
+// cacheServer is the reference implementation of the remote cache, it stores
+// results in a fileResultStore
+type cacheServer struct {
+	store *fileResultStore
+	ttl   time.Duration
+	token string
+}
+
+func (cs *cacheServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.URL.Path, cacheResultsPath) {
+		http.NotFound(w, r)
+		return
+	}
+	fingerprint := strings.TrimPrefix(r.URL.Path, cacheResultsPath)
+	if !validFingerprint.MatchString(fingerprint) {
+		http.Error(w, "invalid fingerprint", http.StatusBadRequest)
+		return
+	}
+
+	switch r.Method {
+	case "GET", "HEAD":
+		result, err := cs.store.Get(fingerprint)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if result == nil || expired(result, cs.ttl) {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(result)
+	case "PUT":
+		if cs.token != "" && r.Header.Get("Authorization") != "Bearer "+cs.token {
+			http.Error(w, "invalid token", http.StatusUnauthorized)
+			return
+		}
+		var result fingerprintResult
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64*1024)).Decode(&result); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if result.Fingerprint != fingerprint {
+			http.Error(w, "fingerprint of the body does not match the URL", http.StatusBadRequest)
+			return
+		}
+		if result.Time.IsZero() {
+			result.Time = time.Now().UTC()
+		}
+		if err := cs.store.Put(result); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.Header().Set("Allow", "GET, HEAD, PUT")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// Implements "gdc cache-server"
+func cacheServerCommand(args []string) {
+	fs := flag.NewFlagSet("cache-server", flag.ExitOnError)
+	listen := fs.String("listen", ":8080", "address to listen on")
+	dir := fs.String("dir", "gdc-cache", "directory where results are stored")
+	ttl := fs.Duration("ttl", 0, "forget results older than this, 0 keeps them forever")
+	token := fs.String("token", os.Getenv("GDC_CACHE_TOKEN"), "token required to store results, defaults to GDC_CACHE_TOKEN")
+	fs.Parse(args)
+
+	if *token == "" {
+		log.Printf("WARNING! No token given, anybody can store results")
+	}
+	log.Printf("gdc cache-server %s listening on %s, storing results in %s", version, *listen, *dir)
+	server := &cacheServer{store: &fileResultStore{Dir: *dir}, ttl: *ttl, token: *token}
+	log.Fatal(http.ListenAndServe(*listen, server))
+}
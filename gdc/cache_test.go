@@ -0,0 +1,72 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRemoteCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gdc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	server := &cacheServer{store: &fileResultStore{Dir: filepath.Join(dir, "server")}, ttl: time.Hour, token: "secret"}
+	srv := httptest.NewServer(server)
+	defer srv.Close()
+
+	remote := &httpResultStore{URL: srv.URL, Token: "secret", HTTP: srv.Client()}
+	fp := "abcdef0123456789"
+	if res, err := remote.Get(fp); err != nil || res != nil {
+		t.Error("unknown fingerprint should return nil, got", res, err)
+	}
+	if err := remote.Put(fingerprintResult{Fingerprint: fp, Target: "svc", SHA: greenSHA, Status: "success"}); err != nil {
+		t.Fatal(err)
+	}
+	res, err := remote.Get(fp)
+	if err != nil || res == nil || res.Status != "success" || res.SHA != greenSHA || res.Time.IsZero() {
+		t.Error("unexpected remote result", res, err)
+	}
+
+	// Writes need the token
+	anonymous := &httpResultStore{URL: srv.URL, HTTP: srv.Client()}
+	if err := anonymous.Put(fingerprintResult{Fingerprint: fp, Status: "failure"}); err == nil {
+		t.Error("PUT without token should fail")
+	}
+	if err := anonymous.Put(fingerprintResult{Fingerprint: "not-a-fingerprint"}); err == nil {
+		t.Error("PUT of an invalid fingerprint should fail")
+	}
+	anonymous.ReadOnly = true
+	if err := anonymous.Put(fingerprintResult{Fingerprint: fp, Status: "failure"}); err == nil {
+		t.Error("PUT to a read-only cache should fail")
+	}
+
+	// Old results are forgotten by the server
+	old := "0123456789abcdef"
+	server.store.Put(fingerprintResult{Fingerprint: old, Status: "success", Time: time.Now().Add(-2 * time.Hour)})
+	if res, err := remote.Get(old); err != nil || res != nil {
+		t.Error("expired result should not be returned, got", res, err)
+	}
+
+	// The tiered store keeps remote results locally and does not write to read-only caches
+	local := &fileResultStore{Dir: filepath.Join(dir, "local")}
+	tiered := &tieredResultStore{local: local, remote: &httpResultStore{URL: srv.URL, ReadOnly: true, HTTP: srv.Client()}}
+	if res, err := tiered.Get(fp); err != nil || res == nil || res.Status != "success" {
+		t.Error("tiered store should read the remote cache, got", res, err)
+	}
+	if res, err := local.Get(fp); err != nil || res == nil {
+		t.Error("remote result should be kept locally, got", res, err)
+	}
+	other := "fedcba9876543210"
+	if err := tiered.Put(fingerprintResult{Fingerprint: other, Status: "success"}); err != nil {
+		t.Error("read-only tiered store should still write locally, got", err)
+	}
+	if res, err := remote.Get(other); err != nil || res != nil {
+		t.Error("read-only tiered store should not write to the remote cache, got", res, err)
+	}
+}
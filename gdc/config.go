@@ -0,0 +1,112 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2017 RightScale, Inc, All Rights Reserved Worldwide.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/rightscale/ci/gdc/graph"
+)
+
+// Name of the config file, looked up in the root of the git repo
+const configFileName = ".gdc.yml"
+
+// configPath : If set, config is read from this file instead of the repo root
+var configPath = ""
+var currentConfig *config
+
+// config holds everything that can be tuned in .gdc.yml
+type config struct {
+	Docker      dockerConfig         `yaml:"docker"`
+	Green       greenConfig          `yaml:"green"`
+	Inputs      graph.Inputs         `yaml:"inputs"`
+	Fingerprint fingerprintConfig    `yaml:"fingerprint"`
+	Cache       cacheConfig          `yaml:"cache"`
+	Impact      impactConfig         `yaml:"impact"`
+	Generate    []graph.GenerateRule `yaml:"generate"`
+	Deps        depsConfig           `yaml:"deps"`
+}
+
+// Returns the config of the current repo, loading it the first time
+func getConfig() *config {
+	if currentConfig != nil {
+		return currentConfig
+	}
+
+	path := configPath
+	if path == "" {
+		path = filepath.Join(getRepoPath(), configFileName)
+	}
+	cfg, err := loadConfig(path)
+	if err != nil {
+		fmt.Printf("ERROR! Cannot load config %s: %v\n", path, err)
+		os.Exit(1)
+	}
+	currentConfig = cfg
+
+	return currentConfig
+}
+
+// Reads a config file. A missing file is not an error, the defaults are used instead
+func loadConfig(path string) (*config, error) {
+	cfg := &config{}
+	content, err := ioutil.ReadFile(path)
+	switch {
+	case os.IsNotExist(err):
+		if Verbose {
+			fmt.Printf("No config file found at %s, using defaults\n", path)
+		}
+	case err != nil:
+		return nil, err
+	default:
+		if err := yaml.UnmarshalStrict(content, cfg); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := cfg.setDefaults(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+func (cfg *config) setDefaults() error {
+	if err := cfg.Docker.setDefaults(); err != nil {
+		return err
+	}
+	if err := cfg.Fingerprint.setDefaults(); err != nil {
+		return err
+	}
+	if err := cfg.Impact.setDefaults(); err != nil {
+		return err
+	}
+	if err := cfg.Deps.setDefaults(); err != nil {
+		return err
+	}
+	return cfg.Green.setDefaults()
+}
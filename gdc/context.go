@@ -0,0 +1,167 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2017 RightScale, Inc, All Rights Reserved Worldwide.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/rightscale/ci/gdc/graph"
+)
+
+// Returns the files of the repo needed to build target: everything under the
+// target directory, the files the packages it transitively imports are built from,
+// the root files, the vendor directory and the Dockerfile with its COPY sources
+func contextFiles(g *graph.Graph, src graph.FileSource, target, dockerfile string) ([]string, error) {
+	target = path.Clean(filepath.ToSlash(target))
+	files := src.Files()
+	needed := make(map[string]struct{})
+	add := func(list []string) {
+		for _, file := range list {
+			needed[file] = struct{}{}
+		}
+	}
+
+	add(g.RootFiles)
+	for _, file := range files {
+		if target == "." || strings.HasPrefix(file, target+"/") || strings.HasPrefix(file, "vendor/") {
+			needed[file] = struct{}{}
+		}
+	}
+	for _, dir := range g.TransitiveImports(g.TargetPackages(target), false) {
+		if node := g.Packages[dir]; node != nil {
+			add(node.Inputs(false))
+		}
+	}
+
+	dockerFiles, _, err := dockerfileDependencies(src, dockerfile)
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range dockerFiles {
+		switch {
+		case contains(files, file):
+			needed[file] = struct{}{}
+		case len(matchContextFiles(file, files)) == 0:
+			fmt.Printf("WARNING! COPY/ADD source %s of %s matches no file\n", file, dockerfile)
+		}
+	}
+
+	return graph.GetSortedKeys(needed), nil
+}
+
+// Returns the content of a .dockerignore file only letting files through
+func dockerignoreContent(target string, files []string) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "# Generated by gdc context %s, do not edit\n", target)
+	buf.WriteString("*\n")
+	for _, file := range files {
+		fmt.Fprintf(&buf, "!%s\n", file)
+	}
+	return buf.Bytes()
+}
+
+// Copies files from the repo into a fresh staging directory
+func stageContext(src graph.FileSource, files []string, stageDir string) error {
+	if entries, err := ioutil.ReadDir(stageDir); err == nil && len(entries) > 0 {
+		return fmt.Errorf("staging directory %s is not empty", stageDir)
+	}
+	for _, file := range files {
+		content, err := src.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		mode := os.FileMode(0644)
+		if ds, ok := src.(*graph.DirSource); ok {
+			if info, err := os.Stat(filepath.Join(ds.Root(), filepath.FromSlash(file))); err == nil {
+				mode = info.Mode().Perm()
+			}
+		}
+		dst := filepath.Join(stageDir, filepath.FromSlash(file))
+		if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(dst, content, mode); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Implements "gdc context"
+func contextCommand(args []string) {
+	fs := flag.NewFlagSet("context", flag.ExitOnError)
+	dockerfile := fs.String("dockerfile", "", "Dockerfile of the target, defaults to <directory>/Dockerfile")
+	dockerignore := fs.String("dockerignore", "", "write a .dockerignore file to this path")
+	stage := fs.String("stage", "", "copy the context files into this (empty) directory")
+	fs.Usage = func() {
+		fmt.Println("Usage: gdc context [-dockerfile <file>] [-dockerignore <file> | -stage <dir>] <directory>")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(1)
+	}
+	target := path.Clean(filepath.ToSlash(fs.Arg(0)))
+	if *dockerfile == "" {
+		*dockerfile = targetDockerfile(target)
+	}
+
+	src, err := graph.NewDirSource(getRepoPath())
+	if err != nil {
+		fmt.Printf("ERROR! Cannot list repo files: %v\n", err)
+		os.Exit(1)
+	}
+	g := buildGraph(src, getCurrentRelativePath())
+	files, err := contextFiles(g, src, target, path.Clean(filepath.ToSlash(*dockerfile)))
+	if err != nil {
+		fmt.Printf("ERROR! %v\n", err)
+		os.Exit(1)
+	}
+
+	switch {
+	case *dockerignore != "":
+		if err := ioutil.WriteFile(*dockerignore, dockerignoreContent(target, files), 0644); err != nil {
+			fmt.Printf("ERROR! %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Wrote %s letting %d of %d files into the build context\n", *dockerignore, len(files), len(src.Files()))
+	case *stage != "":
+		if err := stageContext(src, files, *stage); err != nil {
+			fmt.Printf("ERROR! %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Staged %d of %d files into %s\n", len(files), len(src.Files()), *stage)
+	default:
+		for _, file := range files {
+			fmt.Println(file)
+		}
+	}
+}
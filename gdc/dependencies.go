@@ -28,9 +28,11 @@ import (
 	"go/token"
 	"log"
 	"os"
+	"path"
 	"path/filepath"
-	"sort"
 	"strings"
+
+	"github.com/rightscale/ci/gdc/graph"
 )
 
 func printImports(path string) {
@@ -91,18 +93,6 @@ func getExecutionDir() string {
 	return currentDir
 }
 
-func getSortedKeys(aMap map[string]struct{}) []string {
-	keys := make([]string, len(aMap))
-
-	i := 0
-	for k := range aMap {
-		keys[i] = k
-		i++
-	}
-	sort.Strings(keys)
-	return keys
-}
-
 func getImports(directory string) (files []string) {
 	imports := make(map[string]struct{}) // struct{} occupies 0 bytes
 
@@ -112,42 +102,97 @@ func getImports(directory string) (files []string) {
 		}
 	}
 
-	files = getSortedKeys(imports)
+	files = graph.GetSortedKeys(imports)
 	return
 }
 
-func getParsedImports(directory string, projectDir string) (imports []string) {
+// Returns the in-repo and vendored packages imported by the Go files under directory
+func getParsedImports(g *graph.Graph, directory string) (imports []string) {
+	projectDir := g.ProjectDir
+	fromDir := path.Clean(filepath.ToSlash(directory))
+	var vendored []string
 	for _, impoort := range getImports(directory) {
 		impoort = strings.Trim(impoort, "\"")
-		if strings.HasPrefix(impoort, projectDir) {
+		dir := g.ResolveImport(impoort, fromDir)
+		switch {
+		case graph.IsVendored(dir):
+			vendored = append(vendored, dir)
+		case len(g.Modules) > 0:
+			// With go.mod files, imports of other modules resolve through go.work and replace directives
+			if dir != "" {
+				imports = append(imports, dir)
+			}
+		case strings.HasPrefix(impoort, projectDir):
 			impoort = strings.TrimPrefix(impoort, projectDir)
 			impoort = strings.TrimPrefix(impoort, "/")
 			imports = append(imports, impoort)
 		}
 	}
+	// Vendored packages are dependencies along with what they import
+	imports = append(imports, g.VendorClosure(vendored)...)
 
 	return
 }
 
+// Whether file is a test matched by the *.go pattern of an imported package,
+// see getParsedDependencies: the tests of a package are never built with its importers
+func isPackageTest(pattern, file string) bool {
+	return path.Base(pattern) == "*.go" && strings.HasSuffix(file, "_test.go")
+}
+
 func getParsedDependencies(directory string, projectDir string) (imports []string) {
 	// Adds filenames to imports (for non-Go files)
 	deps := make(map[string]struct{})
 
-	for _, anImport := range getParsedImports(directory, projectDir) {
-		deps[anImport] = struct{}{}
+	src, err := graph.NewDirSource(getRepoPath())
+	if err != nil {
+		log.Fatal(err)
+	}
+	g := buildGraph(src, projectDir)
+	// Imported packages are dependencies through the files they're built from only
+	imported := getParsedImports(g, directory)
+	for _, anImport := range imported {
+		node := g.Packages[anImport]
+		if node == nil {
+			node = g.Vendor[anImport]
+		}
+		if node == nil {
+			deps[anImport] = struct{}{}
+			continue
+		}
+		// Go files removed from the package are not in the working tree anymore,
+		// the pattern doesn't match its tests, see isPackageTest
+		deps[path.Join(anImport, "*.go")] = struct{}{}
+		for _, file := range node.Inputs(false) {
+			deps[file] = struct{}{}
+		}
 	}
 	for _, file := range getAllFiles(directory) {
 		deps[file] = struct{}{}
 	}
-
-	return getSortedKeys(deps)
-}
-
-func isRootFile(path string) bool {
-	switch filepath.Dir(path) {
-	case ".", "/":
-		return true
-	default:
-		return false
+	// Adds what the packages of the directory embed or include from elsewhere
+	for _, dir := range g.TargetPackages(directory) {
+		for _, file := range g.Packages[dir].Inputs(true) {
+			deps[file] = struct{}{}
+		}
+	}
+	// Adds the .proto files the imported generated packages come from
+	for _, file := range g.ProtoSources(append(imported, g.TargetPackages(directory)...)) {
+		deps[file] = struct{}{}
 	}
+	// Adds the scripts, npm packages, Python modules... it uses
+	for _, file := range g.AnalyzedInputs(directory) {
+		deps[file] = struct{}{}
+	}
+	// Adds the Dockerfile and the files it copies, wherever they live
+	dockerFiles, _ := getDockerfileDependencies(directory)
+	for _, file := range dockerFiles {
+		deps[file] = struct{}{}
+	}
+	// Adds the configured global and extra inputs
+	for _, pattern := range getConfig().Inputs.ForTarget(directory) {
+		deps[pattern] = struct{}{}
+	}
+
+	return graph.GetSortedKeys(deps)
 }
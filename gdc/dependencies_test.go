@@ -0,0 +1,15 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestHitDependsPackageTests(t *testing.T) {
+	deps := []string{"lib/a/*.go", "lib/a/data.json", "svc/main_test.go"}
+	hits := hitDepends(deps, []string{"lib/a/a_test.go", "lib/a/a.go", "svc/main_test.go"})
+	expected := []string{"lib/a/*.go", "svc/main_test.go"}
+	if !reflect.DeepEqual(hits, expected) {
+		t.Error("the tests of imported packages should not be hits, expected", expected, "but got", hits)
+	}
+}
@@ -0,0 +1,209 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2017 RightScale, Inc, All Rights Reserved Worldwide.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"text/template"
+)
+
+// dockerConfig is the "docker" section of .gdc.yml
+type dockerConfig struct {
+	Rules []branchRule `yaml:"rules"`
+
+	defaulted bool // no rules were configured
+}
+
+// branchRule decides what to do with the image of a branch. Rules are
+// evaluated in order and the first one whose pattern matches wins
+type branchRule struct {
+	Branch       string `yaml:"branch"`
+	Build        *bool  `yaml:"build"`
+	Tag          string `yaml:"tag"`
+	Latest       bool   `yaml:"latest"`
+	PullRequests bool   `yaml:"pull_requests"`
+
+	re   *regexp.Regexp
+	tmpl *template.Template
+}
+
+// Rules equivalent to the policy historically hardcoded in docker-shared.sh,
+// the images of defaultBranch being tagged as latest
+func defaultBranchRules(defaultBranch string) []branchRule {
+	skip := false
+	return []branchRule{
+		{Branch: "^production$", Tag: "{{.Branch}}-isolated"},
+		{Branch: "^" + regexp.QuoteMeta(defaultBranch) + "$", Latest: true},
+		{Branch: "(^(master|staging|production-|experimental|hotfix|latest|release))|((_cow|_minimoo|_master|_phase[1-9]|_prometheus)$)"},
+		{Branch: ".*", Build: &skip},
+	}
+}
+
+func (dc *dockerConfig) setDefaults() error {
+	if len(dc.Rules) == 0 {
+		dc.Rules = defaultBranchRules("master")
+		dc.defaulted = true
+	}
+
+	for i := range dc.Rules {
+		rule := &dc.Rules[i]
+		if rule.Branch == "" {
+			return fmt.Errorf("docker rule #%d has no branch pattern", i+1)
+		}
+		re, err := regexp.Compile(rule.Branch)
+		if err != nil {
+			return fmt.Errorf("docker rule #%d: %v", i+1, err)
+		}
+		rule.re = re
+
+		if rule.Tag == "" {
+			rule.Tag = "{{.Branch}}"
+		}
+		tmpl, err := template.New(rule.Branch).Option("missingkey=error").Parse(rule.Tag)
+		if err != nil {
+			return fmt.Errorf("docker rule #%d: %v", i+1, err)
+		}
+		rule.tmpl = tmpl
+	}
+
+	return nil
+}
+
+// Makes the default rules tag the images of defaultBranch as latest instead of
+// the ones of master. Configured rules are left untouched
+func (dc *dockerConfig) setDefaultBranch(defaultBranch string) error {
+	if !dc.defaulted || defaultBranch == "" {
+		return nil
+	}
+	dc.Rules = defaultBranchRules(defaultBranch)
+	return dc.setDefaults()
+}
+
+// tagDecision is the outcome of applying the docker rules to a branch
+type tagDecision struct {
+	Branch       string
+	Rule         int // 1-based, 0 if no rule matched
+	Pattern      string
+	Build        bool
+	Tag          string
+	Latest       bool
+	PullRequests bool
+}
+
+// Values available in a rule's tag template
+type tagTemplateData struct {
+	Branch string
+	Groups []string // regexp submatches of the branch pattern, Groups[0] is the whole match
+}
+
+var invalidTagChars = regexp.MustCompile(`[^A-Za-z0-9_.-]`)
+
+// Returns a valid Docker tag: invalid characters are replaced by "-"
+// and the result is cut to the 128 characters allowed by Docker
+func sanitizeTag(tag string) string {
+	tag = invalidTagChars.ReplaceAllString(tag, "-")
+	tag = strings.TrimLeft(tag, ".-")
+	if len(tag) > 128 {
+		tag = tag[:128]
+	}
+	return tag
+}
+
+// Applies the ordered rules to a branch name
+func (dc *dockerConfig) tagFor(branch string) (tagDecision, error) {
+	decision := tagDecision{Branch: branch}
+	for i, rule := range dc.Rules {
+		groups := rule.re.FindStringSubmatch(branch)
+		if groups == nil {
+			continue
+		}
+
+		var buf bytes.Buffer
+		if err := rule.tmpl.Execute(&buf, tagTemplateData{Branch: branch, Groups: groups}); err != nil {
+			return decision, fmt.Errorf("docker rule #%d: %v", i+1, err)
+		}
+		decision.Rule = i + 1
+		decision.Pattern = rule.Branch
+		decision.Build = rule.Build == nil || *rule.Build
+		decision.Tag = sanitizeTag(buf.String())
+		decision.Latest = rule.Latest
+		decision.PullRequests = rule.PullRequests
+		if decision.Build && decision.Tag == "" {
+			return decision, fmt.Errorf("docker rule #%d produced an empty tag for branch %q", i+1, branch)
+		}
+		return decision, nil
+	}
+
+	return decision, nil
+}
+
+// Implements "gdc docker <subcommand>"
+func dockerCommand(args []string) {
+	if len(args) == 0 || args[0] != "tag-for" {
+		fmt.Println("Usage: gdc docker tag-for [-shell] [-default-branch <branch>] <branch>")
+		os.Exit(1)
+	}
+
+	fs := flag.NewFlagSet("docker tag-for", flag.ExitOnError)
+	shell := fs.Bool("shell", false, "print the decision as shell variable assignments")
+	defaultBranch := fs.String("default-branch", "master", "branch whose images the default rules tag as latest")
+	fs.Parse(args[1:])
+	if fs.NArg() != 1 {
+		fmt.Println("Usage: gdc docker tag-for [-shell] [-default-branch <branch>] <branch>")
+		os.Exit(1)
+	}
+
+	dc := getConfig().Docker
+	if err := dc.setDefaultBranch(*defaultBranch); err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR! %v\n", err)
+		os.Exit(1)
+	}
+	decision, err := dc.tagFor(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR! %v\n", err)
+		os.Exit(1)
+	}
+
+	if *shell {
+		fmt.Printf("gdc_build=%t\n", decision.Build)
+		fmt.Printf("gdc_tag=%q\n", decision.Tag)
+		fmt.Printf("gdc_latest=%t\n", decision.Latest)
+		fmt.Printf("gdc_pull_requests=%t\n", decision.PullRequests)
+		return
+	}
+
+	if decision.Rule == 0 {
+		fmt.Printf("Branch %q did not match any rule\n", decision.Branch)
+	} else {
+		fmt.Printf("Branch %q matched rule #%d (%s)\n", decision.Branch, decision.Rule, decision.Pattern)
+	}
+	fmt.Printf("  build:         %t\n", decision.Build)
+	fmt.Printf("  tag:           %s\n", decision.Tag)
+	fmt.Printf("  latest:        %t\n", decision.Latest)
+	fmt.Printf("  pull requests: %t\n", decision.PullRequests)
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDefaultBranchRules(t *testing.T) {
+	dc := dockerConfig{}
+	if err := dc.setDefaults(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		branch string
+		build  bool
+		tag    string
+		latest bool
+	}{
+		{"master", true, "master", true},
+		{"production", true, "production-isolated", false},
+		{"production-eu", true, "production-eu", false},
+		{"staging", true, "staging", false},
+		{"release_1.2", true, "release_1.2", false},
+		{"feature_minimoo", true, "feature_minimoo", false},
+		{"big_phase2", true, "big_phase2", false},
+		{"my-feature", false, "my-feature", false},
+	}
+	for _, test := range tests {
+		d, err := dc.tagFor(test.branch)
+		if err != nil {
+			t.Error(test.branch, "returned error", err)
+			continue
+		}
+		if d.Build != test.build || d.Tag != test.tag || d.Latest != test.latest || d.PullRequests {
+			t.Errorf("%s: expected build=%t tag=%s latest=%t, got %+v", test.branch, test.build, test.tag, test.latest, d)
+		}
+	}
+}
+
+func TestConfigBranchRules(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gdc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, configFileName)
+	content := `
+docker:
+  rules:
+    - branch: ^release/(.*)$
+      tag: "v{{index .Groups 1}}"
+      pull_requests: true
+    - branch: ^main$
+      latest: true
+    - branch: .*
+      build: false
+`
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := loadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d, _ := cfg.Docker.tagFor("release/1.4")
+	if !d.Build || d.Tag != "v1.4" || !d.PullRequests || d.Rule != 1 {
+		t.Errorf("release/1.4: unexpected decision %+v", d)
+	}
+	d, _ = cfg.Docker.tagFor("main")
+	if !d.Build || d.Tag != "main" || !d.Latest || d.Rule != 2 {
+		t.Errorf("main: unexpected decision %+v", d)
+	}
+	d, _ = cfg.Docker.tagFor("feature/x")
+	if d.Build || d.Tag != "feature-x" || d.Rule != 3 {
+		t.Errorf("feature/x: unexpected decision %+v", d)
+	}
+
+	if err := ioutil.WriteFile(path, []byte("docker:\n  rules:\n    - branch: \"(\"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadConfig(path); err == nil {
+		t.Error("an invalid branch pattern should return an error")
+	}
+}
+
+func TestDefaultBranchLatest(t *testing.T) {
+	dc := dockerConfig{}
+	if err := dc.setDefaults(); err != nil {
+		t.Fatal(err)
+	}
+	if err := dc.setDefaultBranch("main"); err != nil {
+		t.Fatal(err)
+	}
+	if d, _ := dc.tagFor("main"); !d.Latest {
+		t.Errorf("main should be tagged latest, got %+v", d)
+	}
+	if d, _ := dc.tagFor("master"); d.Latest {
+		t.Errorf("master should not be tagged latest, got %+v", d)
+	}
+
+	configured := dockerConfig{Rules: []branchRule{{Branch: "^master$", Latest: true}}}
+	if err := configured.setDefaults(); err != nil {
+		t.Fatal(err)
+	}
+	if err := configured.setDefaultBranch("main"); err != nil {
+		t.Fatal(err)
+	}
+	if d, _ := configured.tagFor("master"); !d.Latest {
+		t.Errorf("configured rules should be kept, got %+v", d)
+	}
+}
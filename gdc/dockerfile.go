@@ -0,0 +1,414 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2017 RightScale, Inc, All Rights Reserved Worldwide.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/rightscale/ci/gdc/graph"
+)
+
+// dockerInstruction is a single Dockerfile instruction, with its
+// line continuations already joined
+type dockerInstruction struct {
+	Cmd   string            // upper-cased instruction, e.g. COPY
+	Flags map[string]string // --name=value flags, e.g. from for COPY --from=build
+	Args  []string
+	Line  int
+}
+
+// Splits a Dockerfile into instructions
+func parseDockerfile(content []byte) []dockerInstruction {
+	var instructions []dockerInstruction
+	escape := byte('\\')
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	var current string
+	start, lineNo := 0, 0
+	directives := true
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimRight(scanner.Text(), " \t\r")
+		trimmed := strings.TrimSpace(line)
+
+		if strings.HasPrefix(trimmed, "#") {
+			if directives && strings.HasPrefix(strings.ToLower(strings.Replace(trimmed, " ", "", -1)), "#escape=") {
+				if esc := strings.TrimSpace(trimmed[strings.Index(trimmed, "=")+1:]); len(esc) == 1 {
+					escape = esc[0]
+				}
+			}
+			continue
+		}
+		directives = false
+		if trimmed == "" && current == "" {
+			continue
+		}
+		if current == "" {
+			start = lineNo
+		}
+
+		if len(line) > 0 && line[len(line)-1] == escape {
+			current += line[:len(line)-1] + " "
+			continue
+		}
+		current += line
+		if inst, ok := parseInstruction(current, start); ok {
+			instructions = append(instructions, inst)
+		}
+		current = ""
+	}
+	if current != "" {
+		if inst, ok := parseInstruction(current, start); ok {
+			instructions = append(instructions, inst)
+		}
+	}
+
+	return instructions
+}
+
+func parseInstruction(text string, line int) (dockerInstruction, bool) {
+	fields := strings.Fields(text)
+	if len(fields) == 0 {
+		return dockerInstruction{}, false
+	}
+	inst := dockerInstruction{Cmd: strings.ToUpper(fields[0]), Flags: make(map[string]string), Line: line}
+	rest := strings.TrimSpace(text[strings.Index(text, fields[0])+len(fields[0]):])
+
+	// Leading --flags, only meaningful for a few instructions but harmless for the others
+	for strings.HasPrefix(rest, "--") {
+		end := strings.IndexAny(rest, " \t")
+		flag := rest
+		if end < 0 {
+			rest = ""
+		} else {
+			flag, rest = rest[:end], strings.TrimSpace(rest[end:])
+		}
+		flag = strings.TrimPrefix(flag, "--")
+		if eq := strings.Index(flag, "="); eq >= 0 {
+			inst.Flags[strings.ToLower(flag[:eq])] = flag[eq+1:]
+		} else {
+			inst.Flags[strings.ToLower(flag)] = ""
+		}
+	}
+
+	// Exec form: COPY ["a b", "c"]
+	if strings.HasPrefix(rest, "[") {
+		var args []string
+		if json.Unmarshal([]byte(rest), &args) == nil {
+			inst.Args = args
+			return inst, true
+		}
+	}
+	inst.Args = strings.Fields(rest)
+
+	return inst, true
+}
+
+// dockerfileInputs is what a Dockerfile takes from outside of itself
+type dockerfileInputs struct {
+	Stages  []string // stage names, "" for unnamed stages
+	Sources []string // build context sources of COPY and ADD, relative to the context root
+	Images  []string // external images used by FROM and COPY --from
+}
+
+// Walks the stages of a Dockerfile, expanding build args and environment
+// variables, and returns its inputs. COPY --from of a previous stage is not an
+// input, while COPY --from of an image is. Remote ADD sources are skipped
+func analyzeDockerfile(instructions []dockerInstruction, buildArgs map[string]string) dockerfileInputs {
+	var res dockerfileInputs
+	globalArgs := make(map[string]string)
+	var vars map[string]string
+	images := make(map[string]struct{})
+	sources := make(map[string]struct{})
+
+	isStage := func(ref string) bool {
+		for i, name := range res.Stages {
+			if strings.EqualFold(name, ref) || strconv.Itoa(i) == ref {
+				return true
+			}
+		}
+		return false
+	}
+	declareArg := func(scope map[string]string, arg string) {
+		name, value := arg, ""
+		hasDefault := false
+		if eq := strings.Index(arg, "="); eq >= 0 {
+			name, value, hasDefault = arg[:eq], unquote(arg[eq+1:]), true
+		}
+		switch v, ok := buildArgs[name]; {
+		case ok:
+			scope[name] = v
+		case hasDefault:
+			scope[name] = expandDockerVars(value, scope)
+		default:
+			if v, ok := globalArgs[name]; ok && vars != nil {
+				scope[name] = v
+			}
+		}
+	}
+
+	for _, inst := range instructions {
+		switch inst.Cmd {
+		case "ARG":
+			scope := vars
+			if scope == nil {
+				scope = globalArgs
+			}
+			for _, arg := range inst.Args {
+				declareArg(scope, arg)
+			}
+		case "FROM":
+			if len(inst.Args) == 0 {
+				continue
+			}
+			base := expandDockerVars(inst.Args[0], globalArgs)
+			if !isStage(base) && strings.ToLower(base) != "scratch" {
+				images[base] = struct{}{}
+			}
+			name := ""
+			if len(inst.Args) >= 3 && strings.EqualFold(inst.Args[1], "AS") {
+				name = inst.Args[2]
+			}
+			res.Stages = append(res.Stages, name)
+			vars = make(map[string]string)
+		case "ENV":
+			if vars == nil {
+				continue
+			}
+			if len(inst.Args) >= 2 && !strings.Contains(inst.Args[0], "=") {
+				vars[inst.Args[0]] = expandDockerVars(strings.Join(inst.Args[1:], " "), vars)
+				continue
+			}
+			for _, kv := range inst.Args {
+				if eq := strings.Index(kv, "="); eq >= 0 {
+					vars[kv[:eq]] = expandDockerVars(unquote(kv[eq+1:]), vars)
+				}
+			}
+		case "COPY", "ADD":
+			if len(inst.Args) < 2 {
+				continue
+			}
+			if from, ok := inst.Flags["from"]; ok {
+				from = expandDockerVars(from, vars)
+				if !isStage(from) {
+					images[from] = struct{}{}
+				}
+				continue
+			}
+			for _, src := range inst.Args[:len(inst.Args)-1] {
+				src = expandDockerVars(src, vars)
+				if isRemoteSource(src) {
+					continue
+				}
+				sources[cleanContextPath(src)] = struct{}{}
+			}
+		}
+	}
+
+	res.Sources = graph.GetSortedKeys(sources)
+	res.Images = graph.GetSortedKeys(images)
+	return res
+}
+
+func unquote(value string) string {
+	if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+		return value[1 : len(value)-1]
+	}
+	return value
+}
+
+// Expands $name, ${name}, ${name:-default} and ${name:+alternative} like Docker does
+func expandDockerVars(word string, vars map[string]string) string {
+	var buf bytes.Buffer
+	for i := 0; i < len(word); i++ {
+		c := word[i]
+		if c == '\\' && i+1 < len(word) && word[i+1] == '$' {
+			buf.WriteByte('$')
+			i++
+			continue
+		}
+		if c != '$' || i+1 == len(word) {
+			buf.WriteByte(c)
+			continue
+		}
+
+		if word[i+1] == '{' {
+			end := strings.IndexByte(word[i:], '}')
+			if end < 0 {
+				buf.WriteString(word[i:])
+				break
+			}
+			expr := word[i+2 : i+end]
+			i += end
+			name, op, arg := expr, "", ""
+			if colon := strings.Index(expr, ":"); colon >= 0 && colon+1 < len(expr) {
+				name, op, arg = expr[:colon], expr[colon+1:colon+2], expr[colon+2:]
+			}
+			value, set := vars[name]
+			switch {
+			case op == "-" && (!set || value == ""):
+				value = arg
+			case op == "+" && set && value != "":
+				value = arg
+			case op == "+":
+				value = ""
+			}
+			buf.WriteString(value)
+			continue
+		}
+
+		j := i + 1
+		for j < len(word) && (word[j] == '_' || word[j] >= 'a' && word[j] <= 'z' || word[j] >= 'A' && word[j] <= 'Z' || word[j] >= '0' && word[j] <= '9') {
+			j++
+		}
+		if j == i+1 {
+			buf.WriteByte(c)
+			continue
+		}
+		buf.WriteString(vars[word[i+1:j]])
+		i = j - 1
+	}
+	return buf.String()
+}
+
+func isRemoteSource(src string) bool {
+	for _, prefix := range []string{"http://", "https://", "git@", "git://"} {
+		if strings.HasPrefix(src, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Cleans a path relative to the build context, "/" being the context root
+func cleanContextPath(p string) string {
+	p = path.Clean("/" + p)
+	if p == "/" {
+		return "."
+	}
+	return strings.TrimPrefix(p, "/")
+}
+
+// Returns the files of the list matched by a COPY/ADD source pattern.
+// Like Docker, a matched directory brings all its content
+func matchContextFiles(pattern string, files []string) (matched []string) {
+	if pattern == "." {
+		return files
+	}
+	for _, file := range files {
+		if graph.MatchesInput(pattern, file) {
+			matched = append(matched, file)
+		}
+	}
+	return
+}
+
+// dockerfilePath : If set, Dockerfile used for image targets instead of <directory>/Dockerfile
+var dockerfilePath = ""
+
+// buildArgs : Values given with -build-arg, they override the ARG defaults of Dockerfiles
+var buildArgs = make(map[string]string)
+
+// Returns the repo relative Dockerfile of a target directory
+func targetDockerfile(directory string) string {
+	if dockerfilePath != "" {
+		return path.Clean(filepath.ToSlash(dockerfilePath))
+	}
+	return path.Join(filepath.ToSlash(directory), "Dockerfile")
+}
+
+// Returns the files an image target takes from the repo through its Dockerfile,
+// the Dockerfile itself included, and the external images it is built from.
+// Non-glob sources are also returned as is, so their deletion is noticed too
+func dockerfileDependencies(src graph.FileSource, dockerfile string) (files []string, images []string, err error) {
+	content, err := src.ReadFile(dockerfile)
+	if os.IsNotExist(err) {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	deps := map[string]struct{}{dockerfile: {}}
+	inputs := analyzeDockerfile(parseDockerfile(content), buildArgs)
+	for _, source := range inputs.Sources {
+		// COPY . is left to the Go dependencies, see gdc context
+		if source == "." {
+			continue
+		}
+		if !strings.ContainsAny(source, "*?[") {
+			deps[source] = struct{}{}
+		}
+		for _, file := range matchContextFiles(source, src.Files()) {
+			deps[file] = struct{}{}
+		}
+	}
+
+	return graph.GetSortedKeys(deps), inputs.Images, nil
+}
+
+// Returns the Dockerfile dependencies of a target directory of the working repo
+func getDockerfileDependencies(directory string) (files []string, images []string) {
+	dockerfile := targetDockerfile(directory)
+	if _, err := os.Stat(filepath.Join(getRepoPath(), filepath.FromSlash(dockerfile))); err != nil {
+		return nil, nil
+	}
+	src, err := graph.NewDirSource(getRepoPath())
+	if err == nil {
+		files, images, err = dockerfileDependencies(src, dockerfile)
+	}
+	if err != nil {
+		fmt.Printf("ERROR! Cannot read Dockerfile dependencies of %s: %v\n", directory, err)
+		os.Exit(1)
+	}
+	return
+}
+
+// buildArgFlag collects repeated -build-arg KEY=VALUE flags
+type buildArgFlag map[string]string
+
+func (b buildArgFlag) String() string {
+	var args []string
+	for k, v := range b {
+		args = append(args, k+"="+v)
+	}
+	return strings.Join(args, ",")
+}
+
+func (b buildArgFlag) Set(value string) error {
+	eq := strings.Index(value, "=")
+	if eq <= 0 {
+		return fmt.Errorf("build arg %q should be KEY=VALUE", value)
+	}
+	b[value[:eq]] = value[eq+1:]
+	return nil
+}
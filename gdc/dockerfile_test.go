@@ -0,0 +1,96 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/rightscale/ci/gdc/graph"
+)
+
+func TestParseDockerfile(t *testing.T) {
+	instructions := parseDockerfile([]byte(testRepo["svc/Dockerfile"]))
+	if len(instructions) != 5 {
+		t.Fatal("expected 5 instructions, got", len(instructions))
+	}
+	if instructions[2].Line != 3 || !reflect.DeepEqual(instructions[2].Args, []string{"config/*.yml", "/etc/svc/"}) {
+		t.Error("unexpected continued COPY", instructions[2])
+	}
+	if instructions[4].Flags["from"] != "build" {
+		t.Error("unexpected flags", instructions[4].Flags)
+	}
+	inputs := analyzeDockerfile(instructions, nil)
+	if !reflect.DeepEqual(inputs.Sources, []string{".", "config/*.yml"}) {
+		t.Error("unexpected COPY sources", inputs.Sources)
+	}
+
+	exec := parseDockerfile([]byte("# escape=`\nFROM x\nCOPY [\"a b\", `\n  \"/dst\"]\n"))
+	if len(exec) != 2 || !reflect.DeepEqual(exec[1].Args, []string{"a b", "/dst"}) {
+		t.Error("unexpected exec form parse", exec)
+	}
+}
+
+func TestAnalyzeDockerfile(t *testing.T) {
+	content := `
+ARG GO_VERSION=1.9
+ARG APP=billing
+FROM golang:${GO_VERSION} AS build
+ARG APP
+ENV SRC=services/$APP
+COPY ${SRC}/*.go /go/src/app/
+COPY vendor /go/src/app/vendor
+ADD https://example.com/tool.tgz /tmp/
+FROM build AS test
+COPY --from=build /go/bin/app /app
+FROM alpine:3.6
+COPY --from=1 /app /app
+COPY --from=rightscale/certs:latest /certs /certs
+ADD ["config/${APP:-default}.yml", "/etc/app.yml"]
+`
+	inputs := analyzeDockerfile(parseDockerfile([]byte(content)), nil)
+	if !reflect.DeepEqual(inputs.Stages, []string{"build", "test", ""}) {
+		t.Error("unexpected stages", inputs.Stages)
+	}
+	// The last stage doesn't declare APP, so the ADD falls back to its default
+	expected := []string{"config/default.yml", "services/billing/*.go", "vendor"}
+	if !reflect.DeepEqual(inputs.Sources, expected) {
+		t.Error("sources should be", expected, "but got", inputs.Sources)
+	}
+	expected = []string{"alpine:3.6", "golang:1.9", "rightscale/certs:latest"}
+	if !reflect.DeepEqual(inputs.Images, expected) {
+		t.Error("images should be", expected, "but got", inputs.Images)
+	}
+
+	inputs = analyzeDockerfile(parseDockerfile([]byte(content)), map[string]string{"APP": "queue", "GO_VERSION": "1.10"})
+	expected = []string{"config/default.yml", "services/queue/*.go", "vendor"}
+	if !reflect.DeepEqual(inputs.Sources, expected) {
+		t.Error("sources with build args should be", expected, "but got", inputs.Sources)
+	}
+	if inputs.Images[1] != "golang:1.10" {
+		t.Error("build args should apply to FROM, got", inputs.Images)
+	}
+}
+
+func TestDockerfileDependencies(t *testing.T) {
+	src := graph.MapSource{
+		"svc/Dockerfile":   "FROM golang\nCOPY config/*.yml /etc/\nCOPY scripts /scripts\n",
+		"config/a.yml":     "",
+		"config/b.txt":     "",
+		"scripts/start.sh": "",
+	}
+	files, images, err := dockerfileDependencies(src, "svc/Dockerfile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"config/a.yml", "scripts", "scripts/start.sh", "svc/Dockerfile"}
+	if !reflect.DeepEqual(files, expected) {
+		t.Error("dependencies should be", expected, "but got", files)
+	}
+	if !reflect.DeepEqual(images, []string{"golang"}) {
+		t.Error("unexpected images", images)
+	}
+
+	hits := hitDepends(files, []string{"config/b.txt", "config/a.yml", "scripts/start.sh"})
+	if !reflect.DeepEqual(hits, []string{"config/a.yml", "scripts"}) {
+		t.Error("only the copied files should be hits, got", hits)
+	}
+}
@@ -0,0 +1,238 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2017 RightScale, Inc, All Rights Reserved Worldwide.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/rightscale/ci/gdc/graph"
+)
+
+// exportNode is a node of an exported graph
+type exportNode struct {
+	ID     string `json:"id"`
+	Kind   string `json:"kind"`
+	Path   string `json:"path"`
+	Status string `json:"status,omitempty"` // changed or affected, when highlighting a range
+}
+
+// exportEdge is a dependency of an exported graph, only needed by tests when
+// every edge it stands for is a test edge
+type exportEdge struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+	Test bool   `json:"test"`
+}
+
+// exportGraph is the graph printed by "gdc graph"
+type exportGraph struct {
+	Nodes []exportNode `json:"nodes"`
+	Edges []exportEdge `json:"edges"`
+}
+
+// exportOptions selects what "gdc graph" exports
+type exportOptions struct {
+	Target  string   // only export the nodes of the target and their dependencies, "" for the whole graph
+	Depth   int      // collapse nodes by directory, keeping this number of path elements, 0 to keep them all
+	Edges   string   // all, prod or test
+	Changed []string // changed files whose nodes, and the nodes they affect, are highlighted
+}
+
+// Returns the first depth elements of a directory
+func collapseDir(dir string, depth int) string {
+	elems := strings.Split(dir, "/")
+	if len(elems) > depth {
+		elems = elems[:depth]
+	}
+	return strings.Join(elems, "/")
+}
+
+// Returns the graph, or a subgraph of it, ready to be printed
+func newExportGraph(g *graph.Graph, opts exportOptions) exportGraph {
+	ids := g.NodeIDs()
+	if opts.Target != "" {
+		ids = g.DependencyNodes(g.TargetNodes(opts.Target), opts.Edges != "prod")
+	}
+	status := make(map[string]string)
+	if opts.Changed != nil {
+		for _, id := range g.AffectedNodes(opts.Changed) {
+			status[id] = "affected"
+		}
+		for _, file := range opts.Changed {
+			for _, id := range g.NodesOf(file) {
+				status[id] = "changed"
+			}
+		}
+	}
+
+	// Nodes are exported under the ID of their group when collapsing
+	group := make(map[string]string)
+	nodes := make(map[string]*exportNode)
+	for _, id := range ids {
+		node := g.Nodes[id]
+		e := exportNode{ID: id, Kind: node.Kind, Path: node.Path}
+		if opts.Depth > 0 {
+			dir := collapseDir(node.Dir(), opts.Depth)
+			e = exportNode{ID: dir, Kind: "dir", Path: dir}
+		}
+		group[id] = e.ID
+		if nodes[e.ID] == nil {
+			nodes[e.ID] = &e
+		}
+		if s := status[id]; s == "changed" || s == "affected" && nodes[e.ID].Status == "" {
+			nodes[e.ID].Status = s
+		}
+	}
+
+	edges := make(map[exportEdge]bool)
+	for _, e := range g.Edges {
+		from, to := group[e.From], group[e.To]
+		if from == "" || to == "" || from == to || opts.Edges == "prod" && e.Test || opts.Edges == "test" && !e.Test {
+			continue
+		}
+		edges[exportEdge{From: from, To: to, Test: e.Test}] = true
+	}
+
+	res := exportGraph{Nodes: []exportNode{}, Edges: []exportEdge{}}
+	for _, node := range nodes {
+		res.Nodes = append(res.Nodes, *node)
+	}
+	sort.Slice(res.Nodes, func(i, j int) bool { return res.Nodes[i].ID < res.Nodes[j].ID })
+	for e := range edges {
+		// A test edge is redundant next to a production one
+		if e.Test && edges[exportEdge{From: e.From, To: e.To}] {
+			continue
+		}
+		res.Edges = append(res.Edges, e)
+	}
+	sort.Slice(res.Edges, func(i, j int) bool {
+		a, b := res.Edges[i], res.Edges[j]
+		return a.From < b.From || a.From == b.From && a.To < b.To
+	})
+	return res
+}
+
+// Returns the graph in the Graphviz DOT language
+func (e exportGraph) dot() string {
+	var b strings.Builder
+	b.WriteString("digraph gdc {\n  rankdir=LR;\n  node [shape=box];\n")
+	for _, node := range e.Nodes {
+		attrs := ""
+		switch node.Status {
+		case "changed":
+			attrs = ", style=filled, fillcolor=salmon"
+		case "affected":
+			attrs = ", style=filled, fillcolor=lightyellow"
+		}
+		fmt.Fprintf(&b, "  %q [label=%q%s];\n", node.ID, node.ID, attrs)
+	}
+	for _, edge := range e.Edges {
+		attrs := ""
+		if edge.Test {
+			attrs = " [style=dashed]"
+		}
+		fmt.Fprintf(&b, "  %q -> %q%s;\n", edge.From, edge.To, attrs)
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
+
+// Returns the graph as a Mermaid flowchart. Node IDs are replaced by n<index>
+// since Mermaid doesn't allow most characters of paths in them
+func (e exportGraph) mermaid() string {
+	var b strings.Builder
+	b.WriteString("graph LR\n")
+	names := make(map[string]string)
+	classes := make(map[string][]string)
+	for i, node := range e.Nodes {
+		names[node.ID] = fmt.Sprintf("n%d", i)
+		fmt.Fprintf(&b, "  %s[\"%s\"]\n", names[node.ID], strings.Replace(node.ID, "\"", "#quot;", -1))
+		if node.Status != "" {
+			classes[node.Status] = append(classes[node.Status], names[node.ID])
+		}
+	}
+	for _, edge := range e.Edges {
+		arrow := "-->"
+		if edge.Test {
+			arrow = "-.->"
+		}
+		fmt.Fprintf(&b, "  %s %s %s\n", names[edge.From], arrow, names[edge.To])
+	}
+	if len(classes) > 0 {
+		b.WriteString("  classDef changed fill:#fa8072\n  classDef affected fill:#ffffe0\n")
+		for _, status := range []string{"changed", "affected"} {
+			if len(classes[status]) > 0 {
+				fmt.Fprintf(&b, "  class %s %s\n", strings.Join(classes[status], ","), status)
+			}
+		}
+	}
+	return b.String()
+}
+
+// Exits if the -edges flag is not all, prod or test
+func exitOnUnknownEdges(edges string) {
+	if edges != "all" && edges != "prod" && edges != "test" {
+		fmt.Printf("ERROR! Unknown edges %s\n", edges)
+		os.Exit(1)
+	}
+}
+
+// Implements "gdc graph"
+func graphCommand(args []string) {
+	fs := flag.NewFlagSet("graph", flag.ExitOnError)
+	format := fs.String("format", "dot", "output format: dot, mermaid or json")
+	changes := fs.String("changes", "", "highlight the nodes changed and affected by a <sha1>..<sha2> range")
+	var opts exportOptions
+	fs.IntVar(&opts.Depth, "depth", 0, "collapse nodes by directory, keeping this number of path elements")
+	fs.StringVar(&opts.Edges, "edges", "all", "edges to export: all, prod or test")
+	fs.Usage = func() {
+		fmt.Println("Usage: gdc graph [-format dot|mermaid|json] [-changes <sha1>..<sha2>] [-depth N] [-edges all|prod|test] [target]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	exitOnUnknownEdges(opts.Edges)
+	opts.Target = fs.Arg(0)
+
+	g := getRepoGraph()
+	if *changes != "" {
+		sha1, sha2, err := parseRange(*changes)
+		exitOnError(err)
+		opts.Changed = getChanges(g, sha1, sha2).Changed
+	}
+	res := newExportGraph(g, opts)
+	switch *format {
+	case "dot":
+		fmt.Print(res.dot())
+	case "mermaid":
+		fmt.Print(res.mermaid())
+	case "json":
+		printJSON(res)
+	default:
+		fmt.Printf("ERROR! Unknown format %s\n", *format)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestExportGraph(t *testing.T) {
+	g := buildGraph(testRepo, "github.com/org/repo")
+
+	res := newExportGraph(g, exportOptions{Target: "svc", Edges: "all", Changed: []string{"lib/b/b.go"}})
+	expected := exportGraph{
+		Nodes: []exportNode{
+			{ID: "go:lib/a", Kind: "go", Path: "lib/a", Status: "affected"},
+			{ID: "go:lib/b", Kind: "go", Path: "lib/b", Status: "changed"},
+			{ID: "go:lib/testutil", Kind: "go", Path: "lib/testutil"},
+			{ID: "go:svc", Kind: "go", Path: "svc", Status: "affected"},
+			{ID: "go:svc/sub", Kind: "go", Path: "svc/sub"},
+		},
+		Edges: []exportEdge{
+			{From: "go:lib/a", To: "go:lib/b"},
+			{From: "go:svc", To: "go:lib/a"},
+			{From: "go:svc", To: "go:lib/testutil", Test: true},
+		},
+	}
+	if !reflect.DeepEqual(res, expected) {
+		t.Errorf("graph of svc should be\n%+v\nbut got\n%+v", expected, res)
+	}
+
+	expectedDot := `digraph gdc {
+  rankdir=LR;
+  node [shape=box];
+  "go:lib/a" [label="go:lib/a", style=filled, fillcolor=lightyellow];
+  "go:lib/b" [label="go:lib/b", style=filled, fillcolor=salmon];
+  "go:lib/testutil" [label="go:lib/testutil"];
+  "go:svc" [label="go:svc", style=filled, fillcolor=lightyellow];
+  "go:svc/sub" [label="go:svc/sub"];
+  "go:lib/a" -> "go:lib/b";
+  "go:svc" -> "go:lib/a";
+  "go:svc" -> "go:lib/testutil" [style=dashed];
+}
+`
+	if dot := res.dot(); dot != expectedDot {
+		t.Errorf("unexpected DOT output:\n%s", dot)
+	}
+	expectedMermaid := `graph LR
+  n0["go:lib/a"]
+  n1["go:lib/b"]
+  n2["go:lib/testutil"]
+  n3["go:svc"]
+  n4["go:svc/sub"]
+  n0 --> n1
+  n3 --> n0
+  n3 -.-> n2
+  classDef changed fill:#fa8072
+  classDef affected fill:#ffffe0
+  class n1 changed
+  class n0,n3 affected
+`
+	if mermaid := res.mermaid(); mermaid != expectedMermaid {
+		t.Errorf("unexpected Mermaid output:\n%s", mermaid)
+	}
+
+	// Collapsed production edges of the whole graph
+	res = newExportGraph(g, exportOptions{Depth: 1, Edges: "prod"})
+	var ids []string
+	for _, node := range res.Nodes {
+		ids = append(ids, node.ID)
+	}
+	if !reflect.DeepEqual(ids, []string{"lib", "other", "svc"}) {
+		t.Error("unexpected collapsed nodes:", ids)
+	}
+	if !reflect.DeepEqual(res.Edges, []exportEdge{{From: "other", To: "lib"}, {From: "svc", To: "lib"}}) {
+		t.Error("unexpected collapsed edges:", res.Edges)
+	}
+
+	res = newExportGraph(g, exportOptions{Edges: "test"})
+	if !reflect.DeepEqual(res.Edges, []exportEdge{{From: "go:lib/a", To: "go:lib/c", Test: true}, {From: "go:svc", To: "go:lib/testutil", Test: true}}) {
+		t.Error("unexpected test edges:", res.Edges)
+	}
+}
@@ -0,0 +1,330 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2017 RightScale, Inc, All Rights Reserved Worldwide.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/src-d/go-git.v4/plumbing"
+
+	"github.com/rightscale/ci/gdc/graph"
+)
+
+// Bumped whenever the way fingerprints are computed changes
+const fingerprintVersion = "gdc-fingerprint-1"
+
+// fingerprintConfig is the "fingerprint" section of .gdc.yml
+type fingerprintConfig struct {
+	Store string `yaml:"store"` // directory of the local result store
+}
+
+func (fc *fingerprintConfig) setDefaults() error {
+	if fc.Store == "" {
+		fc.Store = ".gdc/results"
+	}
+	return nil
+}
+
+// Returns the files of src a target depends on: everything under the target
+// directory, the files the packages it imports are built from (transitively,
+// tests of the target included), its Dockerfile dependencies, the root files and the
+// configured global and extra inputs
+func targetInputs(g *graph.Graph, src graph.FileSource, target string, ic graph.Inputs) ([]string, error) {
+	target = path.Clean(filepath.ToSlash(target))
+	inputs := make(map[string]struct{})
+	add := func(list []string) {
+		for _, file := range list {
+			inputs[file] = struct{}{}
+		}
+	}
+
+	add(g.RootFiles)
+	targets := g.TargetPackages(target)
+	deps := g.TransitiveImports(targets, true)
+	for _, dir := range deps {
+		// Imported packages are inputs through the files they're built from only
+		if node := g.Packages[dir]; node != nil {
+			add(node.Inputs(graph.Contains(targets, dir)))
+		}
+	}
+	add(g.ProtoSources(deps))
+	add(g.AnalyzedInputs(target))
+	vendored := append(g.VendoredDeps(deps, false), g.VendoredDeps(g.TargetPackages(target), true)...)
+	for _, dir := range vendored {
+		add(g.Vendor[dir].Files)
+		add(g.Vendor[dir].Inputs(false))
+	}
+
+	patterns := ic.ForTarget(target)
+	for _, file := range src.Files() {
+		if target == "." || strings.HasPrefix(file, target+"/") {
+			inputs[file] = struct{}{}
+			continue
+		}
+		for _, pattern := range patterns {
+			if file == pattern || graph.MatchesInput(pattern, file) {
+				inputs[file] = struct{}{}
+				break
+			}
+		}
+	}
+
+	dockerFiles, _, err := dockerfileDependencies(src, targetDockerfile(target))
+	if err != nil {
+		return nil, err
+	}
+	files := src.Files()
+	for _, file := range dockerFiles {
+		if i := sort.SearchStrings(files, file); i < len(files) && files[i] == file {
+			inputs[file] = struct{}{}
+		}
+	}
+
+	return graph.GetSortedKeys(inputs), nil
+}
+
+// Returns the git blob hash of a file, as stored in the tree when available
+func blobHash(src graph.FileSource, name string) (string, error) {
+	if hasher, ok := src.(interface {
+		BlobHash(string) (string, bool)
+	}); ok {
+		if hash, ok := hasher.BlobHash(name); ok {
+			return hash, nil
+		}
+	}
+	content, err := src.ReadFile(name)
+	if err != nil {
+		return "", err
+	}
+	return plumbing.ComputeHash(plumbing.BlobObject, content).String(), nil
+}
+
+// Computes the fingerprint of a target: a hash over the blob hashes of its inputs,
+// the config that decides what its inputs are and the Docker build settings
+func computeFingerprint(src graph.FileSource, target string, inputs []string, ic graph.Inputs, out io.Writer) (string, error) {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\ntarget %s\n", fingerprintVersion, path.Clean(filepath.ToSlash(target)))
+
+	patterns := ic.ForTarget(target)
+	sort.Strings(patterns)
+	fmt.Fprintf(h, "inputs %q\n", patterns)
+	fmt.Fprintf(h, "dockerfile %q\n", targetDockerfile(target))
+	var args []string
+	for k, v := range buildArgs {
+		args = append(args, k+"="+v)
+	}
+	sort.Strings(args)
+	fmt.Fprintf(h, "build-args %q\n", args)
+
+	for _, input := range inputs {
+		hash, err := blobHash(src, input)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(h, "%s %s\n", hash, input)
+		if out != nil {
+			fmt.Fprintf(out, "%s %s\n", hash, input)
+		}
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// Returns the fingerprint of a target in the tree of a commit
+func targetFingerprint(rev, target string, out io.Writer) string {
+	src := newTreeSource(rev)
+	g := buildGraph(src, getCurrentRelativePath())
+	ic := getConfig().Inputs
+	inputs, err := targetInputs(g, src, target, ic)
+	if err == nil {
+		var fp string
+		fp, err = computeFingerprint(src, target, inputs, ic, out)
+		if err == nil {
+			return fp
+		}
+	}
+	fmt.Printf("ERROR! Cannot compute fingerprint of %s: %v\n", target, err)
+	os.Exit(1)
+	return ""
+}
+
+// fingerprintResult is what is known about the build of a fingerprint
+type fingerprintResult struct {
+	Fingerprint string    `json:"fingerprint"`
+	Target      string    `json:"target"`
+	SHA         string    `json:"sha"`
+	Status      string    `json:"status"` // success or failure
+	Time        time.Time `json:"time"`
+}
+
+// resultStore keeps build results by fingerprint
+type resultStore interface {
+	// Returns nil if the fingerprint is unknown
+	Get(fingerprint string) (*fingerprintResult, error)
+	Put(result fingerprintResult) error
+}
+
+// fileResultStore is a resultStore in a local directory
+type fileResultStore struct {
+	Dir string
+}
+
+func (s *fileResultStore) path(fingerprint string) string {
+	return filepath.Join(s.Dir, fingerprint[:2], fingerprint+".json")
+}
+
+func (s *fileResultStore) Get(fingerprint string) (*fingerprintResult, error) {
+	if len(fingerprint) < 3 {
+		return nil, fmt.Errorf("invalid fingerprint %q", fingerprint)
+	}
+	content, err := ioutil.ReadFile(s.path(fingerprint))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var result fingerprintResult
+	if err := json.Unmarshal(content, &result); err != nil {
+		return nil, fmt.Errorf("corrupted result file %s: %v", s.path(fingerprint), err)
+	}
+	return &result, nil
+}
+
+func (s *fileResultStore) Put(result fingerprintResult) error {
+	if len(result.Fingerprint) < 3 {
+		return fmt.Errorf("invalid fingerprint %q", result.Fingerprint)
+	}
+	file := s.path(result.Fingerprint)
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return err
+	}
+	content, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(file+".tmp", content, 0644); err != nil {
+		return err
+	}
+	return os.Rename(file+".tmp", file)
+}
+
+// Returns the result store of the current repo, backed by the remote cache if configured
+func getResultStore() resultStore {
+	cfg := getConfig()
+	dir := cfg.Fingerprint.Store
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(getRepoPath(), dir)
+	}
+	local := &fileResultStore{Dir: dir}
+	if cfg.Cache.URL == "" {
+		return local
+	}
+
+	remote := &httpResultStore{
+		URL:      cfg.Cache.URL,
+		Token:    os.Getenv("GDC_CACHE_TOKEN"),
+		TTL:      cfg.Cache.TTL,
+		ReadOnly: cfg.Cache.readOnly(),
+		HTTP:     &http.Client{Timeout: 30 * time.Second},
+	}
+	return &tieredResultStore{local: local, remote: remote, ttl: cfg.Cache.TTL}
+}
+
+// Whether the fingerprint of target at HEAD already built successfully
+func fingerprintAlreadyBuilt(target string) bool {
+	fp := targetFingerprint("HEAD", target, nil)
+	result, err := getResultStore().Get(fp)
+	if err != nil {
+		fmt.Printf("WARNING! Cannot read result of fingerprint %s: %v\n", fp, err)
+		return false
+	}
+	if result == nil || result.Status != "success" || expired(result, getConfig().Cache.TTL) {
+		if Verbose {
+			fmt.Printf("Fingerprint %s of %s has no successful build\n", fp, target)
+		}
+		return false
+	}
+	if Verbose {
+		fmt.Printf("Fingerprint %s of %s already built successfully at %s (%s)\n", fp, target, result.SHA, result.Time)
+	}
+	return true
+}
+
+// Implements "gdc fingerprint"
+func fingerprintCommand(args []string) {
+	fs := flag.NewFlagSet("fingerprint", flag.ExitOnError)
+	rev := fs.String("rev", "HEAD", "commit whose tree is fingerprinted")
+	list := fs.Bool("list", false, "list the inputs with their blob hashes")
+	record := fs.String("record", "", "record the build result of the fingerprint: success or failure")
+	fs.Usage = func() {
+		fmt.Println("Usage: gdc fingerprint [-rev <sha>] [-list] [-record success|failure] <directory>")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(1)
+	}
+	target := path.Clean(filepath.ToSlash(fs.Arg(0)))
+
+	var out io.Writer
+	if *list {
+		out = os.Stdout
+	}
+	fp := targetFingerprint(*rev, target, out)
+
+	switch *record {
+	case "":
+		fmt.Println(fp)
+	case "success", "failure":
+		result := fingerprintResult{
+			Fingerprint: fp,
+			Target:      target,
+			SHA:         expandSHA(*rev),
+			Status:      *record,
+			Time:        time.Now().UTC(),
+		}
+		if err := getResultStore().Put(result); err != nil {
+			fmt.Printf("ERROR! Cannot record result of %s: %v\n", fp, err)
+			os.Exit(1)
+		}
+		fmt.Printf("Recorded %s for fingerprint %s of %s\n", *record, fp, target)
+	default:
+		fmt.Printf("ERROR! -record should be success or failure, not %q\n", *record)
+		os.Exit(1)
+	}
+}
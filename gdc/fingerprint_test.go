@@ -0,0 +1,96 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/rightscale/ci/gdc/graph"
+)
+
+func fingerprintOf(t *testing.T, src graph.MapSource, target string, ic graph.Inputs) string {
+	g := buildGraph(src, "github.com/org/repo")
+	inputs, err := targetInputs(g, src, target, ic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fp, err := computeFingerprint(src, target, inputs, ic, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fp
+}
+
+func TestTargetInputs(t *testing.T) {
+	g := buildGraph(testRepo, "github.com/org/repo")
+	ic := graph.Inputs{Targets: map[string][]string{"svc": {"config/*.txt"}}}
+	inputs, err := targetInputs(g, testRepo, "svc", ic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"README.md",
+		"config/app.yml",
+		"config/other.txt",
+		"glide.yaml",
+		"lib/a/a.go",
+		"lib/b/b.go",
+		"lib/testutil/util.go",
+		"svc/Dockerfile",
+		"svc/main.go",
+		"svc/main_test.go",
+		"svc/sub/sub.go",
+	}
+	if !reflect.DeepEqual(inputs, expected) {
+		t.Error("inputs should be", expected, "but got", inputs)
+	}
+}
+
+func TestFingerprint(t *testing.T) {
+	ic := graph.Inputs{}
+	fp := fingerprintOf(t, testRepo, "svc", ic)
+	if fp != fingerprintOf(t, testRepo, "svc", ic) {
+		t.Error("fingerprint should be deterministic")
+	}
+
+	unrelated := testRepo.Copy()
+	unrelated["other/other.go"] += "// changed\n"
+	unrelated["lib/c/c.go"] += "// changed\n"
+	unrelated["lib/a/README.md"] += "changed\n"
+	unrelated["lib/a/a_test.go"] += "// changed\n"
+	if fingerprintOf(t, unrelated, "svc", ic) != fp {
+		t.Error("changes outside of the inputs should not change the fingerprint")
+	}
+
+	related := testRepo.Copy()
+	related["lib/b/b.go"] += "// changed\n"
+	if fingerprintOf(t, related, "svc", ic) == fp {
+		t.Error("a change in a transitive import should change the fingerprint")
+	}
+
+	if fingerprintOf(t, testRepo, "svc", graph.Inputs{Global: []string{"other/*"}}) == fp {
+		t.Error("a change of the configured inputs should change the fingerprint")
+	}
+}
+
+func TestFileResultStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gdc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	store := &fileResultStore{Dir: dir}
+	fp := "abcdef0123456789"
+	if res, err := store.Get(fp); err != nil || res != nil {
+		t.Error("unknown fingerprint should return nil, got", res, err)
+	}
+	if err := store.Put(fingerprintResult{Fingerprint: fp, Target: "svc", SHA: greenSHA, Status: "success"}); err != nil {
+		t.Fatal(err)
+	}
+	res, err := store.Get(fp)
+	if err != nil || res == nil || res.Status != "success" || res.Target != "svc" || res.SHA != greenSHA {
+		t.Error("unexpected stored result", res, err)
+	}
+}
@@ -30,17 +30,37 @@ import (
 	"path/filepath"
 	"strconv"
 	"strings"
+
+	"github.com/rightscale/ci/gdc/graph"
 )
 
 // Verbose : If true, display debug messages
 var Verbose = false
 var version = "0.1.1"
 
+// cliLogger prints the warnings of the repo, graph and impact packages, and
+// their other messages in verbose mode
+type cliLogger struct{}
+
+func (cliLogger) Printf(format string, v ...interface{}) {
+	if Verbose || strings.HasPrefix(format, "WARNING!") {
+		fmt.Printf(format, v...)
+	}
+}
+
+// Prints the error and exits when there is one
+func exitOnError(err error) {
+	if err != nil {
+		fmt.Printf("ERROR! %v\n", err)
+		os.Exit(1)
+	}
+}
+
 // Returns flags and params from command line
-func getFlagsAndParams() (flags map[string]string, command string, directory string) {
+func getFlagsAndParams() (flags map[string]string, command string, directory string, args []string) {
 	flag.Usage = func() {
 		fmt.Fprintf(os.Stderr, "Usage of %s:  %s [flags] <command> [directory] \n", os.Args[0], os.Args[0])
-		fmt.Println("\nAvailable commands:\n")
+		fmt.Print("\nAvailable commands:\n\n")
 		fmt.Println("  version - returns current version")
 		fmt.Println("  check - check if directory has changed dependencies")
 		fmt.Println("  travis - check if directory has changed dependencies, using Travis Env Vars")
@@ -48,7 +68,23 @@ func getFlagsAndParams() (flags map[string]string, command string, directory str
 		fmt.Println("  root - show root directories that have changed dependencies")
 		fmt.Println("  deps - show all deps of a given directory (this will include the files of the directory)")
 		fmt.Println("  imports - show all imports of a given directory")
-		fmt.Println("\nAvailable flags:\n")
+		fmt.Println("  image promote <src> <dst> - copy an image tag inside the registry, without pulling it")
+		fmt.Println("  docker tag-for <branch> - show the image tag and build decision for a branch")
+		fmt.Println("  context <directory> - list, stage or .dockerignore the files needed to build a directory")
+		fmt.Println("  green <sha> - exit 0 if sha already has a green build, 1 otherwise")
+		fmt.Println("  fingerprint <directory> - show or record the content hash of the inputs of a directory")
+		fmt.Println("  cache-server - serve a remote cache of fingerprint results")
+		fmt.Println("  affected [<sha1>..<sha2>] - show the packages affected by the changes")
+		fmt.Println("  run -- <command> - run a command for every affected package")
+		fmt.Println("  tests [<sha1>..<sha2>] - show the tests reaching a changed function, as -run regexes")
+		fmt.Println("  impact build|update|add|query|status - manage and query the coverage based test impact index")
+		fmt.Println("  vendor-check - check that vendor/modules.txt matches go.mod")
+		fmt.Println("  generate-check [<sha1>..<sha2>] - fail if generator inputs changed but not the generated files")
+		fmt.Println("  graph [target] - export the dependency graph as DOT, Mermaid or JSON")
+		fmt.Println("  why <target> [<sha1>..<sha2>] - show why the changes affect a target")
+		fmt.Println("  lint-deps - check the dependency rules of the config and look for cycles")
+		fmt.Println("  graph-diff <sha1> <sha2> - show the nodes and edges added and removed between two commits")
+		fmt.Print("\nAvailable flags:\n\n")
 		flag.PrintDefaults()
 		fmt.Println(" ")
 	}
@@ -57,6 +93,10 @@ func getFlagsAndParams() (flags map[string]string, command string, directory str
 	usetravisenv := flag.Bool("usetravisenv", false, "use TRAVIS_COMMIT_RANGE env var")
 	sha1 := flag.String("sha1", "HEAD", "sha1, defaults to HEAD")
 	sha2 := flag.String("sha2", "HEAD~1", "sha2, defaults to HEAD~1")
+	config := flag.String("config", "", "config file, defaults to "+configFileName+" in the repo root")
+	dockerfile := flag.String("dockerfile", "", "Dockerfile of image targets, defaults to <directory>/Dockerfile")
+	flag.Var(buildArgFlag(buildArgs), "build-arg", "Dockerfile build arg as KEY=VALUE, can be repeated")
+	flag.BoolVar(&ignoreFormatting, "ignore-format", false, "ignore changes to Go files that only touch formatting or comments")
 	flag.Parse()
 
 	flags = make(map[string]string)
@@ -64,6 +104,8 @@ func getFlagsAndParams() (flags map[string]string, command string, directory str
 	flags["sha2"] = *sha2
 	flags["usetravisenv"] = strconv.FormatBool(*usetravisenv)
 	Verbose = *verbose
+	configPath = *config
+	dockerfilePath = *dockerfile
 
 	params := os.Args[len(os.Args)-flag.NArg() : len(os.Args)]
 
@@ -73,6 +115,7 @@ func getFlagsAndParams() (flags map[string]string, command string, directory str
 		os.Exit(1)
 	}
 	command = params[0]
+	args = params[1:]
 	directory = ""
 	if len(params) == 2 {
 		directory = params[1]
@@ -89,9 +132,17 @@ func getGoPath() (gopath string) {
 // Returns current project path, relative to GOPATH/src
 // Obtained in this way: (GIT PATH) - (GOPATH)
 //    Also removing /src preffix and .git/ suffix
+// The module path of the root go.mod is used instead when there is one, and
+// with a root go.work, the project has no single path
 func getCurrentRelativePath() (relPath string) {
 	workdir := getRepoPath() // Finds current Git repo base path
 	workdir = strings.TrimSuffix(workdir, ".git/")
+	if modPath := graph.RootModulePath(workdir); modPath != "" {
+		return modPath
+	}
+	if _, err := os.Stat(filepath.Join(workdir, "go.work")); err == nil {
+		return ""
+	}
 	gopath := getGoPath()
 	if !strings.HasPrefix(workdir, gopath) {
 		fmt.Printf("ERROR! Current working repository dir should be inside GOPATH.\n")
@@ -134,12 +185,15 @@ func getTravisCommitRange() (sha1 string, sha2 string) {
 //   If any of the changedPaths is a root file, it always counts as dependency
 func hitDepends(imports, changedPaths []string) (depends []string) {
 	for _, path := range changedPaths {
-		if isRootFile(path) {
+		if graph.IsRootFile(path) {
 			depends = append(depends, path)
 			continue
 		}
 		for _, anImport := range imports {
-			if anImport == filepath.Dir(path) {
+			if isPackageTest(anImport, path) {
+				continue
+			}
+			if anImport == filepath.Dir(path) || anImport == path || graph.MatchesInput(anImport, path) {
 				depends = append(depends, anImport)
 				break
 			}
@@ -166,7 +220,7 @@ func hitDepends(imports, changedPaths []string) (depends []string) {
 
 // Given SHA1 and SHA2 and a directory, checks if there are hit dependencies
 func findHitDeps(sha1, sha2, directory string) []string {
-	paths := changedPaths(sha1, sha2)
+	paths := getChanges(getRepoGraph(), sha1, sha2).Changed
 	imports := getParsedDependencies(directory, getCurrentRelativePath())
 
 	return hitDepends(imports, paths)
@@ -187,8 +241,20 @@ func showGitDiff(sha1, sha2 string) {
 	return
 }
 
+// Parses the flags given after the check and travis commands, returns the directory
+func getTargetFlags(command string, args []string) (directory string, sinceFingerprint bool) {
+	fs := flag.NewFlagSet(command, flag.ExitOnError)
+	since := fs.Bool("since-fingerprint", false, "skip the directory if its fingerprint at HEAD already built successfully")
+	fs.Parse(args)
+	return fs.Arg(0), *since
+}
+
 // Travis functionality, returns dependencies or "skip" if there are no hit dependencies
-func travis(directory string) {
+func travis(directory string, sinceFingerprint bool) {
+	if sinceFingerprint && fingerprintAlreadyBuilt(directory) {
+		fmt.Printf("skip\n")
+		os.Exit(0)
+	}
 	sha1, sha2 := getTravisCommitRange()
 
 	depends := findHitDeps(sha1, sha2, directory)
@@ -203,7 +269,7 @@ func travis(directory string) {
 
 func main() {
 	var sha1, sha2 string
-	flags, command, directory := getFlagsAndParams()
+	flags, command, directory, args := getFlagsAndParams()
 	sha1 = flags["sha1"]
 	sha2 = flags["sha2"]
 	if flags["usetravisenv"] == "true" {
@@ -222,11 +288,12 @@ func main() {
 	case "version":
 		fmt.Printf("gdc version %s\n", version)
 	case "travis":
+		directory, sinceFingerprint := getTargetFlags(command, args)
 		if len(directory) == 0 {
 			fmt.Println("You need to specify a directory with this command")
 			os.Exit(1)
 		}
-		travis(directory)
+		travis(directory, sinceFingerprint)
 	case "root":
 		sha1, sha2 := getTravisCommitRange()
 		folders := changedRootFolders(sha1, sha2)
@@ -241,6 +308,12 @@ func main() {
 		for _, k := range res {
 			fmt.Println(k)
 		}
+		if _, images := getDockerfileDependencies(directory); len(images) > 0 {
+			fmt.Printf("\nImages used by %s: \n\n", targetDockerfile(directory))
+			for _, image := range images {
+				fmt.Println(image)
+			}
+		}
 	case "imports":
 		if len(directory) == 0 {
 			fmt.Println("You need to specify a directory with this command")
@@ -253,11 +326,48 @@ func main() {
 		}
 	case "gitdiff":
 		showGitDiff(sha1, sha2)
+	case "image":
+		imageCommand(args)
+	case "docker":
+		dockerCommand(args)
+	case "context":
+		contextCommand(args)
+	case "green":
+		greenCommand(args)
+	case "fingerprint":
+		fingerprintCommand(args)
+	case "cache-server":
+		cacheServerCommand(args)
+	case "affected":
+		affectedCommand(sha1, sha2, args)
+	case "run":
+		runCommand(sha1, sha2, args)
+	case "tests":
+		testsCommand(sha1, sha2, args)
+	case "impact":
+		impactCommand(args)
+	case "vendor-check":
+		vendorCheckCommand(args)
+	case "generate-check":
+		generateCheckCommand(sha1, sha2, args)
+	case "graph":
+		graphCommand(args)
+	case "why":
+		whyCommand(sha1, sha2, args)
+	case "lint-deps":
+		lintDepsCommand(args)
+	case "graph-diff":
+		graphDiffCommand(args)
 	case "check":
+		directory, sinceFingerprint := getTargetFlags(command, args)
 		if len(directory) == 0 {
 			fmt.Println("You need to specify a directory with this command")
 			os.Exit(1)
 		}
+		if sinceFingerprint && fingerprintAlreadyBuilt(directory) {
+			fmt.Println("Fingerprint already built successfully, no dependencies found")
+			break
+		}
 		depends := findHitDeps(sha1, sha2, directory)
 		if len(depends) > 0 {
 			fmt.Printf("Dependencies found: %v \n", depends)
@@ -0,0 +1,15 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestHitDependsInputs(t *testing.T) {
+	inputs := []string{"config", "scripts/*.sh", "lib/a"}
+	hits := hitDepends(inputs, []string{"config/app.yml", "config/env/prod.yml", "scripts/run.sh", "lib/a/a.go", "docs/index.md"})
+	expected := []string{"config", "config", "scripts/*.sh", "lib/a"}
+	if !reflect.DeepEqual(hits, expected) {
+		t.Error("expected", expected, "but got", hits)
+	}
+}
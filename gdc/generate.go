@@ -0,0 +1,58 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2017 RightScale, Inc, All Rights Reserved Worldwide.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/rightscale/ci/gdc/graph"
+)
+
+// Implements "gdc generate-check"
+func generateCheckCommand(sha1, sha2 string, args []string) {
+	fs := flag.NewFlagSet("generate-check", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Println("Usage: gdc generate-check [<sha1>..<sha2>]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	sha1, sha2 = rangeArg(fs, sha1, sha2)
+
+	src, err := graph.NewDirSource(getRepoPath())
+	exitOnError(err)
+	stale := graph.CheckGenerated(graph.GenerateRules(src, getConfig().Generate), changedPaths(sha1, sha2))
+	for _, s := range stale {
+		fmt.Printf("%s: inputs changed but not the generated files\n", s.Rule.Source)
+		fmt.Printf("  changed inputs: %s\n", strings.Join(s.Inputs, " "))
+		fmt.Printf("  outputs: %s\n", strings.Join(s.Rule.Outputs, " "))
+		if s.Rule.Command != "" {
+			fmt.Printf("  regenerate with: %s\n", s.Rule.Command)
+		}
+	}
+	if len(stale) > 0 {
+		os.Exit(1)
+	}
+}
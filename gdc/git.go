@@ -23,338 +23,51 @@
 package main
 
 import (
-	"errors"
-	"fmt"
+	"context"
 	"os"
 	"path/filepath"
-	"strconv"
 	"strings"
 
-	"gopkg.in/src-d/go-git.v4"
-	"gopkg.in/src-d/go-git.v4/plumbing"
-	"gopkg.in/src-d/go-git.v4/plumbing/object"
+	"github.com/rightscale/ci/gdc/graph"
+	"github.com/rightscale/ci/gdc/repo"
 )
 
-var gitPath = ""
+var currentRepo *repo.Repo
 
-func getRepoPath() string {
-	if len(gitPath) == 0 {
-		openRepo()
-	}
-	return gitPath
-}
-
-func changedPaths(sh1, sh2 string) []string {
-	if Verbose {
-		fmt.Printf("changedPaths from %s to %s \n", sh1, sh2)
-	}
-	sha1 := plumbing.NewHash(expandSHA(sh1))
-	sha2 := plumbing.NewHash(expandSHA(sh2))
-	repo := openRepo()
-	commit1, err := repo.CommitObject(sha1)
-	if err != nil {
-		panic(err)
-	}
-
-	commit2, err := repo.CommitObject(sha2)
-	if err != nil {
-		panic(err)
-	}
-
-	patch, err := commit1.Patch(commit2)
-	if err != nil {
-		panic(err)
-	}
-
-	paths := make(map[string]struct{})
-	fpatches := patch.FilePatches()
-	for _, fpatch := range fpatches {
-		from, to := fpatch.Files()
-		if from != nil {
-			paths[from.Path()] = struct{}{}
-		}
-		if to != nil {
-			paths[to.Path()] = struct{}{}
-		}
-	}
-
-	return getSortedKeys(paths)
-}
-
-func changedDirs(sh1, sh2 string) []string {
-	if Verbose {
-		fmt.Printf("changedDirs from %s to %s \n", sh1, sh2)
-	}
-	sha1 := plumbing.NewHash(expandSHA(sh1))
-	sha2 := plumbing.NewHash(expandSHA(sh2))
-	repo := openRepo()
-	commit1, err := repo.CommitObject(sha1)
-	if err != nil {
-		panic(err)
-	}
-
-	commit2, err := repo.CommitObject(sha2)
-	if err != nil {
-		panic(err)
-	}
-
-	patch, err := commit1.Patch(commit2)
-	if err != nil {
-		panic(err)
-	}
-
-	paths := make(map[string]struct{})
-	fpatches := patch.FilePatches()
-	for _, fpatch := range fpatches {
-		from, to := fpatch.Files()
-		if from != nil {
-			paths[filepath.Dir(from.Path())] = struct{}{}
-		}
-		if to != nil {
-			paths[filepath.Dir(to.Path())] = struct{}{}
-		}
-	}
-
-	return getSortedKeys(paths)
-}
-
-func listBranches() {
-	repo := openRepo()
-	branches, _ := repo.Branches()
-	branch, _ := branches.Next()
-
-	var err error
-	for branch != nil && err == nil {
-		fmt.Printf("%v \n", branch.Name())
-		branch, err = branches.Next()
-	}
-}
-
-func listReferences() {
-	repo := openRepo()
-	refs, _ := repo.References()
-	ref, _ := refs.Next()
-
-	var err error
-	for ref != nil && err == nil {
-		fmt.Printf("%v - %v \n", ref.Name(), ref.Hash())
-		ref, err = refs.Next()
-	}
-}
-
-func getBranches() (branches map[string]string) {
-	repo := openRepo()
-	bs, _ := repo.Branches()
-	branch, err := bs.Next()
-	branches = make(map[string]string)
-
-	for branch != nil && err == nil {
-		branches[strings.TrimPrefix(branch.Name().String(), "refs/heads/")] = branch.Hash().String()
-		branch, err = bs.Next()
-	}
-
-	return
-}
-
-func getTags() (tags map[string]string) {
-	repo := openRepo()
-	ts, _ := repo.Tags()
-	tag, err := ts.Next()
-	tags = make(map[string]string)
-
-	for tag != nil && err == nil {
-		tagName := strings.TrimPrefix(tag.Name().String(), "refs/tags/")
-		tagObj, err := repo.TagObject(tag.Hash())
-		if err == nil {
-			// That is an annotated tag, extract Hash of destination
-			tags[tagName] = tagObj.Target.String()
-		} else {
-			// lightweight tag
-			tags[tagName] = tag.Hash().String()
-		}
-		tag, err = ts.Next()
-	}
-
-	return
-}
-
-func listObjects() {
-	repo := openRepo()
-	objs, _ := repo.Objects()
-	obj, _ := objs.Next()
-
-	var err error
-	for obj != nil && err == nil {
-		obj, err = objs.Next()
-	}
-}
-
-func commitInfo(commit *object.Commit) {
-	fmt.Printf("%v [%v] - %v \n", commit.Hash, commit.NumParents(), commit.Message)
-	fmt.Printf("   TREEHASH: %v \n", commit.TreeHash)
-
-	for _, phash := range commit.ParentHashes {
-		fmt.Printf("     PH: %v \n", phash)
-	}
-
-	fmt.Println()
-}
-
-func listCommits() {
-	var err error
-	repo := openRepo()
-	commits, err := repo.CommitObjects()
-	if err != nil {
-		panic(err)
-	}
-	commit, err := commits.Next()
-	if err != nil {
-		panic(err)
-	}
-
-	for commit != nil && err == nil {
-		commitInfo(commit)
-		commit, err = commits.Next()
-	}
-}
-
-func expandSHA(givenSHA string) (realSHA string) {
-	if strings.HasPrefix(givenSHA, "HEAD") {
-		return translateHead(givenSHA)
-	}
-
-	branches := getBranches()
-	if branches[givenSHA] != "" {
-		if Verbose {
-			fmt.Printf(" Found branch %v with hash %v \n", givenSHA, branches[givenSHA])
-		}
-		return branches[givenSHA]
-	}
-
-	tags := getTags()
-	if tags[givenSHA] != "" {
-		if Verbose {
-			fmt.Printf(" Found tag %v with hash %v \n", givenSHA, tags[givenSHA])
-		}
-		return tags[givenSHA]
-	}
-
-	switch {
-	case len(givenSHA) == 40:
-		return givenSHA
-	case len(givenSHA) > 40:
-		errTxt := fmt.Sprintf("Error, the given SHA (%v), is longer than 40 (length is %v)\n", givenSHA, len(givenSHA))
-		panic(errors.New(errTxt))
-	default:
-		return getFullSHA(givenSHA)
+// Returns the git repo of the working directory, opening it the first time
+func getRepo() *repo.Repo {
+	if currentRepo != nil {
+		return currentRepo
 	}
+	dir, err := os.Getwd()
+	exitOnError(err)
+	currentRepo, err = repo.Open(context.Background(), dir, cliLogger{})
+	exitOnError(err)
+	return currentRepo
 }
 
-func getFullSHA(shortSHA string) (fullSHA string) {
-	repo := openRepo()
-	commitIter, err := repo.CommitObjects()
-	if err != nil {
-		panic(err)
-	}
-
-	var results []string
-	err = commitIter.ForEach(func(commit *object.Commit) error {
-		if strings.HasPrefix(commit.Hash.String(), shortSHA) {
-			results = append(results, commit.Hash.String())
-		}
-		return nil
-	})
-	if err != nil {
-		panic(err)
-	}
-
-	switch n := len(results); n {
-	case 0:
-		errTxt := fmt.Sprintf("No SHA/branch/tag found like %q", shortSHA)
-		panic(errors.New(errTxt))
-	case 1:
-		fullSHA = results[0]
-	default:
-		errTxt := fmt.Sprintf("short SHA %s is ambiguous, %d matching SHAs found", shortSHA, n)
-		panic(errors.New(errTxt))
-	}
-
-	return
-}
-
-func openRepo() *git.Repository {
-	startDir, err := os.Getwd()
-	if err != nil {
-		panic(err)
-	}
-
-	// Keep looking for a git repo in the parent dir
-	repo, err := git.PlainOpen(startDir)
-	for err != nil && err.Error() == "repository not exists" {
-		var prevDir string
-		startDir, prevDir = filepath.Join(startDir, ".."), startDir
-		if startDir == prevDir {
-			panic(errors.New("Can't find git repo in current dir or any of its  parents"))
-		}
-		repo, err = git.PlainOpen(startDir)
-	}
-	gitPath = startDir
-
-	return repo
+func getRepoPath() string {
+	return getRepo().Path
 }
 
-func stripFilenames(fullPaths []string) []string {
-	dirNames := make(map[string]struct{})
-	for _, fullPath := range fullPaths {
-		dirName := filepath.Dir(fullPath)
-		dirNames[dirName] = struct{}{}
-	}
-	return getSortedKeys(dirNames)
+func changedPaths(sha1, sha2 string) []string {
+	paths, err := getRepo().ChangedFiles(context.Background(), repo.Range{From: sha1, To: sha2})
+	exitOnError(err)
+	return paths
 }
 
-func headExtractN(headTag string) (n int) {
-	if strings.Compare(headTag, "HEAD") == 0 {
-		return 0
-	}
-	if !strings.HasPrefix(headTag, "HEAD~") {
-		errStr := fmt.Sprintf("%s git ref should start with HEAD~", headTag)
-		panic(errors.New(errStr))
-	}
-	res := strings.Trim(headTag, "HEAD~")
-
-	n, err := strconv.Atoi(res)
-	if err != nil {
-		panic(err)
-	}
-	return n
+// Returns the full SHA of a SHA, short SHA, branch, tag or HEAD~X
+func expandSHA(givenSHA string) string {
+	sha, err := getRepo().Resolve(context.Background(), givenSHA)
+	exitOnError(err)
+	return sha
 }
 
-func translateHead(headTag string) (sha string) {
-	var err error
-	repo := openRepo()
-	headRef, err := repo.Head()
-	if err != nil {
-		panic(err)
-	}
-	commit, err := repo.CommitObject(headRef.Hash())
-
-	for i := 0; i < headExtractN(headTag); i++ {
-		commit, err = repo.CommitObject(commit.ParentHashes[0])
-		if Verbose {
-			fmt.Printf(" %s  \n", commit.Hash.String())
-		}
-		if err != nil {
-			panic(err)
-		}
-	}
-
-	sha = commit.Hash.String()
-
-	if Verbose {
-		fmt.Printf(" %s translated to %s \n", headTag, sha)
-	}
-
-	return sha
+// Returns a graph.FileSource for the tree of the given SHA/branch/tag/HEAD~X
+func newTreeSource(sha string) *repo.TreeSource {
+	src, err := getRepo().Tree(context.Background(), sha)
+	exitOnError(err)
+	return src
 }
 
 func extractDirNames(fullPaths []string) []string {
@@ -363,7 +76,7 @@ func extractDirNames(fullPaths []string) []string {
 		dirName := filepath.Dir(fullPath)
 		dirNames[dirName] = struct{}{}
 	}
-	return getSortedKeys(dirNames)
+	return graph.GetSortedKeys(dirNames)
 }
 
 func changedRootFolders(sha1, sha2 string) (rootFolders []string) {
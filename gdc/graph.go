@@ -0,0 +1,48 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2017 RightScale, Inc, All Rights Reserved Worldwide.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/rightscale/ci/gdc/graph"
+)
+
+// Returns the repo graph of the working directory
+func getRepoGraph() *graph.Graph {
+	src, err := graph.NewDirSource(getRepoPath())
+	if err != nil {
+		fmt.Printf("ERROR! Cannot list repo files: %v\n", err)
+		os.Exit(1)
+	}
+	return buildGraph(src, getCurrentRelativePath())
+}
+
+// Builds the graph of src, see graph.Build
+func buildGraph(src graph.FileSource, projectDir string) *graph.Graph {
+	g, err := graph.Build(context.Background(), src, projectDir, graph.Options{Logger: cliLogger{}})
+	exitOnError(err)
+	return g
+}
@@ -0,0 +1,125 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2017 RightScale, Inc, All Rights Reserved Worldwide.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package graph
+
+import (
+	"path"
+	"strings"
+)
+
+// Returns the packages directly changed by a list of changed files. Root
+// files and global inputs change every package, extra inputs of a target
+// change the packages of the target
+func (g *Graph) ChangedPackages(changed []string, ic Inputs) []string {
+	res := make(map[string]struct{})
+	all := func() {
+		for dir := range g.Packages {
+			res[dir] = struct{}{}
+		}
+	}
+
+	for _, file := range changed {
+		if IsRootFile(file) {
+			all()
+			break
+		}
+		if IsVendored(path.Dir(file)) {
+			// Only the importers of a vendored package are changed
+			if vendorDir := g.OwningVendorPackage(file); vendorDir != "" {
+				for _, dir := range g.VendorImporters(vendorDir) {
+					res[dir] = struct{}{}
+				}
+			}
+		} else if dir := path.Dir(file); g.Packages[dir] != nil && strings.HasSuffix(file, ".go") {
+			// Go files count even when removed, or left out by build constraints.
+			// Other files of the directory only count as embedded or native files
+			res[dir] = struct{}{}
+		}
+		// Embedded and included files may live out of the package directory
+		for _, dir := range g.InputOwners(file) {
+			res[dir] = struct{}{}
+		}
+		// A .proto file changes the Go packages generated from it or from its importers
+		for _, dir := range g.ProtoChangedPackages(file) {
+			res[dir] = struct{}{}
+		}
+		for _, pattern := range ic.Global {
+			if file == pattern || MatchesInput(pattern, file) {
+				all()
+			}
+		}
+		for target, patterns := range ic.Targets {
+			for _, pattern := range patterns {
+				if file == pattern || MatchesInput(pattern, file) {
+					for _, dir := range g.TargetPackages(target) {
+						res[dir] = struct{}{}
+					}
+				}
+			}
+		}
+	}
+
+	return GetSortedKeys(res)
+}
+
+// Returns the packages affected by a list of changed files: the changed
+// packages and everything importing them, directly or not
+func (g *Graph) AffectedPackages(changed []string, ic Inputs) []string {
+	rev := g.Importers()
+	seen := make(map[string]struct{})
+	queue := g.ChangedPackages(changed, ic)
+	for len(queue) > 0 {
+		dir := queue[0]
+		queue = queue[1:]
+		if _, ok := seen[dir]; ok {
+			continue
+		}
+		seen[dir] = struct{}{}
+		queue = append(queue, rev[dir]...)
+	}
+
+	return GetSortedKeys(seen)
+}
+
+// Returns the packages whose tests are affected by a list of changed files:
+// the affected packages and the packages whose tests import one of them
+func (g *Graph) AffectedTestPackages(changed []string, ic Inputs) []string {
+	return g.WithTestImporters(g.AffectedPackages(changed, ic))
+}
+
+// Returns the affected packages and the packages whose tests import one of them
+func (g *Graph) WithTestImporters(affected []string) []string {
+	res := make(map[string]struct{})
+	for _, dir := range affected {
+		res[dir] = struct{}{}
+	}
+	for dir, node := range g.Packages {
+		for _, imp := range node.TestImports {
+			if Contains(affected, imp) {
+				res[dir] = struct{}{}
+				break
+			}
+		}
+	}
+	return GetSortedKeys(res)
+}
@@ -0,0 +1,69 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2017 RightScale, Inc, All Rights Reserved Worldwide.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package graph
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestAffectedPackages(t *testing.T) {
+	g := mustBuild(t, testRepo, "github.com/org/repo")
+	ic := Inputs{Targets: map[string][]string{"other": {"config/*.yml"}}}
+
+	cases := []struct {
+		changed  []string
+		expected []string
+	}{
+		{[]string{"lib/b/b.go"}, []string{"lib/a", "lib/b", "svc"}},
+		// Files of a package directory it isn't built from change nothing
+		{[]string{"lib/a/data.json", "lib/a/README.md"}, []string{}},
+		{[]string{"lib/a/removed.go"}, []string{"lib/a", "svc"}},
+		// Test imports are not followed
+		{[]string{"lib/testutil/util.go"}, []string{"lib/testutil"}},
+		{[]string{"svc/sub/sub.go"}, []string{"svc/sub"}},
+		{[]string{"config/app.yml"}, []string{"other"}},
+		{[]string{"config/other.txt", "vendor/x/y/y.go"}, []string{}},
+		{[]string{"glide.yaml"}, []string{"lib/a", "lib/b", "lib/c", "lib/testutil", "other", "svc", "svc/sub"}},
+	}
+	for _, c := range cases {
+		res := g.AffectedPackages(c.changed, ic)
+		if !reflect.DeepEqual(res, c.expected) {
+			t.Error("packages affected by", c.changed, "should be", c.expected, "but got", res)
+		}
+	}
+}
+
+func TestAffectedTestPackages(t *testing.T) {
+	g := mustBuild(t, testRepo, "github.com/org/repo")
+	res := g.AffectedTestPackages([]string{"lib/c/c.go"}, Inputs{})
+	expected := []string{"lib/a", "lib/c", "other"}
+	if !reflect.DeepEqual(res, expected) {
+		t.Error("packages with affected tests should be", expected, "but got", res)
+	}
+	res = g.AffectedTestPackages([]string{"lib/testutil/util.go"}, Inputs{})
+	expected = []string{"lib/testutil", "svc"}
+	if !reflect.DeepEqual(res, expected) {
+		t.Error("packages with affected tests should be", expected, "but got", res)
+	}
+}
@@ -0,0 +1,270 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2017 RightScale, Inc, All Rights Reserved Worldwide.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package graph
+
+import (
+	"context"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// FileSet is the file list of a repo, with the lookups analyzers share
+type FileSet struct {
+	FileSource
+	Logger   Logger // where analyzers report what they cannot read
+	files    []string
+	exists   map[string]bool
+	dirFiles map[string][]string // files directly in a directory
+}
+
+// Returns the file set of src
+func NewFileSet(src FileSource) *FileSet {
+	fs := &FileSet{FileSource: src, Logger: nopLogger{}, files: src.Files(), exists: make(map[string]bool), dirFiles: make(map[string][]string)}
+	for _, file := range fs.files {
+		fs.exists[file] = true
+		dir := path.Dir(file)
+		fs.dirFiles[dir] = append(fs.dirFiles[dir], file)
+	}
+	return fs
+}
+
+// Whether file is in the set
+func (fs *FileSet) Exists(file string) bool {
+	return fs.exists[file]
+}
+
+// Returns the files directly in dir
+func (fs *FileSet) DirFiles(dir string) []string {
+	return fs.dirFiles[dir]
+}
+
+// Node is a unit of the repo known to an analyzer: a Go package, a
+// .proto file, an npm package, a Python module, a shell script...
+type Node struct {
+	ID    string   `json:"id"`
+	Kind  string   `json:"kind"`
+	Path  string   `json:"path"`  // directory of a package, file of a module or a script
+	Files []string `json:"files"` // repo files the node is made of
+}
+
+// Edge is a dependency of a node on another one, declared in File at
+// Line (0 if unknown)
+type Edge struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+	Test bool   `json:"test"` // only needed by tests
+	File string `json:"file"`
+	Line int    `json:"line"`
+}
+
+// Analyzer finds the nodes of one ecosystem in a file set, and their dependencies
+type Analyzer interface {
+	Analyze(fs *FileSet) ([]*Node, []Edge)
+}
+
+// Kinds of nodes
+const (
+	GoKind     = "go"
+	ProtoKind  = "proto"
+	NpmKind    = "npm"
+	PythonKind = "python"
+	ShellKind  = "shell"
+)
+
+// Returns the ID of the node of kind at a repo path
+func NodeID(kind, p string) string {
+	return kind + ":" + p
+}
+
+func NewNode(kind, p string, files []string) *Node {
+	return &Node{ID: NodeID(kind, p), Kind: kind, Path: p, Files: files}
+}
+
+// Whether a repo directory is skipped by the analyzers of other ecosystems
+// than Go: the ones Go skips and the installed dependencies
+func ignoredAnalyzerDir(dir string) bool {
+	if ignoredPackageDir(dir) {
+		return true
+	}
+	for _, elem := range strings.Split(dir, "/") {
+		switch elem {
+		case "node_modules", "site-packages", "venv", "__pycache__":
+			return true
+		}
+	}
+	return false
+}
+
+// Runs the analyzers in order and merges their nodes and edges into the
+// graph. Edges to nodes no analyzer found are dropped
+func (g *Graph) analyze(ctx context.Context, fs *FileSet, analyzers []Analyzer) error {
+	g.Nodes = make(map[string]*Node)
+	g.fileNodes = make(map[string][]string)
+	var edges []Edge
+	for _, a := range analyzers {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		nodes, found := a.Analyze(fs)
+		for _, node := range nodes {
+			g.Nodes[node.ID] = node
+		}
+		edges = append(edges, found...)
+	}
+	for _, e := range edges {
+		if g.Nodes[e.From] != nil && g.Nodes[e.To] != nil && e.From != e.To {
+			g.Edges = append(g.Edges, e)
+		}
+	}
+	sort.SliceStable(g.Edges, func(i, j int) bool {
+		a, b := g.Edges[i], g.Edges[j]
+		if a.From != b.From {
+			return a.From < b.From
+		}
+		if a.To != b.To {
+			return a.To < b.To
+		}
+		return a.File < b.File || a.File == b.File && a.Line < b.Line
+	})
+	for _, id := range g.NodeIDs() {
+		for _, file := range g.Nodes[id].Files {
+			g.fileNodes[file] = append(g.fileNodes[file], id)
+		}
+	}
+	return nil
+}
+
+// Returns the IDs of every node, sorted
+func (g *Graph) NodeIDs() []string {
+	ids := make([]string, 0, len(g.Nodes))
+	for id := range g.Nodes {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// Returns the IDs of the nodes made of file, sorted
+func (g *Graph) NodesOf(file string) []string {
+	return g.fileNodes[file]
+}
+
+// Returns the nodes at target or below
+func (g *Graph) TargetNodes(target string) []string {
+	target = path.Clean(filepath.ToSlash(target))
+	var res []string
+	for _, id := range g.NodeIDs() {
+		p := g.Nodes[id].Path
+		if target == "." || p == target || strings.HasPrefix(p, target+"/") {
+			res = append(res, id)
+		}
+	}
+	return res
+}
+
+// Returns the nodes reachable from ids through edges, ids included. Like
+// TransitiveImports, test edges are only followed from the starting nodes
+func (g *Graph) DependencyNodes(ids []string, withTests bool) []string {
+	deps := make(map[string][]Edge)
+	for _, e := range g.Edges {
+		deps[e.From] = append(deps[e.From], e)
+	}
+	seen := make(map[string]struct{})
+	queue := append([]string{}, ids...)
+	for _, id := range ids {
+		seen[id] = struct{}{}
+	}
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		for _, e := range deps[id] {
+			if _, ok := seen[e.To]; ok || e.Test && !(withTests && Contains(ids, id)) {
+				continue
+			}
+			seen[e.To] = struct{}{}
+			queue = append(queue, e.To)
+		}
+	}
+	return GetSortedKeys(seen)
+}
+
+// Returns the nodes made of one of the changed files and the nodes depending
+// on them, directly or not, the tests of a node depending on it directly only
+func (g *Graph) AffectedNodes(changed []string) []string {
+	rev := make(map[string][]Edge)
+	for _, e := range g.Edges {
+		rev[e.To] = append(rev[e.To], e)
+	}
+	seen := make(map[string]struct{})
+	var queue []string
+	for _, file := range changed {
+		for _, id := range g.fileNodes[file] {
+			if _, ok := seen[id]; !ok {
+				seen[id] = struct{}{}
+				queue = append(queue, id)
+			}
+		}
+	}
+	var tests []string
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		for _, e := range rev[id] {
+			if e.Test {
+				tests = append(tests, e.From)
+			} else if _, ok := seen[e.From]; !ok {
+				seen[e.From] = struct{}{}
+				queue = append(queue, e.From)
+			}
+		}
+	}
+	for _, id := range tests {
+		seen[id] = struct{}{}
+	}
+	return GetSortedKeys(seen)
+}
+
+// Returns the files of the nodes target depends on that Go doesn't know
+// about: the .proto files, the scripts it sources, the npm packages and the
+// Python modules it uses...
+func (g *Graph) AnalyzedInputs(target string) []string {
+	var res []string
+	for _, id := range g.DependencyNodes(g.TargetNodes(target), true) {
+		if node := g.Nodes[id]; node.Kind != GoKind {
+			res = append(res, node.Files...)
+		}
+	}
+	return UniqueSorted(res)
+}
+
+// Returns the directory of a node: its path for packages, the directory of
+// its file otherwise
+func (n *Node) Dir() string {
+	switch n.Kind {
+	case GoKind, NpmKind:
+		return n.Path
+	}
+	return path.Dir(n.Path)
+}
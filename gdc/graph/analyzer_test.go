@@ -0,0 +1,69 @@
+package graph
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestGoAnalyzer(t *testing.T) {
+	g := mustBuild(t, testRepo, "github.com/org/repo")
+
+	var edges []Edge
+	for _, e := range g.Edges {
+		if e.From == "go:svc" || e.From == "go:lib/a" {
+			edges = append(edges, e)
+		}
+	}
+	expected := []Edge{
+		{From: "go:lib/a", To: "go:lib/b", File: "lib/a/a.go", Line: 2},
+		{From: "go:lib/a", To: "go:lib/c", Test: true, File: "lib/a/a_test.go", Line: 2},
+		{From: "go:svc", To: "go:lib/a", File: "svc/main.go", Line: 4},
+		{From: "go:svc", To: "go:lib/testutil", Test: true, File: "svc/main_test.go", Line: 2},
+	}
+	if !reflect.DeepEqual(edges, expected) {
+		t.Errorf("Go edges should be\n%+v\nbut got\n%+v", expected, edges)
+	}
+	if node := g.Nodes["go:lib/a"]; node == nil || !reflect.DeepEqual(node.Files, []string{"lib/a/a.go", "lib/a/a_test.go"}) {
+		t.Error("unexpected node of lib/a:", node)
+	}
+	if g.Nodes["go:vendor/x/y"] != nil {
+		t.Error("vendored packages should not be nodes")
+	}
+}
+
+func TestAnalyzedInputs(t *testing.T) {
+	repo := MapSource{
+		"docker-shared.sh":          "#!/bin/bash\n# Not an executable\n",
+		"svc/build.sh":              "#!/bin/bash\nsource \"$(dirname \"$0\")/../docker-shared.sh\"\n",
+		"svc/main.go":               "package main\n\nimport \"github.com/org/repo/gen/api\"\n",
+		"gen/api/api.pb.go":         "// source: api.proto\n\npackage api\n",
+		"proto/api.proto":           "syntax = \"proto3\";\n",
+		"tools/report.py":           "import lib.fmt\n",
+		"tools/lib/__init__.py":     "",
+		"tools/lib/fmt.py":          "",
+		"tools/tests/test_fmt.py":   "from lib import fmt\n",
+		"tools/tests/__init__.py":   "",
+		"frontend/package.json":     "{\"workspaces\": [\"packages/*\"]}",
+		"frontend/packages/ui/a.js": "",
+	}
+	g := mustBuild(t, repo, "github.com/org/repo")
+
+	if res := g.AnalyzedInputs("svc"); !reflect.DeepEqual(res, []string{"docker-shared.sh", "proto/api.proto", "svc/build.sh"}) {
+		t.Error("unexpected analyzed inputs of svc:", res)
+	}
+	if res := g.AnalyzedInputs("tools"); !reflect.DeepEqual(res, []string{"tools/lib/__init__.py", "tools/lib/fmt.py", "tools/report.py", "tools/tests/__init__.py", "tools/tests/test_fmt.py"}) {
+		t.Error("unexpected analyzed inputs of tools:", res)
+	}
+
+	affected := map[string][]string{
+		"docker-shared.sh":          {"shell:docker-shared.sh", "shell:svc/build.sh"},
+		"proto/api.proto":           {"go:gen/api", "go:svc", "proto:proto/api.proto"},
+		"tools/lib/fmt.py":          {"python:tools/lib/fmt.py", "python:tools/report.py", "python:tools/tests/test_fmt.py"},
+		"frontend/packages/ui/a.js": {"npm:frontend"},
+	}
+	for file, expected := range affected {
+		if res := g.AffectedNodes([]string{file}); !reflect.DeepEqual(res, expected) {
+			t.Errorf("nodes affected by %s should be %v but got %v", file, expected, res)
+		}
+	}
+}
@@ -0,0 +1,278 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2017 RightScale, Inc, All Rights Reserved Worldwide.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package graph
+
+import (
+	"bufio"
+	"bytes"
+	"go/ast"
+	"go/token"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Extensions of the non-Go files the go command compiles into a package
+var nativeExtensions = []string{".c", ".cc", ".cpp", ".cxx", ".m", ".h", ".hh", ".hpp", ".hxx", ".s", ".S", ".sx", ".f", ".F", ".for", ".f90", ".syso"}
+
+// Returns the patterns of the //go:embed directives of a file
+func embedPatterns(f *ast.File) []string {
+	var res []string
+	for _, group := range f.Comments {
+		for _, c := range group.List {
+			if !strings.HasPrefix(c.Text, "//go:embed ") {
+				continue
+			}
+			res = append(res, splitQuoted(strings.TrimPrefix(c.Text, "//go:embed "))...)
+		}
+	}
+	return res
+}
+
+// Splits the space separated arguments of a directive, they may be quoted
+func splitQuoted(args string) []string {
+	var res []string
+	for args = strings.TrimSpace(args); args != ""; args = strings.TrimSpace(args) {
+		end := strings.IndexAny(args, " \t")
+		if args[0] == '"' || args[0] == '`' {
+			if quoted, err := strconv.QuotedPrefix(args); err == nil {
+				unquoted, _ := strconv.Unquote(quoted)
+				res = append(res, unquoted)
+				args = args[len(quoted):]
+				continue
+			}
+		}
+		if end < 0 {
+			end = len(args)
+		}
+		res = append(res, args[:end])
+		args = args[end:]
+	}
+	return res
+}
+
+// Returns the files of the repo embedded by patterns of a package in dir. A
+// pattern naming a directory embeds its whole tree, except the files starting
+// with . or _ unless the pattern has the all: prefix. Files of nested modules
+// are never embedded
+func (g *Graph) embeddedFiles(files []string, dir string, patterns []string) []string {
+	prefix := dir + "/"
+	if dir == "." {
+		prefix = ""
+	}
+	module := g.ModuleOfDir(dir)
+	var res []string
+	for _, file := range files {
+		if !strings.HasPrefix(file, prefix) || path.Dir(file) == dir && strings.HasSuffix(file, ".go") {
+			continue
+		}
+		if m := g.ModuleOfDir(path.Dir(file)); m != module {
+			continue
+		}
+		rel := strings.TrimPrefix(file, prefix)
+		for _, pattern := range patterns {
+			if embedMatches(pattern, rel) {
+				res = append(res, file)
+				break
+			}
+		}
+	}
+	return res
+}
+
+// Whether an embed pattern matches a path relative to the package directory,
+// directly or through one of its parent directories
+func embedMatches(pattern, rel string) bool {
+	all := strings.HasPrefix(pattern, "all:")
+	pattern = strings.TrimPrefix(pattern, "all:")
+	if ok, _ := path.Match(pattern, rel); ok {
+		return true
+	}
+	elems := strings.Split(rel, "/")
+	for i := len(elems) - 1; i > 0; i-- {
+		if ok, _ := path.Match(pattern, strings.Join(elems[:i], "/")); !ok {
+			continue
+		}
+		if all {
+			return true
+		}
+		for _, elem := range elems[i:] {
+			if strings.HasPrefix(elem, ".") || strings.HasPrefix(elem, "_") {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// Returns the cgo preamble of a file, "" if it doesn't import "C"
+func cgoPreamble(f *ast.File) string {
+	for _, imp := range f.Imports {
+		if p, _ := strconv.Unquote(imp.Path.Value); p != "C" {
+			continue
+		}
+		var res string
+		if imp.Doc != nil {
+			res += imp.Doc.Text()
+		}
+		if gen := CgoImportDecl(f, imp); gen != nil && gen.Doc != nil && len(gen.Specs) == 1 {
+			res += gen.Doc.Text()
+		}
+		return res
+	}
+	return ""
+}
+
+// Returns the files #included by C code and the -I directories of the #cgo
+// flags of a cgo preamble, as written
+func parseIncludes(text []byte) (includes, includeDirs []string) {
+	scanner := bufio.NewScanner(bytes.NewReader(text))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case strings.HasPrefix(line, "#include") || strings.HasPrefix(line, "#import"):
+			arg := strings.TrimSpace(strings.TrimPrefix(strings.TrimPrefix(line, "#include"), "#import"))
+			if len(arg) > 2 && (arg[0] == '"' && strings.Count(arg, `"`) >= 2 || arg[0] == '<' && strings.Contains(arg, ">")) {
+				end := strings.IndexAny(arg[1:], `">`)
+				includes = append(includes, arg[1:end+1])
+			}
+		case strings.HasPrefix(line, "#cgo "):
+			colon := strings.Index(line, ":")
+			if colon < 0 || !strings.Contains(line[:colon], "FLAGS") {
+				continue
+			}
+			fields := strings.Fields(line[colon+1:])
+			for i, field := range fields {
+				switch {
+				case field == "-I" && i+1 < len(fields):
+					includeDirs = append(includeDirs, fields[i+1])
+				case strings.HasPrefix(field, "-I") && len(field) > 2:
+					includeDirs = append(includeDirs, field[2:])
+				}
+			}
+		}
+	}
+	return
+}
+
+// Returns the native files of a package: the C, assembly and .syso files of
+// its directory and the repo files they or the cgo preambles #include,
+// transitively. Includes are looked up next to the including file, then in
+// the -I directories of the #cgo flags
+func nativeFiles(src FileSource, exists map[string]bool, dir string, dirFiles []string, preambles []string) []string {
+	var queue, includeDirs []string
+	seen := make(map[string]bool)
+	push := func(file string) {
+		if !seen[file] {
+			seen[file] = true
+			queue = append(queue, file)
+		}
+	}
+	for _, file := range dirFiles {
+		for _, ext := range nativeExtensions {
+			if strings.HasSuffix(file, ext) {
+				push(file)
+				break
+			}
+		}
+	}
+	var preambleIncludes []string
+	for _, preamble := range preambles {
+		includes, dirs := parseIncludes([]byte(preamble))
+		preambleIncludes = append(preambleIncludes, includes...)
+		for _, d := range dirs {
+			switch {
+			case strings.HasPrefix(d, "${SRCDIR}"):
+				includeDirs = append(includeDirs, path.Join(dir, strings.TrimPrefix(d, "${SRCDIR}")))
+			case !path.IsAbs(d):
+				includeDirs = append(includeDirs, path.Join(dir, d))
+			}
+		}
+	}
+	resolve := func(from string, include string) {
+		for _, d := range append([]string{from}, includeDirs...) {
+			if file := path.Join(d, include); exists[file] {
+				push(file)
+				return
+			}
+		}
+	}
+	for _, include := range preambleIncludes {
+		resolve(dir, include)
+	}
+
+	for i := 0; i < len(queue); i++ {
+		file := queue[i]
+		if strings.HasSuffix(file, ".syso") {
+			continue
+		}
+		content, err := src.ReadFile(file)
+		if err != nil {
+			continue
+		}
+		includes, _ := parseIncludes(content)
+		for _, include := range includes {
+			resolve(path.Dir(file), include)
+		}
+	}
+	return UniqueSorted(queue)
+}
+
+// Returns the files a package is built from: its Go files, embedded files and
+// native files, with the test ones if withTests is set
+func (n *Package) Inputs(withTests bool) []string {
+	res := append(append(append([]string{}, n.GoFiles...), n.EmbedFiles...), n.NativeFiles...)
+	if withTests {
+		res = append(append(res, n.TestGoFiles...), n.TestEmbedFiles...)
+	}
+	return UniqueSorted(res)
+}
+
+// Returns the packages embedding a file or compiling it as a native file,
+// wherever it lives
+func (g *Graph) InputOwners(file string) []string {
+	var res []string
+	for dir, node := range g.Packages {
+		if Contains(node.EmbedFiles, file) || Contains(node.TestEmbedFiles, file) || Contains(node.NativeFiles, file) {
+			res = append(res, dir)
+		}
+	}
+	sort.Strings(res)
+	return res
+}
+
+// Returns the import declaration holding an import spec
+func CgoImportDecl(f *ast.File, imp *ast.ImportSpec) *ast.GenDecl {
+	for _, decl := range f.Decls {
+		if gen, ok := decl.(*ast.GenDecl); ok && gen.Tok == token.IMPORT {
+			for _, spec := range gen.Specs {
+				if spec == imp {
+					return gen
+				}
+			}
+		}
+	}
+	return nil
+}
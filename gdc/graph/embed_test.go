@@ -0,0 +1,75 @@
+package graph
+
+import (
+	"reflect"
+	"testing"
+)
+
+var embedRepo = MapSource{
+	"web/web.go":               "package web\n\nimport \"embed\"\n\n//go:embed static templates/*.tmpl \"my file.txt\"\nvar files embed.FS\n",
+	"web/web_test.go":          "package web\n\nimport _ \"embed\"\n\n//go:embed testdata/golden.html\nvar golden string\n",
+	"web/README.md":            "",
+	"web/my file.txt":          "",
+	"web/static/app.js":        "",
+	"web/static/.hidden":       "",
+	"web/static/css/app.css":   "",
+	"web/static/css/css.go":    "package css\n",
+	"web/templates/a.tmpl":     "",
+	"web/templates/b.txt":      "",
+	"web/testdata/golden.html": "",
+	"web/sub/go.mod":           "module github.com/org/sub\n",
+	"web/sub/x.txt":            "",
+	"svc/main.go":              "package main\n\nimport \"github.com/org/repo/web\"\n",
+	"native/native.go":         "package native\n\n// #cgo CFLAGS: -I${SRCDIR}/../include\n// #include \"native.h\"\n// #include <common.h>\n// #include <stdio.h>\nimport \"C\"\n",
+	"native/native.h":          "#include \"other.h\"\n",
+	"native/other.h":           "",
+	"native/impl.c":            "#include \"native.h\"\n",
+	"native/lib.syso":          "",
+	"native/notes.txt":         "",
+	"include/common.h":         "",
+	"include/unused.h":         "",
+	"tool/main.go":             "package main\n\nimport \"github.com/org/repo/native\"\n",
+}
+
+func TestSplitQuoted(t *testing.T) {
+	res := splitQuoted(" a/*.txt  \"b c.txt\" `d` all:e")
+	if !reflect.DeepEqual(res, []string{"a/*.txt", "b c.txt", "d", "all:e"}) {
+		t.Error("unexpected patterns:", res)
+	}
+}
+
+func TestEmbedAndNativeFiles(t *testing.T) {
+	g := mustBuild(t, embedRepo, "github.com/org/repo")
+
+	web := g.Packages["web"]
+	expected := []string{"web/my file.txt", "web/static/app.js", "web/static/css/app.css", "web/static/css/css.go", "web/templates/a.tmpl"}
+	if !reflect.DeepEqual(web.EmbedFiles, expected) {
+		t.Error("unexpected embedded files:", web.EmbedFiles)
+	}
+	if !reflect.DeepEqual(web.TestEmbedFiles, []string{"web/testdata/golden.html"}) {
+		t.Error("unexpected embedded test files:", web.TestEmbedFiles)
+	}
+
+	native := g.Packages["native"]
+	expected = []string{"include/common.h", "native/impl.c", "native/lib.syso", "native/native.h", "native/other.h"}
+	if !reflect.DeepEqual(native.NativeFiles, expected) {
+		t.Error("unexpected native files:", native.NativeFiles)
+	}
+
+	affected := map[string][]string{
+		// An embedded file in the directory of another package
+		"web/static/css/app.css": {"svc", "web"},
+		"include/common.h":       {"native", "tool"},
+		"include/unused.h":       {},
+	}
+	for file, expected := range affected {
+		if res := g.AffectedPackages([]string{file}, Inputs{}); !reflect.DeepEqual(res, expected) {
+			t.Errorf("packages affected by %s should be %v but got %v", file, expected, res)
+		}
+	}
+
+	inputs := native.Inputs(false)
+	if Contains(inputs, "native/notes.txt") || !Contains(inputs, "native/native.go") || !Contains(inputs, "include/common.h") {
+		t.Error("unexpected inputs of native:", inputs)
+	}
+}
@@ -0,0 +1,224 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2017 RightScale, Inc, All Rights Reserved Worldwide.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package graph
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// GenerateRule links the inputs of a code generator to the files it writes
+type GenerateRule struct {
+	Inputs  []string `yaml:"inputs"`  // patterns of the files the generator reads
+	Outputs []string `yaml:"outputs"` // patterns of the files it writes
+	Command string   `yaml:"command"` // how to regenerate the outputs, shown by generate-check
+
+	Source string `yaml:"-"` // where the rule comes from: the config or a //go:generate directive
+	// Whether the inputs of the rule are only guessed, they're not checked by generate-check
+	Implicit bool `yaml:"-"`
+}
+
+// Matches the header of generated Go files, see https://golang.org/s/generatedcode
+var generatedHeader = regexp.MustCompile(`^// Code generated .* DO NOT EDIT\.$`)
+
+// Whether a Go file is generated: it has the standard header before its package clause
+func isGeneratedGo(content []byte) bool {
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "package ") {
+			return false
+		}
+		if generatedHeader.MatchString(line) {
+			return true
+		}
+	}
+	return false
+}
+
+// goGenerate is a //go:generate directive
+type goGenerate struct {
+	File, Command string
+	Line          int
+}
+
+// Returns the //go:generate directives of a Go file
+func generateDirectives(file string, content []byte) []goGenerate {
+	var res []goGenerate
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for line := 1; scanner.Scan(); line++ {
+		if text := scanner.Text(); strings.HasPrefix(text, "//go:generate ") {
+			res = append(res, goGenerate{File: file, Command: strings.TrimSpace(strings.TrimPrefix(text, "//go:generate ")), Line: line})
+		}
+	}
+	return res
+}
+
+// Returns the repo files named by the arguments of a directive, like
+// -source=foo.go or api.proto, relative to the directory of its file
+func (d goGenerate) fileArgs(exists map[string]bool) []string {
+	dir := path.Dir(d.File)
+	var res []string
+	for _, arg := range splitQuoted(d.Command) {
+		if i := strings.Index(arg, "="); i >= 0 {
+			arg = arg[i+1:]
+		}
+		for _, value := range strings.Split(arg, ",") {
+			value = strings.Replace(value, "$GOFILE", path.Base(d.File), -1)
+			if file := path.Join(dir, value); value != "" && file != d.File && exists[file] {
+				res = append(res, file)
+			}
+		}
+	}
+	return res
+}
+
+// Returns the generator rules of a repo: the configured ones, coming from
+// .gdc.yml unless their Source says otherwise, then one per
+// //go:generate directive. The inputs of a directive are its file and the
+// files its arguments name, its outputs the generated files its arguments
+// name or, if none, the generated files of its directory no other directive
+// claims
+func GenerateRules(src FileSource, configured []GenerateRule) []GenerateRule {
+	rules := append([]GenerateRule{}, configured...)
+	for i := range rules {
+		if rules[i].Source == "" {
+			rules[i].Source = ".gdc.yml"
+		}
+	}
+
+	exists := make(map[string]bool)
+	generated := make(map[string]struct{})
+	var directives []goGenerate
+	for _, file := range src.Files() {
+		exists[file] = true
+		if !strings.HasSuffix(file, ".go") || ignoredPackageDir(path.Dir(file)) {
+			continue
+		}
+		content, err := src.ReadFile(file)
+		if err != nil {
+			continue
+		}
+		if isGeneratedGo(content) {
+			generated[file] = struct{}{}
+		}
+		directives = append(directives, generateDirectives(file, content)...)
+	}
+
+	claimed := make(map[string]bool)
+	dirRules := make(map[int]string)
+	for _, d := range directives {
+		rule := GenerateRule{Inputs: []string{d.File}, Command: d.Command, Source: fmt.Sprintf("%s:%d", d.File, d.Line), Implicit: true}
+		for _, file := range d.fileArgs(exists) {
+			if _, ok := generated[file]; ok {
+				rule.Outputs = append(rule.Outputs, file)
+				claimed[file] = true
+			} else {
+				rule.Inputs = append(rule.Inputs, file)
+				rule.Implicit = false
+			}
+		}
+		if len(rule.Outputs) == 0 {
+			dirRules[len(rules)] = path.Dir(d.File)
+		}
+		rules = append(rules, rule)
+	}
+	for i, dir := range dirRules {
+		for _, file := range GetSortedKeys(generated) {
+			if path.Dir(file) == dir && !claimed[file] {
+				rules[i].Outputs = append(rules[i].Outputs, file)
+			}
+		}
+	}
+	return rules
+}
+
+// Whether a file matches one of the patterns of a rule
+func matchesAny(patterns []string, file string) bool {
+	for _, pattern := range patterns {
+		if file == pattern || MatchesInput(pattern, file) {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the files of src written by generators whose inputs changed, and
+// not changed themselves: they're changed through their inputs
+func GeneratedByChanges(src FileSource, rules []GenerateRule, changed []string) []string {
+	var res []string
+	for _, rule := range rules {
+		hit := false
+		for _, file := range changed {
+			if matchesAny(rule.Inputs, file) {
+				hit = true
+				break
+			}
+		}
+		if !hit {
+			continue
+		}
+		for _, file := range src.Files() {
+			if matchesAny(rule.Outputs, file) && !Contains(changed, file) {
+				res = append(res, file)
+			}
+		}
+	}
+	return UniqueSorted(res)
+}
+
+// StaleOutputs is a generator whose inputs changed in a range, but not its outputs
+type StaleOutputs struct {
+	Rule   GenerateRule
+	Inputs []string // the changed inputs
+}
+
+// Returns the generators whose inputs changed but whose outputs did not.
+// Directives without explicit input files are not checked, their file
+// changes for other reasons too
+func CheckGenerated(rules []GenerateRule, changed []string) []StaleOutputs {
+	var res []StaleOutputs
+	for _, rule := range rules {
+		if rule.Implicit || len(rule.Outputs) == 0 {
+			continue
+		}
+		var inputs []string
+		outputChanged := false
+		for _, file := range changed {
+			if matchesAny(rule.Inputs, file) {
+				inputs = append(inputs, file)
+			}
+			if matchesAny(rule.Outputs, file) {
+				outputChanged = true
+			}
+		}
+		if len(inputs) > 0 && !outputChanged {
+			res = append(res, StaleOutputs{Rule: rule, Inputs: inputs})
+		}
+	}
+	return res
+}
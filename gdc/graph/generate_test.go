@@ -0,0 +1,84 @@
+package graph
+
+import (
+	"reflect"
+	"testing"
+)
+
+var generateRepo = MapSource{
+	"api/api.proto":         "syntax = \"proto3\";\n",
+	"api/gen.go":            "package api\n\n//go:generate protoc --go_out=. api.proto\n",
+	"api/api.pb.go":         "// Code generated by protoc-gen-go. DO NOT EDIT.\n\npackage api\n",
+	"store/store.go":        "package store\n",
+	"mocks/gen.go":          "package mocks\n\n//go:generate mockgen -source=../store/store.go -destination=store_mock.go\n",
+	"mocks/store_mock.go":   "// Code generated by MockGen. DO NOT EDIT.\n// Source: ../store/store.go\n\npackage mocks\n",
+	"color/color.go":        "package color\n\n//go:generate stringer -type=Color\ntype Color int\n",
+	"color/color_string.go": "// Code generated by \"stringer -type=Color\"; DO NOT EDIT.\n\npackage color\n",
+	"schema/user.json":      "{}",
+	"schema/gen/user.go":    "package gen\n",
+	"svc/main.go":           "package main\n\nimport \"github.com/org/repo/schema/gen\"\n",
+}
+
+func TestIsGeneratedGo(t *testing.T) {
+	cases := map[string]bool{
+		"// Code generated by protoc-gen-go. DO NOT EDIT.\n\npackage api\n":       true,
+		"// Package api.\n// Code generated by hand. DO NOT EDIT.\npackage api\n": true,
+		"package api\n\n// Code generated by protoc-gen-go. DO NOT EDIT.\n":       false,
+		"// Code generated by protoc-gen-go. Please edit.\npackage api\n":         false,
+	}
+	for content, expected := range cases {
+		if res := isGeneratedGo([]byte(content)); res != expected {
+			t.Errorf("isGeneratedGo(%q) should be %v", content, expected)
+		}
+	}
+}
+
+func TestGenerateRules(t *testing.T) {
+	configured := []GenerateRule{{Inputs: []string{"schema/*.json"}, Outputs: []string{"schema/gen"}, Command: "make schema"}}
+	rules := GenerateRules(generateRepo, configured)
+	expected := []GenerateRule{
+		{Inputs: []string{"schema/*.json"}, Outputs: []string{"schema/gen"}, Command: "make schema", Source: ".gdc.yml"},
+		{Inputs: []string{"api/gen.go", "api/api.proto"}, Outputs: []string{"api/api.pb.go"}, Command: "protoc --go_out=. api.proto", Source: "api/gen.go:3"},
+		{Inputs: []string{"color/color.go"}, Outputs: []string{"color/color_string.go"}, Command: "stringer -type=Color", Source: "color/color.go:3", Implicit: true},
+		{Inputs: []string{"mocks/gen.go", "store/store.go"}, Outputs: []string{"mocks/store_mock.go"}, Command: "mockgen -source=../store/store.go -destination=store_mock.go", Source: "mocks/gen.go:3"},
+	}
+	if !reflect.DeepEqual(rules, expected) {
+		t.Errorf("rules should be\n%+v\nbut got\n%+v", expected, rules)
+	}
+
+	cases := map[string][]string{
+		"api/api.proto":    {"api/api.pb.go"},
+		"store/store.go":   {"mocks/store_mock.go"},
+		"color/color.go":   {"color/color_string.go"},
+		"schema/user.json": {"schema/gen/user.go"},
+		"svc/main.go":      {},
+	}
+	for file, expected := range cases {
+		if res := GeneratedByChanges(generateRepo, rules, []string{file}); !reflect.DeepEqual(res, expected) {
+			t.Errorf("files generated from %s should be %v but got %v", file, expected, res)
+		}
+	}
+}
+
+func TestCheckGenerated(t *testing.T) {
+	rules := GenerateRules(generateRepo, []GenerateRule{{Inputs: []string{"schema/*.json"}, Outputs: []string{"schema/gen"}}})
+	cases := []struct {
+		changed []string
+		stale   []string // sources of the stale rules
+	}{
+		{[]string{"api/api.proto"}, []string{"api/gen.go:3"}},
+		{[]string{"api/api.proto", "api/api.pb.go"}, nil},
+		{[]string{"schema/user.json", "store/store.go"}, []string{".gdc.yml", "mocks/gen.go:3"}},
+		// stringer does not name its input, its directive file changes for other reasons too
+		{[]string{"color/color.go"}, nil},
+	}
+	for _, c := range cases {
+		var sources []string
+		for _, s := range CheckGenerated(rules, c.changed) {
+			sources = append(sources, s.Rule.Source)
+		}
+		if !reflect.DeepEqual(sources, c.stale) {
+			t.Errorf("stale generators for %v should be %v but got %v", c.changed, c.stale, sources)
+		}
+	}
+}
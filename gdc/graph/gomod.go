@@ -0,0 +1,231 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2017 RightScale, Inc, All Rights Reserved Worldwide.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package graph
+
+import (
+	"bytes"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"golang.org/x/mod/modfile"
+)
+
+// Parses a go.mod file of src, nil if it does not exist
+func parseGoMod(src FileSource, file string) (*modfile.File, error) {
+	content, err := src.ReadFile(file)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return modfile.Parse(file, content, nil)
+}
+
+// goModDiff is what changed between two versions of a go.mod file
+type goModDiff struct {
+	Modules  []string // required or replaced modules whose version or replacement changed
+	Required []string // every module required by either version, to find the module of an import
+	Global   bool     // the go or toolchain directive changed, or the file appeared or disappeared
+}
+
+// Compares two versions of a go.mod file
+func diffGoMod(a, b *modfile.File) goModDiff {
+	var d goModDiff
+	if a == nil || b == nil {
+		d.Global = a != b
+		return d
+	}
+	if goVersion(a) != goVersion(b) || toolchain(a) != toolchain(b) {
+		d.Global = true
+	}
+
+	changed := make(map[string]struct{})
+	required := make(map[string]struct{})
+	versions := func(f *modfile.File) map[string]string {
+		res := make(map[string]string)
+		for _, r := range f.Require {
+			res[r.Mod.Path] = r.Mod.Version
+			required[r.Mod.Path] = struct{}{}
+		}
+		return res
+	}
+	replaces := func(f *modfile.File) map[string]string {
+		res := make(map[string]string)
+		for _, r := range f.Replace {
+			res[r.Old.Path+"@"+r.Old.Version] = r.New.Path + "@" + r.New.Version
+			required[r.Old.Path] = struct{}{}
+		}
+		return res
+	}
+	diffMaps := func(x, y map[string]string) {
+		for k, v := range x {
+			if w, ok := y[k]; !ok || v != w {
+				changed[strings.SplitN(k, "@", 2)[0]] = struct{}{}
+			}
+		}
+		for k := range y {
+			if _, ok := x[k]; !ok {
+				changed[strings.SplitN(k, "@", 2)[0]] = struct{}{}
+			}
+		}
+	}
+	diffMaps(versions(a), versions(b))
+	diffMaps(replaces(a), replaces(b))
+
+	d.Modules = GetSortedKeys(changed)
+	d.Required = GetSortedKeys(required)
+	return d
+}
+
+func goVersion(f *modfile.File) string {
+	if f.Go == nil {
+		return ""
+	}
+	return f.Go.Version
+}
+
+func toolchain(f *modfile.File) string {
+	if f.Toolchain == nil {
+		return ""
+	}
+	return f.Toolchain.Name
+}
+
+// Returns the module of an import path among a list of modules, the longest
+// module path wins since modules can be nested
+func moduleOf(importPath string, modules []string) string {
+	best := ""
+	for _, m := range modules {
+		if (importPath == m || strings.HasPrefix(importPath, m+"/")) && len(m) > len(best) {
+			best = m
+		}
+	}
+	return best
+}
+
+// Returns the Go files importing a package of one of the changed modules: the
+// non-test files of the packages importing it, or their test files when only
+// tests import it. Only the packages of the module of modDir are looked at, or
+// the whole workspace when it's part of it since they share requirements
+func (g *Graph) moduleImporters(modDir string, d goModDiff) []string {
+	changed := make(map[string]bool)
+	for _, m := range d.Modules {
+		changed[m] = true
+	}
+	imports := func(list []string) bool {
+		for _, imp := range list {
+			if changed[moduleOf(imp, d.Required)] {
+				return true
+			}
+		}
+		return false
+	}
+	inScope := func(dir string) bool {
+		m := g.ModuleOfDir(dir)
+		if m == nil {
+			return modDir == "."
+		}
+		return m.Dir == modDir || Contains(g.Workspace, modDir) && Contains(g.Workspace, m.Dir)
+	}
+
+	var files []string
+	for dir, node := range g.Packages {
+		if !inScope(dir) {
+			continue
+		}
+		switch {
+		case imports(node.ExternalImports):
+			files = append(files, node.GoFiles...)
+		case imports(node.TestExternalImports):
+			files = append(files, node.TestGoFiles...)
+		}
+	}
+	sort.Strings(files)
+	return files
+}
+
+// Replaces the go.mod and go.sum files in a list of changed files by the Go
+// files importing the modules whose requirement or replacement changed. A
+// changed go or toolchain directive changes every package of the module, the
+// root go.mod is then kept as a change of a root file, affecting everything
+func (g *Graph) ResolveGoModChanges(srcA, srcB FileSource, changed []string) []string {
+	if !GoModChanged(changed) {
+		return changed
+	}
+	var res, modDirs []string
+	for _, file := range changed {
+		switch {
+		case !isModuleFile(file):
+			res = append(res, file)
+		case path.Base(file) == "go.mod":
+			modDirs = append(modDirs, path.Dir(file))
+		}
+	}
+
+	for _, dir := range modDirs {
+		file := path.Join(dir, "go.mod")
+		a, errA := parseGoMod(srcA, file)
+		b, errB := parseGoMod(srcB, file)
+		var d goModDiff
+		if errA != nil || errB != nil {
+			g.Logger().Printf("WARNING! Cannot parse %s, considering the whole module affected: %v %v\n", file, errA, errB)
+			d.Global = true
+		} else {
+			d = diffGoMod(a, b)
+		}
+		switch {
+		case d.Global && dir == ".":
+			res = append(res, file)
+		case d.Global:
+			for _, pkg := range g.TargetPackages(dir) {
+				res = append(res, g.Packages[pkg].GoFiles...)
+				res = append(res, g.Packages[pkg].TestGoFiles...)
+			}
+		default:
+			g.Logger().Printf("Modules changed in %s: %v\n", file, d.Modules)
+			res = append(res, g.moduleImporters(dir, d)...)
+		}
+	}
+	return UniqueSorted(res)
+}
+
+// Whether a file is the same in both sources. Files importing a changed module
+// are reported changed without being so, they change as a whole package
+func SameContent(srcA, srcB FileSource, file string) bool {
+	a, errA := srcA.ReadFile(file)
+	b, errB := srcB.ReadFile(file)
+	return errA == nil && errB == nil && bytes.Equal(a, b)
+}
+
+// Whether the go.mod or go.sum of a module are among the changed files
+func GoModChanged(changed []string) bool {
+	for _, file := range changed {
+		if isModuleFile(file) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,93 @@
+package graph
+
+import (
+	"reflect"
+	"testing"
+)
+
+var goModRepo = MapSource{
+	"go.mod":          "module github.com/org/repo\n\ngo 1.21\n\nrequire (\n\tgithub.com/x/a v1.0.0\n\tgithub.com/x/a/v2 v2.0.0\n\tgithub.com/y/b v1.0.0\n)\n",
+	"go.sum":          "",
+	"svc/main.go":     "package main\n\nimport (\n\t\"fmt\"\n\n\t\"github.com/x/a/sub\"\n\t\"github.com/org/repo/lib\"\n)\n",
+	"lib/lib.go":      "package lib\n\nimport \"github.com/x/a/v2\"\n",
+	"lib/lib_test.go": "package lib\n\nimport \"github.com/y/b/assert\"\n",
+	"other/other.go":  "package other\n",
+}
+
+func TestDiffGoMod(t *testing.T) {
+	cases := []struct {
+		goMod   string
+		modules []string
+		global  bool
+	}{
+		{"module github.com/org/repo\n\ngo 1.21\n\nrequire (\n\tgithub.com/x/a v1.0.1\n\tgithub.com/x/a/v2 v2.0.0\n\tgithub.com/y/b v1.0.0\n)\n", []string{"github.com/x/a"}, false},
+		{"module github.com/org/repo\n\ngo 1.21\n\nrequire (\n\tgithub.com/x/a v1.0.0\n\tgithub.com/x/a/v2 v2.0.0\n)\n", []string{"github.com/y/b"}, false},
+		{"module github.com/org/repo\n\ngo 1.21\n\nrequire (\n\tgithub.com/x/a v1.0.0\n\tgithub.com/x/a/v2 v2.0.0\n\tgithub.com/y/b v1.0.0\n)\n\nreplace github.com/x/a/v2 => ../a\n", []string{"github.com/x/a/v2"}, false},
+		{"module github.com/org/repo\n\ngo 1.22\n\nrequire (\n\tgithub.com/x/a v1.0.0\n\tgithub.com/x/a/v2 v2.0.0\n\tgithub.com/y/b v1.0.0\n)\n", []string{}, true},
+		{"module github.com/org/repo\n\ngo 1.21\n\ntoolchain go1.22.1\n\nrequire (\n\tgithub.com/x/a v1.0.0\n\tgithub.com/x/a/v2 v2.0.0\n\tgithub.com/y/b v1.0.0\n)\n", []string{}, true},
+	}
+	a, err := parseGoMod(goModRepo, "go.mod")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range cases {
+		after := goModRepo.Copy()
+		after["go.mod"] = c.goMod
+		b, err := parseGoMod(after, "go.mod")
+		if err != nil {
+			t.Fatal(err)
+		}
+		d := diffGoMod(a, b)
+		if !reflect.DeepEqual(d.Modules, c.modules) || d.Global != c.global {
+			t.Errorf("diff with %q should be %v %v but got %v %v", c.goMod, c.modules, c.global, d.Modules, d.Global)
+		}
+	}
+	if d := diffGoMod(a, nil); !d.Global {
+		t.Error("removing go.mod should be a global change")
+	}
+}
+
+func TestModuleOf(t *testing.T) {
+	modules := []string{"github.com/x/a", "github.com/x/a/v2", "github.com/x/ab"}
+	cases := map[string]string{
+		"github.com/x/a":         "github.com/x/a",
+		"github.com/x/a/sub":     "github.com/x/a",
+		"github.com/x/a/v2/sub":  "github.com/x/a/v2",
+		"github.com/x/abc":       "",
+		"github.com/other/thing": "",
+	}
+	for importPath, expected := range cases {
+		if res := moduleOf(importPath, modules); res != expected {
+			t.Errorf("module of %s should be %q but got %q", importPath, expected, res)
+		}
+	}
+}
+
+func TestResolveGoModChanges(t *testing.T) {
+	g := mustBuild(t, goModRepo, "github.com/org/repo")
+	cases := []struct {
+		goMod    string
+		expected []string
+	}{
+		// Only the v1 module changed, imported by svc
+		{"module github.com/org/repo\n\ngo 1.21\n\nrequire (\n\tgithub.com/x/a v1.0.1\n\tgithub.com/x/a/v2 v2.0.0\n\tgithub.com/y/b v1.0.0\n)\n", []string{"README.md", "svc/main.go"}},
+		// Only imported by tests
+		{"module github.com/org/repo\n\ngo 1.21\n\nrequire (\n\tgithub.com/x/a v1.0.0\n\tgithub.com/x/a/v2 v2.0.0\n\tgithub.com/y/b v1.1.0\n)\n", []string{"README.md", "lib/lib_test.go"}},
+		// The go directive changes everything
+		{"module github.com/org/repo\n\ngo 1.22\n\nrequire (\n\tgithub.com/x/a v1.0.0\n\tgithub.com/x/a/v2 v2.0.0\n\tgithub.com/y/b v1.0.0\n)\n", []string{"README.md", "go.mod"}},
+	}
+	for _, c := range cases {
+		after := goModRepo.Copy()
+		after["go.mod"] = c.goMod
+		res := g.ResolveGoModChanges(goModRepo, after, []string{"README.md", "go.mod", "go.sum"})
+		if !reflect.DeepEqual(res, c.expected) {
+			t.Errorf("changes for %q should be %v but got %v", c.goMod, c.expected, res)
+		}
+	}
+
+	// Changes without go.mod are kept as is
+	changed := []string{"lib/lib.go"}
+	if res := g.ResolveGoModChanges(goModRepo, goModRepo, changed); !reflect.DeepEqual(res, changed) {
+		t.Error("changes without go.mod should be kept, got", res)
+	}
+}
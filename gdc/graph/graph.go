@@ -0,0 +1,414 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2017 RightScale, Inc, All Rights Reserved Worldwide.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package graph
+
+import (
+	"bytes"
+	"context"
+	"go/parser"
+	"go/token"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Package is a directory of the repo holding Go files
+type Package struct {
+	Dir         string
+	Module      string   // path of the module holding the package, "" without modules
+	Files       []string // every file directly in Dir
+	GoFiles     []string
+	TestGoFiles []string
+	Imports     []string // in-repo packages imported by GoFiles
+	TestImports []string // in-repo packages imported by TestGoFiles only
+
+	ExternalImports     []string // non standard packages from outside the repo imported by GoFiles
+	TestExternalImports []string // same for TestGoFiles only
+	VendorImports       []string // vendored packages imported by GoFiles, by directory
+	TestVendorImports   []string // same for TestGoFiles only
+
+	EmbedFiles     []string // repo files embedded by GoFiles with //go:embed
+	TestEmbedFiles []string // same for TestGoFiles only
+	NativeFiles    []string // C, assembly and .syso files compiled into the package, with the headers they include
+	ProtoSources   []string // .proto files named by the source header of generated GoFiles, as written
+}
+
+// Graph is the in-repo dependency graph. Go packages are keyed by
+// directory, the nodes of every ecosystem by ID
+type Graph struct {
+	ProjectDir string    // import path of the repo root without go.mod files
+	Modules    []*Module // every go.mod of the repo
+	Workspace  []string  // directories of the modules used by the root go.work
+	Packages   map[string]*Package
+	Vendor     map[string]*Package   // vendored packages, out of the in-repo graph
+	WorkVendor bool                  // whether the workspace is vendored at the root
+	Protos     map[string]*ProtoFile // .proto files, by path
+	RootFiles  []string
+
+	Nodes     map[string]*Node // nodes found by every analyzer, by ID
+	Edges     []Edge
+	fileNodes map[string][]string // IDs of the nodes made of a file
+	log       Logger
+}
+
+// Logger receives the warnings and the details of an analysis, a *log.Logger
+// will do
+type Logger interface {
+	Printf(format string, v ...interface{})
+}
+
+// nopLogger discards every message
+type nopLogger struct{}
+
+func (nopLogger) Printf(format string, v ...interface{}) {}
+
+// Returns the logger of the graph, never nil
+func (g *Graph) Logger() Logger {
+	if g.log == nil {
+		return nopLogger{}
+	}
+	return g.log
+}
+
+// Options tunes the building of a graph
+type Options struct {
+	Logger Logger // nil discards the messages
+	// Analyzers run after the Go and .proto ones, the npm, Python and shell
+	// analyzers when nil
+	Analyzers []Analyzer
+}
+
+// Returns the repo relative directory of an import path, or "" if it's not in the project
+func importToDir(importPath, projectDir string) string {
+	if importPath == projectDir {
+		return "."
+	}
+	if projectDir == "" || !strings.HasPrefix(importPath, projectDir+"/") {
+		return ""
+	}
+	return strings.TrimPrefix(importPath, projectDir+"/")
+}
+
+// Whether an import path is neither in the standard library nor "C"
+func isExternalImport(importPath string) bool {
+	return strings.Contains(strings.SplitN(importPath, "/", 2)[0], ".")
+}
+
+// Whether a repo path is skipped when looking for packages
+func ignoredPackageDir(dir string) bool {
+	for _, elem := range strings.Split(dir, "/") {
+		if elem == "vendor" || elem == "testdata" || strings.HasPrefix(elem, ".") && elem != "." || strings.HasPrefix(elem, "_") {
+			return true
+		}
+	}
+	return false
+}
+
+// Parses every file of src and builds the in-repo dependency graph.
+// projectDir is the import path of the repo root, used without go.mod files
+func Build(ctx context.Context, src FileSource, projectDir string, opts Options) (*Graph, error) {
+	g := &Graph{ProjectDir: projectDir, Packages: make(map[string]*Package), Vendor: make(map[string]*Package), log: opts.Logger}
+	fs := NewFileSet(src)
+	fs.Logger = g.Logger()
+	g.RootFiles = append(g.RootFiles, fs.dirFiles["."]...)
+	analyzers := opts.Analyzers
+	if analyzers == nil {
+		analyzers = []Analyzer{npmAnalyzer{}, pythonAnalyzer{}, shellAnalyzer{}}
+	}
+	if err := g.analyze(ctx, fs, append([]Analyzer{goAnalyzer{g}, protoAnalyzer{g}}, analyzers...)); err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+// goAnalyzer parses the Go files and fills the packages of its graph
+type goAnalyzer struct {
+	g *Graph
+}
+
+func (a goAnalyzer) Analyze(fs *FileSet) ([]*Node, []Edge) {
+	g := a.g
+	g.loadModules(fs)
+	// Vendored packages must be known to resolve imports
+	for dir, list := range fs.dirFiles {
+		if IsVendored(dir) && hasGoFile(list) {
+			g.Vendor[dir] = &Package{Dir: dir, Files: list}
+		}
+	}
+
+	var edges []Edge
+	fset := token.NewFileSet()
+	preambles := make(map[string][]string)
+	for _, file := range fs.files {
+		dir := path.Dir(file)
+		if !strings.HasSuffix(file, ".go") || ignoredPackageDir(dir) && !IsVendored(dir) {
+			continue
+		}
+		node := g.Packages[dir]
+		if IsVendored(dir) {
+			node = g.Vendor[dir]
+		}
+		if node == nil {
+			node = &Package{Dir: dir, Files: fs.dirFiles[dir]}
+			if m := g.ModuleOfDir(dir); m != nil {
+				node.Module = m.Path
+			}
+			g.Packages[dir] = node
+		}
+
+		isTest := strings.HasSuffix(file, "_test.go")
+		if isTest {
+			node.TestGoFiles = append(node.TestGoFiles, file)
+		} else {
+			node.GoFiles = append(node.GoFiles, file)
+		}
+
+		content, err := fs.ReadFile(file)
+		if err != nil {
+			fs.Logger.Printf("WARNING! Cannot read %s: %v\n", file, err)
+			continue
+		}
+		// Embed directives come with declarations, after the imports
+		mode := parser.ImportsOnly | parser.ParseComments
+		if bytes.Contains(content, []byte("//go:embed")) {
+			mode = parser.ParseComments
+		}
+		f, err := parser.ParseFile(fset, file, content, mode)
+		if err != nil {
+			fs.Logger.Printf("Cannot parse %s, skipping it: %v\n", file, err)
+			continue
+		}
+		if patterns := embedPatterns(f); len(patterns) > 0 {
+			if isTest {
+				node.TestEmbedFiles = append(node.TestEmbedFiles, g.embeddedFiles(fs.files, dir, patterns)...)
+			} else {
+				node.EmbedFiles = append(node.EmbedFiles, g.embeddedFiles(fs.files, dir, patterns)...)
+			}
+		}
+		if preamble := cgoPreamble(f); preamble != "" && !isTest {
+			preambles[dir] = append(preambles[dir], preamble)
+		}
+		if source := protoSourceComment(content); source != "" && !isTest {
+			node.ProtoSources = append(node.ProtoSources, source)
+		}
+		for _, spec := range f.Imports {
+			importPath, _ := strconv.Unquote(spec.Path.Value)
+			importDir := g.ResolveImport(importPath, dir)
+			if importDir == "" || IsVendored(importDir) {
+				if isExternalImport(importPath) {
+					if isTest {
+						node.TestExternalImports = append(node.TestExternalImports, importPath)
+					} else {
+						node.ExternalImports = append(node.ExternalImports, importPath)
+					}
+				}
+				if importDir != "" && importDir != dir {
+					if isTest {
+						node.TestVendorImports = append(node.TestVendorImports, importDir)
+					} else {
+						node.VendorImports = append(node.VendorImports, importDir)
+					}
+				}
+				continue
+			}
+			if importDir == dir {
+				continue
+			}
+			if isTest {
+				node.TestImports = append(node.TestImports, importDir)
+			} else {
+				node.Imports = append(node.Imports, importDir)
+			}
+			if !IsVendored(dir) {
+				edges = append(edges, Edge{From: NodeID(GoKind, dir), To: NodeID(GoKind, importDir), Test: isTest, File: file, Line: fset.Position(spec.Pos()).Line})
+			}
+		}
+	}
+
+	for _, node := range g.allNodes() {
+		node.Imports = UniqueSorted(node.Imports)
+		node.TestImports = UniqueSorted(node.TestImports)
+		node.TestImports = Subtract(node.TestImports, node.Imports)
+		node.ExternalImports = UniqueSorted(node.ExternalImports)
+		node.TestExternalImports = Subtract(UniqueSorted(node.TestExternalImports), node.ExternalImports)
+		node.VendorImports = UniqueSorted(node.VendorImports)
+		node.TestVendorImports = Subtract(UniqueSorted(node.TestVendorImports), node.VendorImports)
+		node.EmbedFiles = UniqueSorted(node.EmbedFiles)
+		node.TestEmbedFiles = Subtract(UniqueSorted(node.TestEmbedFiles), node.EmbedFiles)
+		node.NativeFiles = nativeFiles(fs, fs.exists, node.Dir, node.Files, preambles[node.Dir])
+	}
+
+	var nodes []*Node
+	for dir, node := range g.Packages {
+		nodes = append(nodes, NewNode(GoKind, dir, node.Inputs(true)))
+	}
+	return nodes, edges
+}
+
+// Returns the in-repo and the vendored packages
+func (g *Graph) allNodes() []*Package {
+	var res []*Package
+	for _, node := range g.Packages {
+		res = append(res, node)
+	}
+	for _, node := range g.Vendor {
+		res = append(res, node)
+	}
+	return res
+}
+
+// Returns the packages in the target directory and its subdirectories
+func (g *Graph) TargetPackages(target string) []string {
+	target = path.Clean(filepath.ToSlash(target))
+	var dirs []string
+	for dir := range g.Packages {
+		if target == "." || dir == target || strings.HasPrefix(dir, target+"/") {
+			dirs = append(dirs, dir)
+		}
+	}
+	sort.Strings(dirs)
+	return dirs
+}
+
+// Returns the packages reachable from dirs through imports, dirs included.
+//
+// Test imports are only followed for the starting packages, since the tests
+// of a dependency are never compiled into its importers
+func (g *Graph) TransitiveImports(dirs []string, withTests bool) []string {
+	seen := make(map[string]struct{})
+	var queue []string
+	push := func(dir string) {
+		if _, ok := seen[dir]; !ok {
+			seen[dir] = struct{}{}
+			queue = append(queue, dir)
+		}
+	}
+	for _, dir := range dirs {
+		push(dir)
+		if node := g.Packages[dir]; node != nil && withTests {
+			for _, imp := range node.TestImports {
+				push(imp)
+			}
+		}
+	}
+	for len(queue) > 0 {
+		dir := queue[0]
+		queue = queue[1:]
+		node := g.Packages[dir]
+		if node == nil {
+			continue
+		}
+		for _, imp := range node.Imports {
+			push(imp)
+		}
+	}
+
+	return GetSortedKeys(seen)
+}
+
+// Whether a glob pattern (see path.Match) matches file or one of its parent directories
+func MatchesInput(pattern, file string) bool {
+	for p := file; p != "." && p != "/"; p = path.Dir(p) {
+		if ok, _ := path.Match(pattern, p); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func IsGlob(pattern string) bool {
+	return strings.ContainsAny(pattern, "*?[")
+}
+
+// Returns the items of list, sorted and without duplicates
+func UniqueSorted(list []string) []string {
+	set := make(map[string]struct{})
+	for _, item := range list {
+		set[item] = struct{}{}
+	}
+	return GetSortedKeys(set)
+}
+
+// Returns the items of a that are not in b
+func Subtract(a, b []string) (res []string) {
+	for _, item := range a {
+		if !Contains(b, item) {
+			res = append(res, item)
+		}
+	}
+	return
+}
+
+// Whether e is an item of s
+func Contains(s []string, e string) bool {
+	for _, x := range s {
+		if x == e {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the keys of a set, sorted
+func GetSortedKeys(aMap map[string]struct{}) []string {
+	keys := make([]string, 0, len(aMap))
+	for k := range aMap {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Whether a file is at the root of the repo, changing every package
+func IsRootFile(path string) bool {
+	switch filepath.Dir(path) {
+	case ".", "/":
+		return true
+	default:
+		return false
+	}
+}
+
+// Returns the package owning a changed file: the package of its directory or
+// of the closest parent directory, "" if there is none
+func (g *Graph) OwningPackage(file string) string {
+	for dir := path.Dir(file); dir != "." && dir != "/"; dir = path.Dir(dir) {
+		if _, ok := g.Packages[dir]; ok {
+			return dir
+		}
+	}
+	return ""
+}
+
+// Returns, for every package, the packages importing it
+func (g *Graph) Importers() map[string][]string {
+	rev := make(map[string][]string)
+	for dir, node := range g.Packages {
+		for _, imp := range node.Imports {
+			rev[imp] = append(rev[imp], dir)
+		}
+	}
+	return rev
+}
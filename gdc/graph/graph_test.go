@@ -0,0 +1,71 @@
+package graph
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+var testRepo = MapSource{
+	"glide.yaml":             "",
+	"README.md":              "",
+	"svc/main.go":            "package main\nimport (\n\"fmt\"\n\"github.com/org/repo/lib/a\"\n)\n",
+	"svc/main_test.go":       "package main\nimport \"github.com/org/repo/lib/testutil\"\n",
+	"svc/Dockerfile":         "FROM golang AS build\nCOPY . /go/src/github.com/org/repo\nCOPY config/*.yml \\\n  /etc/svc/\nFROM alpine\nCOPY --from=build /go/bin/svc /svc\n",
+	"svc/sub/sub.go":         "package sub\n",
+	"lib/a/a.go":             "package a\nimport \"github.com/org/repo/lib/b\"\n",
+	"lib/a/a_test.go":        "package a\nimport \"github.com/org/repo/lib/c\"\n",
+	"lib/a/data.json":        "{}",
+	"lib/a/README.md":        "",
+	"lib/b/b.go":             "package b\n",
+	"lib/c/c.go":             "package c\n",
+	"lib/testutil/util.go":   "package testutil\n",
+	"other/other.go":         "package other\nimport \"github.com/org/repo/lib/c\"\n",
+	"config/app.yml":         "",
+	"config/other.txt":       "",
+	"vendor/x/y/y.go":        "package y\n",
+	"vendor/x/y/internal.go": "package y\nimport \"github.com/org/repo/lib/c\"\n",
+}
+
+// Builds the graph of src, failing the test on errors
+func mustBuild(t *testing.T, src FileSource, projectDir string) *Graph {
+	g, err := Build(context.Background(), src, projectDir, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return g
+}
+
+func TestBuildGraph(t *testing.T) {
+	g := mustBuild(t, testRepo, "github.com/org/repo")
+
+	if _, ok := g.Packages["vendor/x/y"]; ok {
+		t.Error("vendor packages should not be part of the graph")
+	}
+	a := g.Packages["lib/a"]
+	if !reflect.DeepEqual(a.Imports, []string{"lib/b"}) || !reflect.DeepEqual(a.TestImports, []string{"lib/c"}) {
+		t.Error("unexpected imports for lib/a:", a.Imports, a.TestImports)
+	}
+	if !reflect.DeepEqual(g.RootFiles, []string{"README.md", "glide.yaml"}) {
+		t.Error("unexpected root files", g.RootFiles)
+	}
+
+	res := g.TransitiveImports(g.TargetPackages("svc"), false)
+	expected := []string{"lib/a", "lib/b", "svc", "svc/sub"}
+	if !reflect.DeepEqual(res, expected) {
+		t.Error("transitive imports should be", expected, "but got", res)
+	}
+	res = g.TransitiveImports(g.TargetPackages("svc"), true)
+	expected = []string{"lib/a", "lib/b", "lib/testutil", "svc", "svc/sub"}
+	if !reflect.DeepEqual(res, expected) {
+		t.Error("transitive imports with tests should be", expected, "but got", res)
+	}
+}
+
+func TestBuildCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := Build(ctx, testRepo, "github.com/org/repo", Options{}); err != context.Canceled {
+		t.Error("building with a canceled context should fail with", context.Canceled, "but got", err)
+	}
+}
@@ -0,0 +1,240 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2017 RightScale, Inc, All Rights Reserved Worldwide.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package graph
+
+import (
+	"io/ioutil"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"golang.org/x/mod/modfile"
+)
+
+// Module is a Go module of the repo
+type Module struct {
+	Dir  string // repo relative directory of its go.mod
+	Path string // module path
+	// Module paths replaced by a directory of the repo, by the go.mod or the
+	// go.work when the module is part of the workspace
+	Replaces map[string]string
+	Vendor   bool // whether it has a vendor/modules.txt, the go command then builds from vendor
+}
+
+// Whether a repo file is the go.mod or go.sum of a module
+func isModuleFile(file string) bool {
+	base := path.Base(file)
+	return (base == "go.mod" || base == "go.sum") && !ignoredPackageDir(path.Dir(file))
+}
+
+// Returns the repo directory a replace directive points to, "" if it's not a
+// directory or it's outside the repo
+func replaceDir(fromDir string, r *modfile.Replace) string {
+	if !modfile.IsDirectoryPath(r.New.Path) || path.IsAbs(r.New.Path) {
+		return ""
+	}
+	dir := path.Join(fromDir, filepath.ToSlash(r.New.Path))
+	if dir == ".." || strings.HasPrefix(dir, "../") {
+		return ""
+	}
+	return dir
+}
+
+// Finds the modules of src and the modules used by its root go.work
+func (g *Graph) loadModules(src FileSource) {
+	g.Modules, g.Workspace, g.WorkVendor = nil, nil, false
+	for _, file := range src.Files() {
+		if path.Base(file) != "go.mod" || !isModuleFile(file) {
+			continue
+		}
+		f, err := parseGoMod(src, file)
+		if err != nil || f == nil || f.Module == nil {
+			g.Logger().Printf("WARNING! Cannot parse %s: %v\n", file, err)
+			continue
+		}
+		m := &Module{Dir: path.Dir(file), Path: f.Module.Mod.Path, Replaces: make(map[string]string)}
+		if _, err := src.ReadFile(path.Join(m.Dir, "vendor/modules.txt")); err == nil {
+			m.Vendor = true
+		}
+		for _, r := range f.Replace {
+			if dir := replaceDir(m.Dir, r); dir != "" {
+				m.Replaces[r.Old.Path] = dir
+			}
+		}
+		g.Modules = append(g.Modules, m)
+	}
+
+	content, err := src.ReadFile("go.work")
+	if err != nil {
+		return
+	}
+	work, err := modfile.ParseWork("go.work", content, nil)
+	if err != nil {
+		g.Logger().Printf("WARNING! Cannot parse go.work: %v\n", err)
+		return
+	}
+	if _, err := src.ReadFile("vendor/modules.txt"); err == nil {
+		g.WorkVendor = true
+	}
+	for _, use := range work.Use {
+		dir := path.Clean(filepath.ToSlash(use.Path))
+		if m := g.moduleAt(dir); m != nil {
+			g.Workspace = append(g.Workspace, dir)
+			for _, r := range work.Replace {
+				if dir := replaceDir(".", r); dir != "" {
+					m.Replaces[r.Old.Path] = dir
+				}
+			}
+		}
+	}
+	sort.Strings(g.Workspace)
+}
+
+// Returns the module whose go.mod is in dir
+func (g *Graph) moduleAt(dir string) *Module {
+	for _, m := range g.Modules {
+		if m.Dir == dir {
+			return m
+		}
+	}
+	return nil
+}
+
+// Returns the module holding a repo directory, the innermost one when
+// modules are nested, nil if there is none
+func (g *Graph) ModuleOfDir(dir string) *Module {
+	var res *Module
+	for _, m := range g.Modules {
+		if m.Dir == "." || dir == m.Dir || strings.HasPrefix(dir, m.Dir+"/") {
+			if res == nil || len(m.Dir) > len(res.Dir) || res.Dir == "." {
+				res = m
+			}
+		}
+	}
+	return res
+}
+
+// Returns the main modules of a module and their repo directories: the module
+// itself, or every module of the workspace when it's part of it
+func (g *Graph) mainModules(m *Module) map[string]string {
+	res := map[string]string{m.Path: m.Dir}
+	if Contains(g.Workspace, m.Dir) {
+		for _, dir := range g.Workspace {
+			other := g.moduleAt(dir)
+			res[other.Path] = other.Dir
+		}
+	}
+	return res
+}
+
+// Returns the module paths visible from a module and the repo directories
+// they resolve to: the main modules and the replace directives
+func (g *Graph) visibleModules(m *Module) map[string]string {
+	res := g.mainModules(m)
+	for modPath, dir := range m.Replaces {
+		res[modPath] = dir
+	}
+	return res
+}
+
+// Returns the repo directory of an import path found in fromDir, a vendored
+// package directory or "" if it's not in the repo. Without modules, the import
+// path must be in ProjectDir
+func (g *Graph) ResolveImport(importPath, fromDir string) string {
+	m := g.ModuleOfDir(fromDir)
+	if m == nil {
+		if dir := g.gopathVendorDir(importPath, fromDir); dir != "" {
+			return dir
+		}
+		return importToDir(importPath, g.ProjectDir)
+	}
+	vendorDir := g.vendorRoot(m)
+	if vendorDir == "" {
+		return g.lookupImport(importPath, g.visibleModules(m))
+	}
+	// When vendoring, only the main modules are built from their directory,
+	// replaced modules are vendored too
+	if dir := g.lookupImport(importPath, g.mainModules(m)); dir != "" {
+		return dir
+	}
+	if dir := path.Join(vendorDir, importPath); g.Vendor[dir] != nil {
+		return dir
+	}
+	return ""
+}
+
+// Returns the repo directory of an import path among modules given by path,
+// the longest module path wins
+func (g *Graph) lookupImport(importPath string, modules map[string]string) string {
+	best := ""
+	for modPath := range modules {
+		if (importPath == modPath || strings.HasPrefix(importPath, modPath+"/")) && len(modPath) > len(best) {
+			best = modPath
+		}
+	}
+	if best == "" {
+		return ""
+	}
+	modDir := modules[best]
+	dir := path.Join(modDir, strings.TrimPrefix(importPath[len(best):], "/"))
+	// Directories of nested modules are not part of the module
+	if owner := g.ModuleOfDir(dir); owner == nil || owner.Dir != modDir {
+		return ""
+	}
+	return dir
+}
+
+// Returns the repo directory of an import path, from any module of the repo
+func (g *Graph) ImportDir(importPath string) string {
+	if len(g.Modules) == 0 {
+		return importToDir(importPath, g.ProjectDir)
+	}
+	modules := make(map[string]string)
+	for _, m := range g.Modules {
+		modules[m.Path] = m.Dir
+	}
+	return g.lookupImport(importPath, modules)
+}
+
+// Returns the import path of a repo directory
+func (g *Graph) ImportPath(dir string) string {
+	m := g.ModuleOfDir(dir)
+	if m == nil {
+		return path.Join(g.ProjectDir, dir)
+	}
+	if m.Dir == "." {
+		return path.Join(m.Path, dir)
+	}
+	return path.Join(m.Path, strings.TrimPrefix(strings.TrimPrefix(dir, m.Dir), "/"))
+}
+
+// Returns the module path of the go.mod at the root of the repo, "" if there
+// is none
+func RootModulePath(repoPath string) string {
+	content, err := ioutil.ReadFile(filepath.Join(repoPath, "go.mod"))
+	if err != nil {
+		return ""
+	}
+	return modfile.ModulePath(content)
+}
@@ -0,0 +1,99 @@
+package graph
+
+import (
+	"reflect"
+	"testing"
+)
+
+var monoRepo = MapSource{
+	"go.work":             "go 1.21\n\nuse (\n\t./api\n\t./svc\n)\n",
+	"api/go.mod":          "module github.com/org/api\n\ngo 1.21\n",
+	"api/api.go":          "package api\n",
+	"api/v1/v1.go":        "package v1\n\nimport \"github.com/org/api\"\n",
+	"api/nested/go.mod":   "module github.com/org/api/nested\n\ngo 1.21\n",
+	"api/nested/n.go":     "package nested\n",
+	"svc/go.mod":          "module github.com/org/svc\n\ngo 1.21\n\nrequire github.com/org/api v1.0.0\n",
+	"svc/main.go":         "package main\n\nimport (\n\t\"github.com/org/api/v1\"\n\t\"github.com/org/api/nested\"\n\t\"github.com/org/svc/lib\"\n)\n",
+	"svc/lib/lib.go":      "package lib\n\nimport \"github.com/org/tools\"\n",
+	"tools/go.mod":        "module github.com/org/tools\n\ngo 1.21\n",
+	"tools/tools.go":      "package tools\n",
+	"cli/go.mod":          "module github.com/org/cli\n\ngo 1.21\n\nrequire github.com/org/tools v0.0.0\n\nreplace github.com/org/tools => ../tools\n",
+	"cli/main.go":         "package main\n\nimport \"github.com/org/tools\"\n",
+	"testdata/go.mod":     "module github.com/org/ignored\n",
+	"testdata/ignored.go": "package ignored\n",
+}
+
+func TestModules(t *testing.T) {
+	g := mustBuild(t, monoRepo, "")
+
+	var dirs []string
+	for _, m := range g.Modules {
+		dirs = append(dirs, m.Dir)
+	}
+	if !reflect.DeepEqual(dirs, []string{"api", "api/nested", "cli", "svc", "tools"}) {
+		t.Error("unexpected modules:", dirs)
+	}
+	if !reflect.DeepEqual(g.Workspace, []string{"api", "svc"}) {
+		t.Error("unexpected workspace:", g.Workspace)
+	}
+	for dir, expected := range map[string]string{"api/v1": "github.com/org/api", "api/nested": "github.com/org/api/nested", "svc/lib": "github.com/org/svc"} {
+		if module := g.Packages[dir].Module; module != expected {
+			t.Errorf("module of %s should be %s but got %s", dir, expected, module)
+		}
+	}
+
+	cases := map[string][]string{
+		// Workspace modules, the nested module is not part of the workspace
+		"svc": {"api/v1", "svc/lib"},
+		// tools is neither in the workspace nor replaced
+		"svc/lib": {},
+		// Replaced by a directory of the repo
+		"cli":    {"tools"},
+		"api/v1": {"api"},
+	}
+	for dir, expected := range cases {
+		if imports := g.Packages[dir].Imports; !reflect.DeepEqual(imports, expected) {
+			t.Errorf("imports of %s should be %v but got %v", dir, expected, imports)
+		}
+	}
+	if !reflect.DeepEqual(g.Packages["svc/lib"].ExternalImports, []string{"github.com/org/tools"}) {
+		t.Error("tools should be external to svc, got", g.Packages["svc/lib"].ExternalImports)
+	}
+
+	for dir, expected := range map[string]string{"api/v1": "github.com/org/api/v1", "api": "github.com/org/api", "api/nested": "github.com/org/api/nested"} {
+		if res := g.ImportPath(dir); res != expected {
+			t.Errorf("import path of %s should be %s but got %s", dir, expected, res)
+		}
+		if res := g.ImportDir(expected); res != dir {
+			t.Errorf("directory of %s should be %s but got %s", expected, dir, res)
+		}
+	}
+
+	// A change in a module affects the other modules of the workspace
+	if res := g.AffectedPackages([]string{"api/api.go"}, Inputs{}); !reflect.DeepEqual(res, []string{"api", "api/v1", "svc"}) {
+		t.Error("unexpected packages affected by api:", res)
+	}
+	if res := g.AffectedPackages([]string{"tools/tools.go"}, Inputs{}); !reflect.DeepEqual(res, []string{"cli", "tools"}) {
+		t.Error("unexpected packages affected by tools:", res)
+	}
+}
+
+func TestResolveModuleGoModChanges(t *testing.T) {
+	g := mustBuild(t, monoRepo, "")
+
+	// The go directive of a module changes every package of the module only
+	after := monoRepo.Copy()
+	after["svc/go.mod"] = "module github.com/org/svc\n\ngo 1.22\n\nrequire github.com/org/api v1.0.0\n"
+	res := g.ResolveGoModChanges(monoRepo, after, []string{"svc/go.mod"})
+	if !reflect.DeepEqual(res, []string{"svc/lib/lib.go", "svc/main.go"}) {
+		t.Error("unexpected changes for the go directive of svc:", res)
+	}
+
+	// Requirements of a module are shared by the whole workspace
+	after = monoRepo.Copy()
+	after["api/go.mod"] = "module github.com/org/api\n\ngo 1.21\n\nrequire github.com/org/tools v1.0.0\n"
+	res = g.ResolveGoModChanges(monoRepo, after, []string{"api/go.mod", "api/go.sum"})
+	if !reflect.DeepEqual(res, []string{"svc/lib/lib.go"}) {
+		t.Error("unexpected changes for the requirements of api:", res)
+	}
+}
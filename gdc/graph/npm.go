@@ -0,0 +1,186 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2017 RightScale, Inc, All Rights Reserved Worldwide.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package graph
+
+import (
+	"bytes"
+	"encoding/json"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// packageJSON is the part of a package.json telling how it depends on others
+type packageJSON struct {
+	Name                 string            `json:"name"`
+	Workspaces           json.RawMessage   `json:"workspaces"` // globs, or {"packages": globs} with yarn
+	Dependencies         map[string]string `json:"dependencies"`
+	DevDependencies      map[string]string `json:"devDependencies"`
+	PeerDependencies     map[string]string `json:"peerDependencies"`
+	OptionalDependencies map[string]string `json:"optionalDependencies"`
+
+	content []byte
+}
+
+// Returns the workspace globs of a package.json
+func (p *packageJSON) workspaceGlobs() []string {
+	var globs []string
+	if json.Unmarshal(p.Workspaces, &globs) == nil {
+		return globs
+	}
+	var yarn struct {
+		Packages []string `json:"packages"`
+	}
+	json.Unmarshal(p.Workspaces, &yarn)
+	return yarn.Packages
+}
+
+// Returns the line of content declaring the dependency on name, 0 if not found
+func (p *packageJSON) dependencyLine(name string) int {
+	re := regexp.MustCompile(`"` + regexp.QuoteMeta(name) + `"\s*:`)
+	if loc := re.FindIndex(p.content); loc != nil {
+		return bytes.Count(p.content[:loc[0]], []byte("\n")) + 1
+	}
+	return 0
+}
+
+// Whether a workspace glob, relative to the directory of the workspace
+// root, matches the directory of a package. A "**" element matches any
+// number of directories
+func matchesWorkspace(root, glob, dir string) bool {
+	glob = path.Join(root, glob)
+	if i := strings.Index(glob, "**"); i >= 0 {
+		prefix := strings.TrimSuffix(glob[:i], "/")
+		return prefix == "" || prefix == "." || strings.HasPrefix(dir, prefix+"/")
+	}
+	ok, _ := path.Match(glob, dir)
+	return ok
+}
+
+// npmAnalyzer finds the npm packages of the repo and the dependencies
+// between the packages of a workspace
+type npmAnalyzer struct{}
+
+// Every package.json is a package made of the files of its directory, but
+// the ones of nested packages. A package depends on the packages of its
+// workspace it names in its dependencies (devDependencies are test edges)
+// and on the packages it points to with a file: or link: version
+func (npmAnalyzer) Analyze(fs *FileSet) ([]*Node, []Edge) {
+	pkgs := make(map[string]*packageJSON)
+	var dirs []string
+	for _, file := range fs.files {
+		dir := path.Dir(file)
+		if path.Base(file) != "package.json" || ignoredAnalyzerDir(dir) {
+			continue
+		}
+		content, err := fs.ReadFile(file)
+		if err != nil {
+			fs.Logger.Printf("WARNING! Cannot read %s: %v\n", file, err)
+			continue
+		}
+		p := &packageJSON{content: content}
+		if err := json.Unmarshal(content, p); err != nil {
+			fs.Logger.Printf("Cannot parse %s, skipping it: %v\n", file, err)
+			continue
+		}
+		pkgs[dir] = p
+		dirs = append(dirs, dir)
+	}
+
+	// Packages are known by name in their workspace only
+	workspaceOf := make(map[string]string)
+	for _, root := range dirs {
+		for _, glob := range pkgs[root].workspaceGlobs() {
+			exclude := strings.HasPrefix(glob, "!")
+			for _, dir := range dirs {
+				if dir != root && matchesWorkspace(root, strings.TrimPrefix(glob, "!"), dir) {
+					if exclude {
+						delete(workspaceOf, dir)
+					} else {
+						workspaceOf[dir] = root
+					}
+				}
+			}
+		}
+		if len(pkgs[root].workspaceGlobs()) > 0 {
+			workspaceOf[root] = root
+		}
+	}
+
+	var edges []Edge
+	for _, dir := range dirs {
+		p := pkgs[dir]
+		file := path.Join(dir, "package.json")
+		add := func(deps map[string]string, test bool) {
+			var names []string
+			for name := range deps {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			for _, name := range names {
+				to := ""
+				version := deps[name]
+				if strings.HasPrefix(version, "file:") || strings.HasPrefix(version, "link:") {
+					to = path.Join(dir, strings.SplitN(version, ":", 2)[1])
+				} else if root, ok := workspaceOf[dir]; ok {
+					for _, other := range dirs {
+						if workspaceOf[other] == root && pkgs[other].Name == name {
+							to = other
+						}
+					}
+				}
+				if pkgs[to] != nil {
+					edges = append(edges, Edge{From: NodeID(NpmKind, dir), To: NodeID(NpmKind, to), Test: test, File: file, Line: p.dependencyLine(name)})
+				}
+			}
+		}
+		add(p.Dependencies, false)
+		add(p.PeerDependencies, false)
+		add(p.OptionalDependencies, false)
+		add(p.DevDependencies, true)
+	}
+
+	// A file belongs to the innermost package holding it, installed
+	// dependencies are not part of it
+	files := make(map[string][]string)
+	for _, file := range fs.files {
+		if strings.Contains("/"+file, "/node_modules/") {
+			continue
+		}
+		for dir := path.Dir(file); ; dir = path.Dir(dir) {
+			if pkgs[dir] != nil {
+				files[dir] = append(files[dir], file)
+				break
+			}
+			if dir == "." || dir == "/" {
+				break
+			}
+		}
+	}
+	var nodes []*Node
+	for _, dir := range dirs {
+		nodes = append(nodes, NewNode(NpmKind, dir, files[dir]))
+	}
+	return nodes, edges
+}
@@ -0,0 +1,43 @@
+package graph
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNpmAnalyzer(t *testing.T) {
+	repo := MapSource{
+		"web/package.json":                        "{\n  \"name\": \"web\",\n  \"workspaces\": [\"packages/*\", \"apps/**\", \"!packages/legacy\"]\n}\n",
+		"web/packages/ui/package.json":            "{\n  \"name\": \"@org/ui\",\n  \"dependencies\": {\n    \"react\": \"^18.0.0\",\n    \"@org/utils\": \"workspace:*\"\n  }\n}\n",
+		"web/packages/ui/index.js":                "",
+		"web/packages/ui/node_modules/x/index.js": "",
+		"web/packages/utils/package.json":         "{\"name\": \"@org/utils\", \"devDependencies\": {\"@org/testing\": \"*\"}}",
+		"web/packages/testing/package.json":       "{\"name\": \"@org/testing\"}",
+		"web/packages/legacy/package.json":        "{\"name\": \"@org/legacy\", \"dependencies\": {\"@org/utils\": \"*\"}}",
+		"web/apps/site/www/package.json":          "{\"name\": \"site\", \"dependencies\": {\"@org/ui\": \"*\", \"shared\": \"file:../../../../shared\"}}",
+		"shared/package.json":                     "{\"name\": \"shared\"}",
+		"other/package.json":                      "{\"name\": \"other\", \"dependencies\": {\"@org/ui\": \"*\"}}",
+	}
+	nodes, edges := npmAnalyzer{}.Analyze(NewFileSet(repo))
+
+	var ids []string
+	for _, node := range nodes {
+		ids = append(ids, node.ID)
+		if node.ID == "npm:web/packages/ui" && !reflect.DeepEqual(node.Files, []string{"web/packages/ui/index.js", "web/packages/ui/package.json"}) {
+			t.Error("unexpected files of ui:", node.Files)
+		}
+	}
+	if len(ids) != 8 {
+		t.Error("every package.json should be a node, got", ids)
+	}
+
+	expected := []Edge{
+		{From: "npm:web/apps/site/www", To: "npm:web/packages/ui", File: "web/apps/site/www/package.json", Line: 1},
+		{From: "npm:web/apps/site/www", To: "npm:shared", File: "web/apps/site/www/package.json", Line: 1},
+		{From: "npm:web/packages/ui", To: "npm:web/packages/utils", File: "web/packages/ui/package.json", Line: 5},
+		{From: "npm:web/packages/utils", To: "npm:web/packages/testing", Test: true, File: "web/packages/utils/package.json", Line: 1},
+	}
+	if !reflect.DeepEqual(edges, expected) {
+		t.Errorf("npm edges should be\n%+v\nbut got\n%+v", expected, edges)
+	}
+}
@@ -0,0 +1,226 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2017 RightScale, Inc, All Rights Reserved Worldwide.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package graph
+
+import (
+	"bufio"
+	"bytes"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// ProtoFile is a .proto file of the repo
+type ProtoFile struct {
+	File      string
+	Imports   []string // imported .proto files of the repo
+	GoPackage string   // import path of its option go_package
+	GoDir     string   // repo directory of the Go package generated from it, "" if unknown
+}
+
+var (
+	protoImportRegexp    = regexp.MustCompile(`(?m)^\s*import\s+(?:public\s+|weak\s+)?"([^"]+)"\s*;`)
+	protoGoPackageRegexp = regexp.MustCompile(`(?m)^\s*option\s+go_package\s*=\s*"([^"]+)"\s*;`)
+	protoCommentRegexp   = regexp.MustCompile(`(?s)/\*.*?\*/|//[^\n]*`)
+)
+
+// Parses the imports and the go_package option of a .proto file, as written
+func parseProto(content []byte) (imports []string, goPackage string) {
+	content = protoCommentRegexp.ReplaceAll(content, nil)
+	for _, m := range protoImportRegexp.FindAllSubmatch(content, -1) {
+		imports = append(imports, string(m[1]))
+	}
+	if m := protoGoPackageRegexp.FindSubmatch(content); m != nil {
+		// "path;name" sets the package name too
+		goPackage = strings.SplitN(string(m[1]), ";", 2)[0]
+	}
+	return
+}
+
+// Returns the .proto file of a generated Go file, from the "// source:" line
+// protoc-gen-go writes in its header, "" if there is none
+func protoSourceComment(content []byte) string {
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "package ") {
+			break
+		}
+		if strings.HasPrefix(line, "// source: ") && strings.HasSuffix(line, ".proto") {
+			return strings.TrimPrefix(line, "// source: ")
+		}
+	}
+	return ""
+}
+
+// Returns the repo file of a .proto import path found in file. protoc looks
+// imports up in its -I directories, they're guessed by trying the repo root
+// and the parent directories of the importing file
+func resolveProtoImport(importPath, file string, exists map[string]bool) string {
+	if exists[importPath] {
+		return importPath
+	}
+	for dir := path.Dir(file); dir != "." && dir != "/"; dir = path.Dir(dir) {
+		if candidate := path.Join(dir, importPath); exists[candidate] {
+			return candidate
+		}
+	}
+	return ""
+}
+
+// protoAnalyzer parses the .proto files once its graph has its Go packages
+type protoAnalyzer struct {
+	g *Graph
+}
+
+// Returns the .proto files, depending on what they import, and the Go
+// packages generated from them depending on them
+func (a protoAnalyzer) Analyze(fs *FileSet) ([]*Node, []Edge) {
+	a.g.loadProtos(fs)
+	var nodes []*Node
+	var edges []Edge
+	for file, p := range a.g.Protos {
+		nodes = append(nodes, NewNode(ProtoKind, file, []string{file}))
+		for _, imp := range p.Imports {
+			edges = append(edges, Edge{From: NodeID(ProtoKind, file), To: NodeID(ProtoKind, imp), File: file})
+		}
+		if p.GoDir != "" {
+			edges = append(edges, Edge{From: NodeID(GoKind, p.GoDir), To: NodeID(ProtoKind, file), File: file})
+		}
+	}
+	return nodes, edges
+}
+
+// Parses the .proto files of fs and links them to the Go packages generated
+// from them, through their go_package option or the source header of the
+// generated Go files
+func (g *Graph) loadProtos(fs *FileSet) {
+	g.Protos = make(map[string]*ProtoFile)
+	for _, file := range fs.files {
+		if !strings.HasSuffix(file, ".proto") || ignoredPackageDir(path.Dir(file)) {
+			continue
+		}
+		content, err := fs.ReadFile(file)
+		if err != nil {
+			fs.Logger.Printf("WARNING! Cannot read %s: %v\n", file, err)
+			continue
+		}
+		imports, goPackage := parseProto(content)
+		p := &ProtoFile{File: file, GoPackage: goPackage}
+		for _, imp := range imports {
+			if resolved := resolveProtoImport(imp, file, fs.exists); resolved != "" {
+				p.Imports = append(p.Imports, resolved)
+			}
+		}
+		if goPackage != "" {
+			if dir := g.ImportDir(goPackage); dir != "" {
+				p.GoDir = dir
+			}
+		}
+		g.Protos[file] = p
+	}
+	for dir, node := range g.Packages {
+		for _, source := range node.ProtoSources {
+			if p := g.findProto(source); p != nil && p.GoDir == "" {
+				p.GoDir = dir
+			}
+		}
+	}
+}
+
+// Returns the .proto file of a path relative to an unknown protoc -I
+// directory: the file at this path or the only one ending with it
+func (g *Graph) findProto(source string) *ProtoFile {
+	if p := g.Protos[source]; p != nil {
+		return p
+	}
+	var found *ProtoFile
+	for file, p := range g.Protos {
+		if strings.HasSuffix(file, "/"+source) {
+			if found != nil {
+				return nil
+			}
+			found = p
+		}
+	}
+	return found
+}
+
+// Returns the .proto files importing one of files, directly or not, files included
+func (g *Graph) protoImporters(files []string) []string {
+	seen := make(map[string]struct{})
+	for _, file := range files {
+		if g.Protos[file] != nil {
+			seen[file] = struct{}{}
+		}
+	}
+	for changed := true; changed; {
+		changed = false
+		for file, p := range g.Protos {
+			if _, ok := seen[file]; ok {
+				continue
+			}
+			for _, imp := range p.Imports {
+				if _, ok := seen[imp]; ok {
+					seen[file], changed = struct{}{}, true
+					break
+				}
+			}
+		}
+	}
+	return GetSortedKeys(seen)
+}
+
+// Returns the Go packages generated from a changed .proto file or from a
+// .proto file importing it
+func (g *Graph) ProtoChangedPackages(file string) []string {
+	var res []string
+	for _, p := range g.protoImporters([]string{file}) {
+		if dir := g.Protos[p].GoDir; g.Packages[dir] != nil {
+			res = append(res, dir)
+		}
+	}
+	return UniqueSorted(res)
+}
+
+// Returns the .proto files the Go packages dirs are generated from, with the
+// ones they import, transitively
+func (g *Graph) ProtoSources(dirs []string) []string {
+	seen := make(map[string]struct{})
+	var queue []string
+	for _, p := range g.Protos {
+		if p.GoDir != "" && Contains(dirs, p.GoDir) {
+			queue = append(queue, p.File)
+		}
+	}
+	for len(queue) > 0 {
+		file := queue[0]
+		queue = queue[1:]
+		if _, ok := seen[file]; ok {
+			continue
+		}
+		seen[file] = struct{}{}
+		queue = append(queue, g.Protos[file].Imports...)
+	}
+	return GetSortedKeys(seen)
+}
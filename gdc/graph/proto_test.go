@@ -0,0 +1,65 @@
+package graph
+
+import (
+	"reflect"
+	"testing"
+)
+
+var protoRepo = MapSource{
+	"proto/common/common.proto": "syntax = \"proto3\";\n\noption go_package = \"github.com/org/repo/gen/common;common\";\n",
+	"proto/api/api.proto":       "syntax = \"proto3\";\n\nimport \"common/common.proto\";\nimport public \"google/protobuf/empty.proto\";\n\noption go_package = \"github.com/org/repo/gen/api\";\n",
+	"proto/audit/audit.proto":   "syntax = \"proto3\";\n\nimport \"proto/common/common.proto\";\n",
+	"proto/misc/misc.proto":     "syntax = \"proto3\";\n",
+	"gen/common/common.pb.go":   "// Code generated by protoc-gen-go. DO NOT EDIT.\n// source: common/common.proto\n\npackage common\n",
+	"gen/api/api.pb.go":         "// Code generated by protoc-gen-go. DO NOT EDIT.\n// source: api/api.proto\n\npackage api\n\nimport \"github.com/org/repo/gen/common\"\n",
+	"legacy/audit/audit.pb.go":  "// Code generated by protoc-gen-go. DO NOT EDIT.\n// source: audit/audit.proto\n\npackage audit\n",
+	"svc/users/main.go":         "package main\n\nimport \"github.com/org/repo/gen/api\"\n",
+	"svc/audit/main.go":         "package main\n\nimport \"github.com/org/repo/legacy/audit\"\n",
+	"svc/misc/main.go":          "package main\n",
+}
+
+func TestParseProto(t *testing.T) {
+	content := "syntax = \"proto3\";\n// import \"commented.proto\";\n/* import \"block.proto\";\n*/\nimport \"a.proto\";\nimport public \"b/b.proto\";\n  import weak \"c.proto\" ;\noption go_package = \"github.com/org/repo/gen/x;xpb\";\n"
+	imports, goPackage := parseProto([]byte(content))
+	if !reflect.DeepEqual(imports, []string{"a.proto", "b/b.proto", "c.proto"}) {
+		t.Error("unexpected imports:", imports)
+	}
+	if goPackage != "github.com/org/repo/gen/x" {
+		t.Error("unexpected go_package:", goPackage)
+	}
+}
+
+func TestProtoGraph(t *testing.T) {
+	g := mustBuild(t, protoRepo, "github.com/org/repo")
+
+	goDirs := map[string]string{
+		"proto/common/common.proto": "gen/common",
+		"proto/api/api.proto":       "gen/api",
+		// No go_package, found with the source of the generated file
+		"proto/audit/audit.proto": "legacy/audit",
+		"proto/misc/misc.proto":   "",
+	}
+	for file, expected := range goDirs {
+		if dir := g.Protos[file].GoDir; dir != expected {
+			t.Errorf("Go package of %s should be %q but got %q", file, expected, dir)
+		}
+	}
+	if imports := g.Protos["proto/api/api.proto"].Imports; !reflect.DeepEqual(imports, []string{"proto/common/common.proto"}) {
+		t.Error("unexpected imports of api.proto:", imports)
+	}
+
+	affected := map[string][]string{
+		"proto/common/common.proto": {"gen/api", "gen/common", "legacy/audit", "svc/audit", "svc/users"},
+		"proto/api/api.proto":       {"gen/api", "svc/users"},
+		"proto/misc/misc.proto":     {},
+	}
+	for file, expected := range affected {
+		if res := g.AffectedPackages([]string{file}, Inputs{}); !reflect.DeepEqual(res, expected) {
+			t.Errorf("packages affected by %s should be %v but got %v", file, expected, res)
+		}
+	}
+
+	if res := g.ProtoSources([]string{"gen/api"}); !reflect.DeepEqual(res, []string{"proto/api/api.proto", "proto/common/common.proto"}) {
+		t.Error("unexpected proto sources of gen/api:", res)
+	}
+}
@@ -0,0 +1,187 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2017 RightScale, Inc, All Rights Reserved Worldwide.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package graph
+
+import (
+	"path"
+	"regexp"
+	"strings"
+)
+
+// pyImport is an import statement of a Python file
+type pyImport struct {
+	Module string   // as written, without the leading dots
+	Level  int      // number of leading dots of a relative import
+	Names  []string // imported names of a from import
+	Line   int
+}
+
+var (
+	pyImportRegexp = regexp.MustCompile(`^\s*import\s+(.+)$`)
+	pyFromRegexp   = regexp.MustCompile(`^\s*from\s+(\.*)([\w.]*)\s+import\s+(.+)$`)
+)
+
+// Parses the import statements of a Python file, statements continued with
+// a backslash or in parentheses included
+func parsePythonImports(content []byte) []pyImport {
+	var res []pyImport
+	lines := strings.Split(string(content), "\n")
+	for i := 0; i < len(lines); i++ {
+		start := i
+		stmt := pyStripComment(lines[i])
+		for (strings.HasSuffix(stmt, "\\") || strings.Count(stmt, "(") > strings.Count(stmt, ")")) && i+1 < len(lines) {
+			i++
+			stmt = strings.TrimSuffix(stmt, "\\") + " " + pyStripComment(lines[i])
+		}
+		if m := pyFromRegexp.FindStringSubmatch(stmt); m != nil {
+			imp := pyImport{Module: m[2], Level: len(m[1]), Line: start + 1}
+			for _, name := range strings.Split(strings.Trim(strings.TrimSpace(m[3]), "()"), ",") {
+				if fields := strings.Fields(name); len(fields) > 0 && fields[0] != "*" {
+					imp.Names = append(imp.Names, fields[0])
+				}
+			}
+			res = append(res, imp)
+		} else if m := pyImportRegexp.FindStringSubmatch(stmt); m != nil {
+			for _, module := range strings.Split(m[1], ",") {
+				if fields := strings.Fields(module); len(fields) > 0 {
+					res = append(res, pyImport{Module: fields[0], Line: start + 1})
+				}
+			}
+		}
+	}
+	return res
+}
+
+func pyStripComment(line string) string {
+	if i := strings.Index(line, "#"); i >= 0 {
+		line = line[:i]
+	}
+	return strings.TrimRight(line, " \t\r")
+}
+
+// Returns the directory Python adds to its path to run file: the parent of
+// the outermost package (directory with an __init__.py) holding it
+func pythonRoot(file string, exists map[string]bool) string {
+	dir := path.Dir(file)
+	for dir != "." && exists[path.Join(dir, "__init__.py")] {
+		dir = path.Dir(dir)
+	}
+	return dir
+}
+
+// Returns the repo files of a module path relative to dir: the module file
+// or the __init__.py of the package, with the __init__.py of the packages
+// holding it, since importing a module runs them
+func pythonModuleFiles(dir, module string, exists map[string]bool) []string {
+	if module == "" {
+		if file := path.Join(dir, "__init__.py"); exists[file] {
+			return []string{file}
+		}
+		return nil
+	}
+	parts := strings.Split(module, ".")
+	base := path.Join(dir, path.Join(parts...))
+	var res []string
+	for _, file := range []string{base + ".py", path.Join(base, "__init__.py")} {
+		if exists[file] {
+			res = append(res, file)
+			break
+		}
+	}
+	if res == nil {
+		return nil
+	}
+	for i := 1; i < len(parts); i++ {
+		if file := path.Join(dir, path.Join(parts[:i]...), "__init__.py"); exists[file] {
+			res = append(res, file)
+		}
+	}
+	return res
+}
+
+// Returns the repo files an import of file loads, looked up relatively for
+// relative imports, otherwise from the root of file and from the repo root
+func resolvePythonImport(imp pyImport, file string, exists map[string]bool) []string {
+	var roots []string
+	if imp.Level > 0 {
+		dir := path.Dir(file)
+		for i := 1; i < imp.Level; i++ {
+			dir = path.Dir(dir)
+		}
+		roots = []string{dir}
+	} else {
+		roots = []string{pythonRoot(file, exists), "."}
+	}
+	for _, root := range roots {
+		res := pythonModuleFiles(root, imp.Module, exists)
+		// from package import module
+		for _, name := range imp.Names {
+			sub := name
+			if imp.Module != "" {
+				sub = imp.Module + "." + name
+			}
+			if files := pythonModuleFiles(root, sub, exists); len(files) > 0 {
+				res = append(res, files[0])
+			}
+		}
+		if len(res) > 0 {
+			return UniqueSorted(res)
+		}
+	}
+	return nil
+}
+
+// Whether a Python file is a test, by the conventions of pytest and unittest.
+// Other files of a tests directory are helpers: test edges are not followed
+// transitively, so their imports must be plain edges
+func isPythonTest(file string) bool {
+	base := path.Base(file)
+	return strings.HasPrefix(base, "test_") || strings.HasSuffix(base, "_test.py") || base == "conftest.py"
+}
+
+// pythonAnalyzer finds the Python modules of the repo and their imports
+type pythonAnalyzer struct{}
+
+// Every .py file is a module, depending on the modules of the repo it
+// imports. The imports of test modules are test edges
+func (pythonAnalyzer) Analyze(fs *FileSet) ([]*Node, []Edge) {
+	var nodes []*Node
+	var edges []Edge
+	for _, file := range fs.files {
+		if !strings.HasSuffix(file, ".py") || ignoredAnalyzerDir(path.Dir(file)) {
+			continue
+		}
+		nodes = append(nodes, NewNode(PythonKind, file, []string{file}))
+		content, err := fs.ReadFile(file)
+		if err != nil {
+			fs.Logger.Printf("WARNING! Cannot read %s: %v\n", file, err)
+			continue
+		}
+		for _, imp := range parsePythonImports(content) {
+			for _, to := range resolvePythonImport(imp, file, fs.exists) {
+				edges = append(edges, Edge{From: NodeID(PythonKind, file), To: NodeID(PythonKind, to), Test: isPythonTest(file), File: file, Line: imp.Line})
+			}
+		}
+	}
+	return nodes, edges
+}
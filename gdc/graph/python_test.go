@@ -0,0 +1,69 @@
+package graph
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParsePythonImports(t *testing.T) {
+	content := "import os, app.models as m\nfrom . import views  # comment\nfrom ..core import (\n    db,\n    cache,\n)\nfrom app.utils import *\n# import ignored\ndef f():\n    import app.lazy\n"
+	expected := []pyImport{
+		{Module: "os", Line: 1},
+		{Module: "app.models", Line: 1},
+		{Module: "", Level: 1, Names: []string{"views"}, Line: 2},
+		{Module: "core", Level: 2, Names: []string{"db", "cache"}, Line: 3},
+		{Module: "app.utils", Line: 7},
+		{Module: "app.lazy", Line: 10},
+	}
+	if res := parsePythonImports([]byte(content)); !reflect.DeepEqual(res, expected) {
+		t.Errorf("imports should be\n%+v\nbut got\n%+v", expected, res)
+	}
+}
+
+func TestResolvePythonImport(t *testing.T) {
+	exists := map[string]bool{
+		"tools/app/__init__.py":       true,
+		"tools/app/models.py":         true,
+		"tools/app/views/__init__.py": true,
+		"tools/app/core/__init__.py":  true,
+		"tools/app/core/db.py":        true,
+		"tools/app/api/handlers.py":   true,
+		"tools/app/api/__init__.py":   true,
+		"tools/run.py":                true,
+		"shared/__init__.py":          true,
+	}
+	cases := []struct {
+		imp      pyImport
+		file     string
+		expected []string
+	}{
+		{pyImport{Module: "app.models"}, "tools/run.py", []string{"tools/app/__init__.py", "tools/app/models.py"}},
+		{pyImport{Level: 1, Names: []string{"views"}}, "tools/app/models.py", []string{"tools/app/__init__.py", "tools/app/views/__init__.py"}},
+		{pyImport{Module: "core", Level: 2, Names: []string{"db", "cache"}}, "tools/app/api/handlers.py", []string{"tools/app/core/__init__.py", "tools/app/core/db.py"}},
+		// From the root of the file, the parent of its outermost package
+		{pyImport{Module: "app.core", Names: []string{"db"}}, "tools/app/api/handlers.py", []string{"tools/app/__init__.py", "tools/app/core/__init__.py", "tools/app/core/db.py"}},
+		// From the repo root
+		{pyImport{Module: "shared"}, "tools/run.py", []string{"shared/__init__.py"}},
+		{pyImport{Module: "os"}, "tools/run.py", nil},
+	}
+	for _, c := range cases {
+		if res := resolvePythonImport(c.imp, c.file, exists); !reflect.DeepEqual(res, c.expected) {
+			t.Errorf("%+v in %s should resolve to %v but got %v", c.imp, c.file, c.expected, res)
+		}
+	}
+}
+
+func TestPythonTestHelpers(t *testing.T) {
+	g := mustBuild(t, MapSource{
+		"lib/__init__.py":         "",
+		"lib/fmt.py":              "",
+		"tests/__init__.py":       "",
+		"tests/helpers.py":        "from lib import fmt\n",
+		"tests/test_fmt.py":       "from tests import helpers\n",
+		"tests/test_unrelated.py": "",
+	}, "github.com/org/repo")
+	expected := []string{"python:lib/fmt.py", "python:tests/helpers.py", "python:tests/test_fmt.py"}
+	if res := g.AffectedNodes([]string{"lib/fmt.py"}); !reflect.DeepEqual(res, expected) {
+		t.Error("nodes affected through a test helper should be", expected, "but got", res)
+	}
+}
@@ -0,0 +1,203 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2017 RightScale, Inc, All Rights Reserved Worldwide.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package graph
+
+import (
+	"bytes"
+	"path"
+	"regexp"
+	"strings"
+)
+
+var (
+	shellShebangRegexp = regexp.MustCompile(`^#!\s*\S*\b(?:env\s+)?(?:ba|da|k|z)?sh\b`)
+	shellSourceRegexp  = regexp.MustCompile(`(?:^|[;&|({]|\bthen|\bdo|\belse)\s*(?:source|\.)\s+`)
+	shellAssignRegexp  = regexp.MustCompile(`^\s*(?:export\s+|local\s+|readonly\s+|declare\s+)?(\w+)=(.*)$`)
+	shellVarRegexp     = regexp.MustCompile(`^\$(?:\{(\w+)\}|(\w+))`)
+)
+
+// shellSource is a source or . statement of a shell script
+type shellSource struct {
+	Path string // as written, unquoted
+	Line int
+}
+
+// Whether a file is a shell script, by its extension or its shebang
+func isShellScript(file string, content func() []byte) bool {
+	switch path.Ext(file) {
+	case ".sh", ".bash":
+		return true
+	case "":
+		return shellShebangRegexp.Match(content())
+	}
+	return false
+}
+
+// Parses the source and . statements of a shell script, and the variables
+// set to the directory of the script, like DIR=$(dirname "$0")
+func parseShellSources(content []byte) (sources []shellSource, scriptDirVars map[string]bool) {
+	scriptDirVars = make(map[string]bool)
+	for i, line := range strings.Split(string(content), "\n") {
+		if j := strings.Index(line, " #"); j >= 0 {
+			line = line[:j]
+		}
+		if strings.HasPrefix(strings.TrimSpace(line), "#") {
+			continue
+		}
+		if m := shellAssignRegexp.FindStringSubmatch(line); m != nil && isScriptDirExpr(m[2]) {
+			scriptDirVars[m[1]] = true
+		}
+		for _, loc := range shellSourceRegexp.FindAllStringIndex(line, -1) {
+			if word := shellWord(line[loc[1]:]); word != "" {
+				sources = append(sources, shellSource{Path: word, Line: i + 1})
+			}
+		}
+	}
+	return
+}
+
+// Returns the first word of s without its quotes. Command substitutions are
+// kept as written
+func shellWord(s string) string {
+	var word []byte
+	var quote byte
+	depth := 0
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case depth > 0:
+			word = append(word, c)
+			if c == '(' {
+				depth++
+			} else if c == ')' {
+				depth--
+			}
+		case c == '$' && i+1 < len(s) && s[i+1] == '(':
+			word = append(word, "$("...)
+			depth++
+			i++
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			} else {
+				word = append(word, c)
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case strings.IndexByte(" \t;&|)", c) >= 0:
+			return string(word)
+		default:
+			word = append(word, c)
+		}
+	}
+	return string(word)
+}
+
+// Whether a shell expression is the directory of the running script
+func isScriptDirExpr(expr string) bool {
+	return strings.Contains(expr, "dirname") && (strings.Contains(expr, "$0") || strings.Contains(expr, "BASH_SOURCE")) ||
+		strings.Contains(expr, "${BASH_SOURCE%/*}") || strings.Contains(expr, "${0%/*}")
+}
+
+// Returns the repo file a sourced path of script refers to, "" if unknown.
+// Paths starting with the directory of the script are relative to it, other
+// relative paths are looked up next to the script, then from the repo root
+func resolveShellSource(p, script string, scriptDirVars map[string]bool, exists map[string]bool) string {
+	dir := path.Dir(script)
+	switch {
+	case strings.HasPrefix(p, "$("):
+		end := strings.Index(p, ")/")
+		if end < 0 || !isScriptDirExpr(p[:end+1]) {
+			return ""
+		}
+		p = path.Join(dir, p[end+2:])
+	case strings.HasPrefix(p, "${BASH_SOURCE%/*}/"), strings.HasPrefix(p, "${0%/*}/"):
+		p = path.Join(dir, p[strings.Index(p, "}/")+2:])
+	case strings.HasPrefix(p, "$"):
+		m := shellVarRegexp.FindStringSubmatch(p)
+		if m == nil || !scriptDirVars[m[1]+m[2]] {
+			return ""
+		}
+		p = path.Join(dir, strings.TrimPrefix(p[len(m[0]):], "/"))
+	case strings.HasPrefix(p, "/"), strings.HasPrefix(p, "~"):
+		return ""
+	default:
+		if candidate := path.Join(dir, p); exists[candidate] {
+			return candidate
+		}
+		p = path.Clean(p)
+	}
+	if exists[p] {
+		return p
+	}
+	return ""
+}
+
+// shellAnalyzer finds the shell scripts of the repo and the files they source
+type shellAnalyzer struct{}
+
+// Every shell script, and every file a script sources, is a node depending
+// on the files it sources
+func (shellAnalyzer) Analyze(fs *FileSet) ([]*Node, []Edge) {
+	var queue []string
+	for _, file := range fs.files {
+		if ignoredAnalyzerDir(path.Dir(file)) {
+			continue
+		}
+		if isShellScript(file, func() []byte {
+			content, _ := fs.ReadFile(file)
+			return content
+		}) {
+			queue = append(queue, file)
+		}
+	}
+
+	seen := make(map[string]bool)
+	var nodes []*Node
+	var edges []Edge
+	for len(queue) > 0 {
+		file := queue[0]
+		queue = queue[1:]
+		if seen[file] {
+			continue
+		}
+		seen[file] = true
+		nodes = append(nodes, NewNode(ShellKind, file, []string{file}))
+		content, err := fs.ReadFile(file)
+		if err != nil {
+			fs.Logger.Printf("WARNING! Cannot read %s: %v\n", file, err)
+			continue
+		}
+		if bytes.IndexByte(content, 0) >= 0 {
+			continue // not a script
+		}
+		sources, scriptDirVars := parseShellSources(content)
+		for _, s := range sources {
+			if to := resolveShellSource(s.Path, file, scriptDirVars, fs.exists); to != "" {
+				edges = append(edges, Edge{From: NodeID(ShellKind, file), To: NodeID(ShellKind, to), File: file, Line: s.Line})
+				queue = append(queue, to)
+			}
+		}
+	}
+	return nodes, edges
+}
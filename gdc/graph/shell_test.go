@@ -0,0 +1,35 @@
+package graph
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestShellAnalyzer(t *testing.T) {
+	repo := MapSource{
+		"docker-shared.sh":  "#!/bin/bash\n# Not an executable. This is a function library that should be sourced\n",
+		"svc/build.sh":      "#!/bin/bash\nset -e\nsource ../docker-shared.sh\n. \"$(dirname \"${BASH_SOURCE[0]}\")/env\" && echo ok\n",
+		"svc/env":           "export A=1\n",
+		"svc/deploy":        "#!/usr/bin/env bash\nDIR=$(cd \"$(dirname \"$0\")\" && pwd)\nif true; then source \"$DIR/lib/common.sh\"; fi\n. /etc/profile\nsource \"$UNKNOWN/x.sh\"\n# source commented.sh\n",
+		"svc/lib/common.sh": "source ${BASH_SOURCE%/*}/../env\n",
+		"svc/README":        "See build.sh, then source the env\n",
+	}
+	nodes, edges := shellAnalyzer{}.Analyze(NewFileSet(repo))
+
+	var ids []string
+	for _, node := range nodes {
+		ids = append(ids, node.ID)
+	}
+	if !reflect.DeepEqual(UniqueSorted(ids), []string{"shell:docker-shared.sh", "shell:svc/build.sh", "shell:svc/deploy", "shell:svc/env", "shell:svc/lib/common.sh"}) {
+		t.Error("unexpected shell nodes:", ids)
+	}
+	expected := []Edge{
+		{From: "shell:svc/build.sh", To: "shell:docker-shared.sh", File: "svc/build.sh", Line: 3},
+		{From: "shell:svc/build.sh", To: "shell:svc/env", File: "svc/build.sh", Line: 4},
+		{From: "shell:svc/deploy", To: "shell:svc/lib/common.sh", File: "svc/deploy", Line: 3},
+		{From: "shell:svc/lib/common.sh", To: "shell:svc/env", File: "svc/lib/common.sh", Line: 1},
+	}
+	if !reflect.DeepEqual(edges, expected) {
+		t.Errorf("shell edges should be\n%+v\nbut got\n%+v", expected, edges)
+	}
+}
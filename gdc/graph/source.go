@@ -0,0 +1,110 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2017 RightScale, Inc, All Rights Reserved Worldwide.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package graph
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// FileSource gives access to the files of a repo. Paths are always
+// slash separated and relative to the repo root
+type FileSource interface {
+	Files() []string
+	ReadFile(name string) ([]byte, error)
+}
+
+// DirSource is a FileSource reading from a directory on disk
+type DirSource struct {
+	root  string
+	files []string
+}
+
+// Returns a FileSource for the files on disk under root, skipping .git
+func NewDirSource(root string) (*DirSource, error) {
+	src := &DirSource{root: root}
+	err := filepath.Walk(root, func(p string, f os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if f.IsDir() && f.Name() == ".git" {
+			return filepath.SkipDir
+		}
+		if !f.Mode().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		src.files = append(src.files, filepath.ToSlash(rel))
+		return nil
+	})
+	sort.Strings(src.files)
+
+	return src, err
+}
+
+// Returns the directory the files are read from
+func (s *DirSource) Root() string {
+	return s.root
+}
+
+func (s *DirSource) Files() []string {
+	return s.files
+}
+
+func (s *DirSource) ReadFile(name string) ([]byte, error) {
+	return ioutil.ReadFile(filepath.Join(s.root, filepath.FromSlash(name)))
+}
+
+// MapSource is an in-memory FileSource, contents by path
+type MapSource map[string]string
+
+func (m MapSource) Files() []string {
+	var files []string
+	for file := range m {
+		files = append(files, file)
+	}
+	sort.Strings(files)
+	return files
+}
+
+func (m MapSource) ReadFile(name string) ([]byte, error) {
+	content, ok := m[name]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	return []byte(content), nil
+}
+
+// Returns a copy of m, to change files without touching m
+func (m MapSource) Copy() MapSource {
+	res := make(MapSource)
+	for k, v := range m {
+		res[k] = v
+	}
+	return res
+}
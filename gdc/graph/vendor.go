@@ -0,0 +1,291 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2017 RightScale, Inc, All Rights Reserved Worldwide.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package graph
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"golang.org/x/mod/modfile"
+)
+
+// Whether a repo directory is a vendored package directory, that is under a
+// vendor directory but not otherwise ignored
+func IsVendored(dir string) bool {
+	vendored := false
+	for _, elem := range strings.Split(dir, "/") {
+		if elem == "vendor" {
+			vendored = true
+		} else if ignoredPackageDir(elem) {
+			return false
+		}
+	}
+	return vendored
+}
+
+func hasGoFile(files []string) bool {
+	for _, file := range files {
+		if strings.HasSuffix(file, ".go") {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the vendored package directory of an import path in GOPATH mode:
+// the vendor directories of fromDir and its parents are searched, innermost first
+func (g *Graph) gopathVendorDir(importPath, fromDir string) string {
+	for dir := fromDir; ; dir = path.Dir(dir) {
+		if path.Base(dir) != "vendor" {
+			if candidate := path.Join(dir, "vendor", importPath); g.Vendor[candidate] != nil {
+				return candidate
+			}
+		}
+		if dir == "." || dir == "/" {
+			return ""
+		}
+	}
+}
+
+// Returns the vendor directory the packages of a module are built from, ""
+// if it's not vendoring. Workspaces are vendored at the root
+func (g *Graph) vendorRoot(m *Module) string {
+	if Contains(g.Workspace, m.Dir) {
+		if g.WorkVendor {
+			return "vendor"
+		}
+		return ""
+	}
+	if m.Vendor {
+		return path.Join(m.Dir, "vendor")
+	}
+	return ""
+}
+
+// Returns the vendored package owning a file, "" if there is none
+func (g *Graph) OwningVendorPackage(file string) string {
+	for dir := path.Dir(file); dir != "." && dir != "/"; dir = path.Dir(dir) {
+		if _, ok := g.Vendor[dir]; ok {
+			return dir
+		}
+	}
+	return ""
+}
+
+// Returns the vendored packages reachable from the in-repo packages dirs,
+// through their test imports too if withTests is set
+func (g *Graph) VendoredDeps(dirs []string, withTests bool) []string {
+	var start []string
+	for _, dir := range dirs {
+		if node := g.Packages[dir]; node != nil {
+			start = append(start, node.VendorImports...)
+			if withTests {
+				start = append(start, node.TestVendorImports...)
+			}
+		}
+	}
+	return g.VendorClosure(start)
+}
+
+// Returns the vendored packages reachable from vendored packages, included
+func (g *Graph) VendorClosure(dirs []string) []string {
+	seen := make(map[string]struct{})
+	queue := dirs
+	for len(queue) > 0 {
+		dir := queue[0]
+		queue = queue[1:]
+		if _, ok := seen[dir]; ok {
+			continue
+		}
+		seen[dir] = struct{}{}
+		if node := g.Vendor[dir]; node != nil {
+			queue = append(queue, node.VendorImports...)
+		}
+	}
+	return GetSortedKeys(seen)
+}
+
+// Returns the in-repo packages importing a vendored package, directly or
+// through other vendored packages, by their code or their tests
+func (g *Graph) VendorImporters(vendorDir string) []string {
+	// Vendored packages reaching vendorDir
+	reaching := map[string]bool{vendorDir: true}
+	for changed := true; changed; {
+		changed = false
+		for dir, node := range g.Vendor {
+			if reaching[dir] {
+				continue
+			}
+			for _, imp := range node.VendorImports {
+				if reaching[imp] {
+					reaching[dir], changed = true, true
+					break
+				}
+			}
+		}
+	}
+
+	var res []string
+	for dir, node := range g.Packages {
+		for _, imp := range append(node.VendorImports, node.TestVendorImports...) {
+			if reaching[imp] {
+				res = append(res, dir)
+				break
+			}
+		}
+	}
+	sort.Strings(res)
+	return res
+}
+
+// vendoredModule is a module listed in vendor/modules.txt
+type vendoredModule struct {
+	Version     string
+	Replacement string // "path version" or "path", "" if it's not replaced
+	Explicit    bool   // required by go.mod
+}
+
+// Parses the module lines of vendor/modules.txt:
+//
+//	# module version [=> replacement [version]]
+//	## explicit; go 1.17
+func parseModulesTxt(content []byte) map[string]*vendoredModule {
+	res := make(map[string]*vendoredModule)
+	var current *vendoredModule
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "## "):
+			if current == nil {
+				continue
+			}
+			for _, annotation := range strings.Split(strings.TrimPrefix(line, "## "), ";") {
+				if strings.TrimSpace(annotation) == "explicit" {
+					current.Explicit = true
+				}
+			}
+		case strings.HasPrefix(line, "# "):
+			fields := strings.Fields(strings.TrimPrefix(line, "# "))
+			if len(fields) == 0 {
+				current = nil
+				continue
+			}
+			m := &vendoredModule{}
+			rest := fields[1:]
+			if len(rest) > 0 && rest[0] != "=>" {
+				m.Version, rest = rest[0], rest[1:]
+			}
+			if len(rest) > 1 && rest[0] == "=>" {
+				m.Replacement = strings.Join(rest[1:], " ")
+			}
+			// A replacement of every version, without packages
+			key := fields[0]
+			if m.Version == "" && res[key] != nil {
+				res[key].Replacement = m.Replacement
+				current = res[key]
+				continue
+			}
+			res[key] = m
+			current = m
+		}
+	}
+	return res
+}
+
+// Returns the inconsistencies between a go.mod and its vendor/modules.txt:
+// required versions, explicit requirements and replacements must match
+func checkVendorConsistency(f *modfile.File, modulesTxt []byte) []string {
+	var problems []string
+	vendored := parseModulesTxt(modulesTxt)
+	required := make(map[string]bool)
+	for _, r := range f.Require {
+		required[r.Mod.Path] = true
+		v := vendored[r.Mod.Path]
+		switch {
+		case v == nil:
+			problems = append(problems, fmt.Sprintf("%s@%s is required in go.mod but missing in vendor/modules.txt", r.Mod.Path, r.Mod.Version))
+		case v.Version != r.Mod.Version:
+			problems = append(problems, fmt.Sprintf("%s@%s is required in go.mod but vendor/modules.txt has %s", r.Mod.Path, r.Mod.Version, v.Version))
+		case !v.Explicit:
+			problems = append(problems, fmt.Sprintf("%s@%s is required in go.mod but not marked as explicit in vendor/modules.txt", r.Mod.Path, r.Mod.Version))
+		}
+	}
+	replaced := make(map[string]bool)
+	for _, r := range f.Replace {
+		replaced[r.Old.Path] = true
+		v := vendored[r.Old.Path]
+		if v == nil || r.Old.Version != "" && r.Old.Version != v.Version {
+			// Replacements of modules that are not vendored don't matter
+			continue
+		}
+		if expected := strings.TrimSpace(r.New.Path + " " + r.New.Version); v.Replacement != expected {
+			problems = append(problems, fmt.Sprintf("%s is replaced by %s in go.mod but by %q in vendor/modules.txt", r.Old.Path, expected, v.Replacement))
+		}
+	}
+	modPaths := make(map[string]struct{})
+	for modPath := range vendored {
+		modPaths[modPath] = struct{}{}
+	}
+	for _, modPath := range GetSortedKeys(modPaths) {
+		v := vendored[modPath]
+		if v.Explicit && !required[modPath] {
+			problems = append(problems, fmt.Sprintf("%s is marked as explicit in vendor/modules.txt but not required in go.mod", modPath))
+		}
+		if v.Replacement != "" && !replaced[modPath] {
+			problems = append(problems, fmt.Sprintf("%s is replaced in vendor/modules.txt but not in go.mod", modPath))
+		}
+	}
+	return problems
+}
+
+// Returns the inconsistencies between the go.mod files of src and their
+// vendor/modules.txt, as "file: problem" lines
+func CheckVendor(src FileSource, projectDir string, logger Logger) ([]string, error) {
+	g := &Graph{ProjectDir: projectDir, log: logger}
+	g.loadModules(src)
+	var problems []string
+	for _, m := range g.Modules {
+		// The vendor directory of a workspace is checked against go.work by the go command
+		if !m.Vendor || Contains(g.Workspace, m.Dir) {
+			continue
+		}
+		f, err := parseGoMod(src, path.Join(m.Dir, "go.mod"))
+		if err != nil {
+			return nil, err
+		}
+		file := path.Join(m.Dir, "vendor/modules.txt")
+		content, err := src.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		for _, problem := range checkVendorConsistency(f, content) {
+			problems = append(problems, fmt.Sprintf("%s: %s", file, problem))
+		}
+	}
+	return problems, nil
+}
@@ -0,0 +1,103 @@
+package graph
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"golang.org/x/mod/modfile"
+)
+
+var vendorRepo = MapSource{
+	"vendor/github.com/x/y/y.go":     "package y\n\nimport \"github.com/x/z\"\n",
+	"vendor/github.com/x/y/LICENSE":  "",
+	"vendor/github.com/x/z/z.go":     "package z\n",
+	"svc/main.go":                    "package main\n\nimport \"github.com/x/y\"\n",
+	"svc/sub/sub.go":                 "package sub\n\nimport \"github.com/x/z\"\n",
+	"svc/vendor/github.com/x/z/z.go": "package z\n",
+	"lib/lib.go":                     "package lib\n",
+	"lib/lib_test.go":                "package lib\n\nimport \"github.com/x/z\"\n",
+	"other/other.go":                 "package other\n",
+}
+
+func TestVendorGraph(t *testing.T) {
+	g := mustBuild(t, vendorRepo, "github.com/org/repo")
+
+	cases := map[string][]string{
+		"svc":     {"vendor/github.com/x/y"},
+		"svc/sub": {"svc/vendor/github.com/x/z"},
+		"lib":     {},
+	}
+	for dir, expected := range cases {
+		if imports := g.Packages[dir].VendorImports; !reflect.DeepEqual(imports, expected) {
+			t.Errorf("vendored imports of %s should be %v but got %v", dir, expected, imports)
+		}
+	}
+	if imports := g.Packages["lib"].TestVendorImports; !reflect.DeepEqual(imports, []string{"vendor/github.com/x/z"}) {
+		t.Error("unexpected vendored test imports of lib:", imports)
+	}
+	if imports := g.Vendor["vendor/github.com/x/y"].VendorImports; !reflect.DeepEqual(imports, []string{"vendor/github.com/x/z"}) {
+		t.Error("unexpected vendored imports of y:", imports)
+	}
+
+	affected := map[string][]string{
+		"vendor/github.com/x/z/z.go":     {"lib", "svc"},
+		"vendor/github.com/x/y/LICENSE":  {"svc"},
+		"svc/vendor/github.com/x/z/z.go": {"svc/sub"},
+		"vendor/modules.txt":             {},
+	}
+	for file, expected := range affected {
+		if res := g.AffectedPackages([]string{file}, Inputs{}); !reflect.DeepEqual(res, expected) {
+			t.Errorf("packages affected by %s should be %v but got %v", file, expected, res)
+		}
+	}
+}
+
+func TestModuleVendor(t *testing.T) {
+	repo := MapSource{
+		"go.mod":                     "module github.com/org/repo\n\ngo 1.21\n\nrequire github.com/x/y v1.0.0\n",
+		"vendor/modules.txt":         "# github.com/x/y v1.0.0\n## explicit\ngithub.com/x/y\n",
+		"vendor/github.com/x/y/y.go": "package y\n",
+		"svc/main.go":                "package main\n\nimport \"github.com/x/y\"\n",
+	}
+	g := mustBuild(t, repo, "github.com/org/repo")
+	if imports := g.Packages["svc"].VendorImports; !reflect.DeepEqual(imports, []string{"vendor/github.com/x/y"}) {
+		t.Error("unexpected vendored imports with modules.txt:", imports)
+	}
+	if imports := g.Packages["svc"].ExternalImports; !reflect.DeepEqual(imports, []string{"github.com/x/y"}) {
+		t.Error("vendored imports should still be external:", imports)
+	}
+
+	// Without modules.txt, the go command doesn't use the vendor directory
+	delete(repo, "vendor/modules.txt")
+	g = mustBuild(t, repo, "github.com/org/repo")
+	if imports := g.Packages["svc"].VendorImports; len(imports) != 0 {
+		t.Error("the vendor directory should be ignored without modules.txt, got", imports)
+	}
+}
+
+func TestCheckVendorConsistency(t *testing.T) {
+	goMod := "module github.com/org/repo\n\ngo 1.21\n\nrequire (\n\tgithub.com/x/y v1.0.0\n\tgithub.com/x/z v1.2.0\n)\n\nreplace github.com/x/z => ../z\n"
+	f, err := modfile.Parse("go.mod", []byte(goMod), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		modulesTxt string
+		problems   []string
+	}{
+		{"# github.com/x/y v1.0.0\n## explicit\ngithub.com/x/y\n# github.com/x/z v1.2.0 => ../z\n## explicit; go 1.21\ngithub.com/x/z\n", nil},
+		{"# github.com/x/y v1.0.1\n## explicit\ngithub.com/x/y\n# github.com/x/z v1.2.0 => ../z\n## explicit\n", []string{"github.com/x/y@v1.0.0 is required in go.mod but vendor/modules.txt has v1.0.1"}},
+		{"# github.com/x/y v1.0.0\ngithub.com/x/y\n# github.com/x/z v1.2.0\n## explicit\n# github.com/x/w v0.1.0\n## explicit\n", []string{
+			"github.com/x/y@v1.0.0 is required in go.mod but not marked as explicit in vendor/modules.txt",
+			"github.com/x/z is replaced by ../z in go.mod but by \"\" in vendor/modules.txt",
+			"github.com/x/w is marked as explicit in vendor/modules.txt but not required in go.mod",
+		}},
+		{"# github.com/x/z v1.2.0 => ../z\n## explicit\n", []string{"github.com/x/y@v1.0.0 is required in go.mod but missing in vendor/modules.txt"}},
+	}
+	for _, c := range cases {
+		if problems := checkVendorConsistency(f, []byte(c.modulesTxt)); !reflect.DeepEqual(problems, c.problems) {
+			t.Errorf("problems of %q should be:\n%s\nbut got:\n%s", c.modulesTxt, strings.Join(c.problems, "\n"), strings.Join(problems, "\n"))
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/rightscale/ci/gdc/graph"
+)
+
+var testRepo = graph.MapSource{
+	"glide.yaml":             "",
+	"README.md":              "",
+	"svc/main.go":            "package main\nimport (\n\"fmt\"\n\"github.com/org/repo/lib/a\"\n)\n",
+	"svc/main_test.go":       "package main\nimport \"github.com/org/repo/lib/testutil\"\n",
+	"svc/Dockerfile":         "FROM golang AS build\nCOPY . /go/src/github.com/org/repo\nCOPY config/*.yml \\\n  /etc/svc/\nFROM alpine\nCOPY --from=build /go/bin/svc /svc\n",
+	"svc/sub/sub.go":         "package sub\n",
+	"lib/a/a.go":             "package a\nimport \"github.com/org/repo/lib/b\"\n",
+	"lib/a/a_test.go":        "package a\nimport \"github.com/org/repo/lib/c\"\n",
+	"lib/a/data.json":        "{}",
+	"lib/a/README.md":        "",
+	"lib/b/b.go":             "package b\n",
+	"lib/c/c.go":             "package c\n",
+	"lib/testutil/util.go":   "package testutil\n",
+	"other/other.go":         "package other\nimport \"github.com/org/repo/lib/c\"\n",
+	"config/app.yml":         "",
+	"config/other.txt":       "",
+	"vendor/x/y/y.go":        "package y\n",
+	"vendor/x/y/internal.go": "package y\nimport \"github.com/org/repo/lib/c\"\n",
+}
+
+func TestContextFiles(t *testing.T) {
+	g := buildGraph(testRepo, "github.com/org/repo")
+	files, err := contextFiles(g, testRepo, "svc", "svc/Dockerfile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"README.md",
+		"config/app.yml",
+		"glide.yaml",
+		"lib/a/a.go",
+		"lib/b/b.go",
+		"svc/Dockerfile",
+		"svc/main.go",
+		"svc/main_test.go",
+		"svc/sub/sub.go",
+		"vendor/x/y/internal.go",
+		"vendor/x/y/y.go",
+	}
+	if !reflect.DeepEqual(files, expected) {
+		t.Error("context files should be", expected, "but got", files)
+	}
+}
@@ -0,0 +1,196 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2017 RightScale, Inc, All Rights Reserved Worldwide.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// graphDiff is the structural difference between two exported graphs
+type graphDiff struct {
+	AddedNodes   []string     `json:"added_nodes"`
+	RemovedNodes []string     `json:"removed_nodes"`
+	AddedEdges   []exportEdge `json:"added_edges"`
+	RemovedEdges []exportEdge `json:"removed_edges"`
+	Unused       []string     `json:"unused"` // nodes nothing depends on anymore
+}
+
+// Returns what changed from graph a to graph b
+func diffGraphs(a, b exportGraph) graphDiff {
+	d := graphDiff{AddedNodes: []string{}, RemovedNodes: []string{}, AddedEdges: []exportEdge{}, RemovedEdges: []exportEdge{}, Unused: []string{}}
+	nodesA, nodesB := make(map[string]bool), make(map[string]bool)
+	for _, node := range a.Nodes {
+		nodesA[node.ID] = true
+	}
+	for _, node := range b.Nodes {
+		nodesB[node.ID] = true
+		if !nodesA[node.ID] {
+			d.AddedNodes = append(d.AddedNodes, node.ID)
+		}
+	}
+	for _, node := range a.Nodes {
+		if !nodesB[node.ID] {
+			d.RemovedNodes = append(d.RemovedNodes, node.ID)
+		}
+	}
+
+	edgesA, edgesB := make(map[exportEdge]bool), make(map[exportEdge]bool)
+	usedA, usedB := make(map[string]bool), make(map[string]bool)
+	for _, e := range a.Edges {
+		edgesA[e] = true
+		usedA[e.To] = true
+	}
+	for _, e := range b.Edges {
+		edgesB[e] = true
+		usedB[e.To] = true
+		if !edgesA[e] {
+			d.AddedEdges = append(d.AddedEdges, e)
+		}
+	}
+	for _, e := range a.Edges {
+		if !edgesB[e] {
+			d.RemovedEdges = append(d.RemovedEdges, e)
+		}
+	}
+	for _, node := range b.Nodes {
+		if usedA[node.ID] && !usedB[node.ID] {
+			d.Unused = append(d.Unused, node.ID)
+		}
+	}
+	return d
+}
+
+func (d graphDiff) empty() bool {
+	return len(d.AddedNodes)+len(d.RemovedNodes)+len(d.AddedEdges)+len(d.RemovedEdges)+len(d.Unused) == 0
+}
+
+func (e exportEdge) String() string {
+	if e.Test {
+		return e.From + " -> " + e.To + " (test)"
+	}
+	return e.From + " -> " + e.To
+}
+
+// diffSection is a list of a printed graphDiff
+type diffSection struct {
+	Title  string
+	Prefix string // + for additions, - for removals
+	Items  []string
+}
+
+// Returns the non empty sections of the diff
+func (d graphDiff) sections() []diffSection {
+	edges := func(list []exportEdge) []string {
+		var res []string
+		for _, e := range list {
+			res = append(res, e.String())
+		}
+		return res
+	}
+	var res []diffSection
+	for _, s := range []diffSection{
+		{"Added nodes", "+", d.AddedNodes},
+		{"Removed nodes", "-", d.RemovedNodes},
+		{"Added edges", "+", edges(d.AddedEdges)},
+		{"Removed edges", "-", edges(d.RemovedEdges)},
+		{"Unused nodes", " ", d.Unused},
+	} {
+		if len(s.Items) > 0 {
+			res = append(res, s)
+		}
+	}
+	return res
+}
+
+// Returns the diff as plain text, + and - prefixing what's added and removed
+func (d graphDiff) text() string {
+	if d.empty() {
+		return "No dependency graph changes\n"
+	}
+	var b strings.Builder
+	for _, s := range d.sections() {
+		fmt.Fprintf(&b, "%s:\n", s.Title)
+		for _, item := range s.Items {
+			fmt.Fprintf(&b, "  %s %s\n", s.Prefix, item)
+		}
+	}
+	return b.String()
+}
+
+// Returns the diff as Markdown, for pull request comments
+func (d graphDiff) markdown() string {
+	var b strings.Builder
+	b.WriteString("### Dependency graph changes\n\n")
+	if d.empty() {
+		b.WriteString("No changes.\n")
+		return b.String()
+	}
+	for _, s := range d.sections() {
+		fmt.Fprintf(&b, "**%s** (%d)\n\n", s.Title, len(s.Items))
+		for _, item := range s.Items {
+			fmt.Fprintf(&b, "- `%s`\n", item)
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// Implements "gdc graph-diff"
+func graphDiffCommand(args []string) {
+	fs := flag.NewFlagSet("graph-diff", flag.ExitOnError)
+	format := fs.String("format", "text", "output format: text, markdown or json")
+	var opts exportOptions
+	fs.IntVar(&opts.Depth, "depth", 0, "collapse nodes by directory, keeping this number of path elements")
+	fs.StringVar(&opts.Edges, "edges", "all", "edges to compare: all, prod or test")
+	fs.Usage = func() {
+		fmt.Println("Usage: gdc graph-diff [-format text|markdown|json] [-depth N] [-edges all|prod|test] <sha1> <sha2>")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	// Unlike the other commands, the order of the commits matters
+	if fs.NArg() != 2 {
+		fs.Usage()
+		os.Exit(1)
+	}
+	sha1, sha2 := fs.Arg(0), fs.Arg(1)
+	exitOnUnknownEdges(opts.Edges)
+
+	projectDir := getCurrentRelativePath()
+	a := newExportGraph(buildGraph(newTreeSource(sha1), projectDir), opts)
+	b := newExportGraph(buildGraph(newTreeSource(sha2), projectDir), opts)
+	d := diffGraphs(a, b)
+	switch *format {
+	case "text":
+		fmt.Print(d.text())
+	case "markdown":
+		fmt.Print(d.markdown())
+	case "json":
+		printJSON(d)
+	default:
+		fmt.Printf("ERROR! Unknown format %s\n", *format)
+		os.Exit(1)
+	}
+}
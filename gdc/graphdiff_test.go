@@ -0,0 +1,53 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiffGraphs(t *testing.T) {
+	before := buildGraph(testRepo, "github.com/org/repo")
+	after := testRepo.Copy()
+	// lib/a stops importing lib/b, svc/sub imports the new lib/d
+	after["lib/a/a.go"] = "package a\n"
+	after["svc/sub/sub.go"] = "package sub\nimport \"github.com/org/repo/lib/d\"\n"
+	after["lib/d/d.go"] = "package d\n"
+	delete(after, "other/other.go")
+
+	opts := exportOptions{Edges: "all"}
+	d := diffGraphs(newExportGraph(before, opts), newExportGraph(buildGraph(after, "github.com/org/repo"), opts))
+	expected := graphDiff{
+		AddedNodes:   []string{"go:lib/d"},
+		RemovedNodes: []string{"go:other"},
+		AddedEdges:   []exportEdge{{From: "go:svc/sub", To: "go:lib/d"}},
+		RemovedEdges: []exportEdge{{From: "go:lib/a", To: "go:lib/b"}, {From: "go:other", To: "go:lib/c"}},
+		Unused:       []string{"go:lib/b"},
+	}
+	if !reflect.DeepEqual(d, expected) {
+		t.Errorf("diff should be\n%+v\nbut got\n%+v", expected, d)
+	}
+
+	expectedText := `Added nodes:
+  + go:lib/d
+Removed nodes:
+  - go:other
+Added edges:
+  + go:svc/sub -> go:lib/d
+Removed edges:
+  - go:lib/a -> go:lib/b
+  - go:other -> go:lib/c
+Unused nodes:
+    go:lib/b
+`
+	if text := d.text(); text != expectedText {
+		t.Errorf("unexpected text:\n%s", text)
+	}
+	expectedMarkdown := "### Dependency graph changes\n\n**Added nodes** (1)\n\n- `go:lib/d`\n\n**Removed nodes** (1)\n\n- `go:other`\n\n**Added edges** (1)\n\n- `go:svc/sub -> go:lib/d`\n\n**Removed edges** (2)\n\n- `go:lib/a -> go:lib/b`\n- `go:other -> go:lib/c`\n\n**Unused nodes** (1)\n\n- `go:lib/b`\n\n"
+	if markdown := d.markdown(); markdown != expectedMarkdown {
+		t.Errorf("unexpected Markdown:\n%s", markdown)
+	}
+
+	if d := diffGraphs(newExportGraph(before, opts), newExportGraph(before, opts)); !d.empty() || d.text() != "No dependency graph changes\n" {
+		t.Error("a graph should not differ from itself, got", d)
+	}
+}
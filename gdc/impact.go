@@ -0,0 +1,462 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2017 RightScale, Inc, All Rights Reserved Worldwide.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/src-d/go-git.v4/plumbing/format/diff"
+
+	"github.com/rightscale/ci/gdc/graph"
+	"github.com/rightscale/ci/gdc/repo"
+)
+
+// impactConfig is the "impact" section of .gdc.yml
+type impactConfig struct {
+	Index string `yaml:"index"` // file of the test impact index
+}
+
+func (ic *impactConfig) setDefaults() error {
+	if ic.Index == "" {
+		ic.Index = ".gdc/impact.json"
+	}
+	return nil
+}
+
+// lineRange is an inclusive range of covered lines
+type lineRange [2]int
+
+// impactIndex maps every test to the lines it covers, as collected at the Base commit
+type impactIndex struct {
+	Base    string                            `json:"base"`
+	Tests   map[string]map[string][]lineRange `json:"tests"`             // "<pkg> <Test>" -> file -> lines
+	Unknown []string                          `json:"unknown,omitempty"` // tests whose coverage could not be collected, always selected
+}
+
+func testID(pkg, test string) string {
+	return pkg + " " + test
+}
+
+func splitTestID(id string) (pkg, test string) {
+	i := strings.LastIndex(id, " ")
+	return id[:i], id[i+1:]
+}
+
+// Parses a coverage profile, returning the covered lines by repo file.
+// Files outside of the repo, for which importDir returns "", are ignored
+func parseCoverProfile(r io.Reader, importDir func(string) string) (map[string][]lineRange, error) {
+	covered := make(map[string][]lineRange)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" || strings.HasPrefix(line, "mode:") {
+			continue
+		}
+		// file.go:startLine.startCol,endLine.endCol numStmts count
+		colon := strings.LastIndex(line, ":")
+		if colon < 0 {
+			return nil, fmt.Errorf("invalid coverage line %q", line)
+		}
+		fields := strings.Fields(line[colon+1:])
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("invalid coverage line %q", line)
+		}
+		if fields[2] == "0" {
+			continue
+		}
+		var start, end, startCol, endCol int
+		if _, err := fmt.Sscanf(fields[0], "%d.%d,%d.%d", &start, &startCol, &end, &endCol); err != nil {
+			return nil, fmt.Errorf("invalid coverage block %q: %v", fields[0], err)
+		}
+		importPath := line[:colon]
+		dir := importDir(path.Dir(importPath))
+		if dir == "" {
+			continue
+		}
+		file := path.Join(dir, path.Base(importPath))
+		covered[file] = append(covered[file], lineRange{start, end})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	for file, ranges := range covered {
+		covered[file] = mergeRanges(ranges)
+	}
+	return covered, nil
+}
+
+// Sorts and merges overlapping or adjacent ranges
+func mergeRanges(ranges []lineRange) []lineRange {
+	sort.Slice(ranges, func(i, j int) bool { return ranges[i][0] < ranges[j][0] })
+	var res []lineRange
+	for _, r := range ranges {
+		if n := len(res); n > 0 && r[0] <= res[n-1][1]+1 {
+			if r[1] > res[n-1][1] {
+				res[n-1][1] = r[1]
+			}
+			continue
+		}
+		res = append(res, r)
+	}
+	return res
+}
+
+// Returns the lines of the old version of a file touched by a diff: modified
+// and deleted lines, and the lines around insertions
+func chunkLines(chunks []diff.Chunk) []int {
+	var lines []int
+	line := 1
+	for _, chunk := range chunks {
+		n := strings.Count(chunk.Content(), "\n")
+		if !strings.HasSuffix(chunk.Content(), "\n") && chunk.Content() != "" {
+			n++
+		}
+		switch chunk.Type() {
+		case diff.Equal:
+			line += n
+		case diff.Delete:
+			for i := 0; i < n; i++ {
+				lines = append(lines, line+i)
+			}
+			line += n
+		case diff.Add:
+			if line > 1 {
+				lines = append(lines, line-1)
+			}
+			lines = append(lines, line)
+		}
+	}
+	return uniqueInts(lines)
+}
+
+func uniqueInts(list []int) []int {
+	sort.Ints(list)
+	var res []int
+	for i, n := range list {
+		if i == 0 || n != list[i-1] {
+			res = append(res, n)
+		}
+	}
+	return res
+}
+
+// Returns the lines of the from version of every file changed between two commits
+func changedLines(from, to string) map[string][]int {
+	patch, err := getRepo().Patch(context.Background(), repo.Range{From: from, To: to})
+	exitOnError(err)
+
+	res := make(map[string][]int)
+	for _, fpatch := range patch.FilePatches() {
+		fromFile, _ := fpatch.Files()
+		if fromFile == nil {
+			continue // new files are not covered by anything yet
+		}
+		res[fromFile.Path()] = chunkLines(fpatch.Chunks())
+	}
+	return res
+}
+
+// Returns the tests covering one of the lines, by package. Files listed in
+// stale changed since the index was built: every test covering them is
+// returned. Tests of unknown coverage are always returned
+func (idx *impactIndex) query(lines map[string][]int, stale []string) map[string][]string {
+	res := make(map[string][]string)
+	for id, files := range idx.Tests {
+		if idx.covers(files, lines, stale) {
+			pkg, test := splitTestID(id)
+			res[pkg] = append(res[pkg], test)
+		}
+	}
+	for _, id := range idx.Unknown {
+		pkg, test := splitTestID(id)
+		res[pkg] = append(res[pkg], test)
+	}
+	for pkg := range res {
+		sort.Strings(res[pkg])
+	}
+	return res
+}
+
+func (idx *impactIndex) covers(files map[string][]lineRange, lines map[string][]int, stale []string) bool {
+	for file, ranges := range files {
+		if contains(stale, file) {
+			return true
+		}
+		for _, line := range lines[file] {
+			for _, r := range ranges {
+				if line >= r[0] && line <= r[1] {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// Returns the indexed files changed between the base of the index and rev,
+// their line numbers can't be trusted anymore
+func (idx *impactIndex) staleFiles(rev string) []string {
+	if expandSHA(rev) == idx.Base {
+		return nil
+	}
+	indexed := make(map[string]bool)
+	for _, files := range idx.Tests {
+		for file := range files {
+			indexed[file] = true
+		}
+	}
+	var stale []string
+	for _, file := range changedPaths(idx.Base, rev) {
+		if indexed[file] {
+			stale = append(stale, file)
+		}
+	}
+	return stale
+}
+
+func loadImpactIndex(file string) (*impactIndex, error) {
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	idx := &impactIndex{}
+	if err := json.Unmarshal(content, idx); err != nil {
+		return nil, fmt.Errorf("corrupted impact index %s: %v", file, err)
+	}
+	if idx.Tests == nil {
+		idx.Tests = make(map[string]map[string][]lineRange)
+	}
+	return idx, nil
+}
+
+func (idx *impactIndex) save(file string) error {
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return err
+	}
+	content, err := json.Marshal(idx)
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(file+".tmp", content, 0644); err != nil {
+		return err
+	}
+	return os.Rename(file+".tmp", file)
+}
+
+// Runs the tests of a package one at a time with coverage of the whole
+// project, and records what each of them covers
+func (idx *impactIndex) collect(g *graph.Graph, dir string) error {
+	pkg := g.ImportPath(dir)
+	list := exec.Command("go", "test", "-list", "^Test", pkg)
+	list.Dir = getRepoPath()
+	out, err := list.Output()
+	if err != nil {
+		return fmt.Errorf("cannot list tests of %s: %v", pkg, err)
+	}
+	coverPkg := g.ProjectDir
+	if m := g.ModuleOfDir(dir); m != nil {
+		coverPkg = m.Path
+	}
+	if coverPkg == "" {
+		return fmt.Errorf("cannot tell the module of %s to cover, it should have a go.mod", dir)
+	}
+	tmp, err := ioutil.TempDir("", "gdc-cover")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+	profile := filepath.Join(tmp, "cover.out")
+
+	for _, test := range strings.Fields(string(out)) {
+		if !strings.HasPrefix(test, "Test") {
+			continue
+		}
+		// The profile of the previous test must not be taken for this one's
+		if err := os.Remove(profile); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		cmd := exec.Command("go", "test", "-count=1", "-run", "^"+test+"$", "-coverpkg", coverPkg+"/...", "-coverprofile", profile, pkg)
+		cmd.Dir = getRepoPath()
+		if output, err := cmd.CombinedOutput(); err != nil {
+			// Failing tests still cover lines
+			fmt.Printf("WARNING! %s %s failed: %v\n%s", pkg, test, err, output)
+		}
+		content, err := ioutil.ReadFile(profile)
+		if os.IsNotExist(err) {
+			fmt.Printf("WARNING! %s %s wrote no coverage profile, it will always be selected\n", pkg, test)
+			idx.Unknown = append(idx.Unknown, testID(pkg, test))
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		covered, err := parseCoverProfile(bytes.NewReader(content), g.ImportDir)
+		if err != nil {
+			return err
+		}
+		idx.Tests[testID(pkg, test)] = covered
+		if Verbose {
+			fmt.Printf("%s %s covers %d files\n", pkg, test, len(covered))
+		}
+	}
+	return nil
+}
+
+// Removes the tests of a package from the index
+func (idx *impactIndex) forget(pkg string) {
+	for id := range idx.Tests {
+		if p, _ := splitTestID(id); p == pkg {
+			delete(idx.Tests, id)
+		}
+	}
+	var unknown []string
+	for _, id := range idx.Unknown {
+		if p, _ := splitTestID(id); p != pkg {
+			unknown = append(unknown, id)
+		}
+	}
+	idx.Unknown = unknown
+}
+
+// Returns the path of the index file
+func impactIndexPath() string {
+	file := getConfig().Impact.Index
+	if !filepath.IsAbs(file) {
+		file = filepath.Join(getRepoPath(), file)
+	}
+	return file
+}
+
+// Implements "gdc impact"
+func impactCommand(args []string) {
+	usage := func() {
+		fmt.Println("Usage: gdc impact build [<dir>...]")
+		fmt.Println("       gdc impact update")
+		fmt.Println("       gdc impact add <pkg> <Test> <coverprofile>")
+		fmt.Println("       gdc impact query [<sha1>..<sha2>]")
+		fmt.Println("       gdc impact status")
+		os.Exit(1)
+	}
+	if len(args) == 0 {
+		usage()
+	}
+	file := impactIndexPath()
+	head := expandSHA("HEAD")
+
+	switch args[0] {
+	case "build":
+		g := getRepoGraph()
+		dirs := args[1:]
+		if len(dirs) == 0 {
+			for dir, node := range g.Packages {
+				if len(node.TestGoFiles) > 0 {
+					dirs = append(dirs, dir)
+				}
+			}
+			sort.Strings(dirs)
+		}
+		idx := &impactIndex{Base: head, Tests: make(map[string]map[string][]lineRange)}
+		for _, dir := range dirs {
+			exitOnError(idx.collect(g, path.Clean(filepath.ToSlash(dir))))
+		}
+		exitOnError(idx.save(file))
+		fmt.Printf("Indexed %d tests at %s\n", len(idx.Tests), head)
+	case "update":
+		idx, err := loadImpactIndex(file)
+		exitOnError(err)
+		if idx.Base == head {
+			fmt.Println("Impact index is up to date")
+			return
+		}
+		g := getRepoGraph()
+		dirs := g.AffectedTestPackages(changedPaths(idx.Base, head), getConfig().Inputs)
+		for _, dir := range dirs {
+			if node := g.Packages[dir]; node != nil && len(node.TestGoFiles) > 0 {
+				idx.forget(g.ImportPath(dir))
+				exitOnError(idx.collect(g, dir))
+			}
+		}
+		idx.Base = head
+		exitOnError(idx.save(file))
+		fmt.Printf("Updated the tests of %d packages, index now at %s\n", len(dirs), head)
+	case "add":
+		if len(args) != 4 {
+			usage()
+		}
+		idx, err := loadImpactIndex(file)
+		if os.IsNotExist(err) {
+			idx, err = &impactIndex{Base: head, Tests: make(map[string]map[string][]lineRange)}, nil
+		}
+		exitOnError(err)
+		f, err := os.Open(args[3])
+		exitOnError(err)
+		defer f.Close()
+		covered, err := parseCoverProfile(f, getRepoGraph().ImportDir)
+		exitOnError(err)
+		id := testID(args[1], args[2])
+		idx.Tests[id] = covered
+		idx.Unknown = graph.Subtract(idx.Unknown, []string{id})
+		exitOnError(idx.save(file))
+	case "query":
+		idx, err := loadImpactIndex(file)
+		exitOnError(err)
+		from, to := idx.Base, head
+		if len(args) > 1 {
+			from, to, err = parseRange(args[1])
+			exitOnError(err)
+		}
+		stale := idx.staleFiles(from)
+		if len(stale) > 0 {
+			fmt.Fprintf(os.Stderr, "WARNING! Impact index built at %s is stale for %d files, all their tests are selected\n", idx.Base, len(stale))
+		}
+		selected := idx.query(changedLines(from, to), stale)
+		printSelectedTests(selected)
+	case "status":
+		idx, err := loadImpactIndex(file)
+		exitOnError(err)
+		stale := idx.staleFiles("HEAD")
+		fmt.Printf("Impact index of %d tests built at %s\n", len(idx.Tests), idx.Base)
+		if len(stale) > 0 {
+			fmt.Printf("Stale: %d indexed files changed since, run gdc impact update\n", len(stale))
+			for _, f := range stale {
+				fmt.Println("  " + f)
+			}
+			os.Exit(1)
+		}
+		fmt.Println("Up to date with HEAD")
+	default:
+		usage()
+	}
+}
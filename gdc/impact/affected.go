@@ -0,0 +1,163 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2017 RightScale, Inc, All Rights Reserved Worldwide.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Package impact computes what the changes of a commit range affect: the Go
+// packages, their tests and the nodes of the other ecosystems
+package impact
+
+import (
+	"context"
+
+	"github.com/rightscale/ci/gdc/graph"
+	"github.com/rightscale/ci/gdc/repo"
+)
+
+// Options selects how affected packages are computed
+type Options struct {
+	Tests            bool // list the packages whose tests are affected
+	Precise          bool // work at the declaration level, see PreciseAffectedPackages
+	IgnoreFormatting bool // drop the changes leaving the AST of Go files untouched
+
+	ProjectDir string               // import path of the repo root without go.mod files
+	Inputs     graph.Inputs         // global and extra inputs of the targets
+	Generate   []graph.GenerateRule // configured generators, see graph.GenerateRules
+	Logger     graph.Logger         // nil discards the messages
+}
+
+// Result is the outcome of an affected computation
+type Result struct {
+	Graph     *graph.Graph `json:"-"`
+	Changed   []string     `json:"changed"`
+	Dropped   []string     `json:"dropped"`   // changed files ignored, see Options.IgnoreFormatting
+	Generated []string     `json:"generated"` // generated files changed through their generator inputs, see graph.GenerateRule
+	Packages  []string     `json:"packages"`
+	Nodes     []string     `json:"nodes"` // affected nodes of the other analyzers, see graph.Analyzer
+}
+
+// Changes are the files changed in a commit range, as the analysis sees them
+type Changes struct {
+	Raw       []string // changed files, without the dropped ones
+	Dropped   []string // Go files whose changes only touch formatting or comments, see Options.IgnoreFormatting
+	Generated []string // generated files of the working directory whose generator inputs changed
+	Changed   []string // Raw with the files go.mod changes reach and the generated files
+
+	from, to *repo.TreeSource
+}
+
+// Returns the trees of both ends of a range, loading them the first time
+func (c *Changes) trees(ctx context.Context, r *repo.Repo, rng repo.Range) (from, to *repo.TreeSource, err error) {
+	if c.from == nil {
+		if c.from, err = r.Tree(ctx, rng.From); err != nil {
+			return nil, nil, err
+		}
+		if c.to, err = r.Tree(ctx, rng.To); err != nil {
+			return nil, nil, err
+		}
+	}
+	return c.from, c.to, nil
+}
+
+// Returns the files changed in a range. Changes to go.mod files are resolved
+// to the files of the packages importing the changed modules in g, and
+// generated files of the working directory change with their generator inputs
+func Changed(ctx context.Context, r *repo.Repo, rng repo.Range, g *graph.Graph, opts Options) (*Changes, error) {
+	log := g.Logger()
+	raw, err := r.ChangedFiles(ctx, rng)
+	if err != nil {
+		return nil, err
+	}
+	c := &Changes{Raw: raw}
+	if opts.IgnoreFormatting {
+		from, to, err := c.trees(ctx, r, rng)
+		if err != nil {
+			return nil, err
+		}
+		c.Raw, c.Dropped = FilterFormattingChanges(from, to, raw)
+		if len(c.Dropped) > 0 {
+			log.Printf("DROPPED (formatting or comments only) ==============\n")
+			for _, file := range c.Dropped {
+				log.Printf("  %s \n", file)
+			}
+		}
+	}
+
+	changed := c.Raw
+	if graph.GoModChanged(changed) {
+		from, to, err := c.trees(ctx, r, rng)
+		if err != nil {
+			return nil, err
+		}
+		changed = g.ResolveGoModChanges(from, to, changed)
+	}
+	src, err := graph.NewDirSource(r.Path)
+	if err != nil {
+		return nil, err
+	}
+	c.Generated = graph.GeneratedByChanges(src, graph.GenerateRules(src, opts.Generate), changed)
+	if len(c.Generated) > 0 {
+		log.Printf("GENERATED (from changed generator inputs) ==========\n")
+		for _, file := range c.Generated {
+			log.Printf("  %s \n", file)
+		}
+	}
+	c.Changed = graph.UniqueSorted(append(changed, c.Generated...))
+	return c, nil
+}
+
+// Returns what the changes of a range affect in the working directory of r
+func Affected(ctx context.Context, r *repo.Repo, rng repo.Range, opts Options) (*Result, error) {
+	src, err := graph.NewDirSource(r.Path)
+	if err != nil {
+		return nil, err
+	}
+	g, err := graph.Build(ctx, src, opts.ProjectDir, graph.Options{Logger: opts.Logger})
+	if err != nil {
+		return nil, err
+	}
+	c, err := Changed(ctx, r, rng, g, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var affected []string
+	if opts.Precise {
+		from, to, err := c.trees(ctx, r, rng)
+		if err != nil {
+			return nil, err
+		}
+		if affected, err = PreciseAffectedPackages(ctx, g, from, to, c.Changed, opts.Inputs, nil); err != nil {
+			return nil, err
+		}
+	} else {
+		affected = g.AffectedPackages(c.Changed, opts.Inputs)
+	}
+	if opts.Tests {
+		affected = g.WithTestImporters(affected)
+	}
+	nodes := []string{}
+	for _, id := range g.AffectedNodes(c.Changed) {
+		if g.Nodes[id].Kind != graph.GoKind {
+			nodes = append(nodes, id)
+		}
+	}
+	return &Result{Graph: g, Changed: c.Changed, Dropped: c.Dropped, Generated: c.Generated, Packages: affected, Nodes: nodes}, nil
+}
@@ -0,0 +1,45 @@
+package impact
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/rightscale/ci/gdc/internal/repotest"
+	"github.com/rightscale/ci/gdc/repo"
+)
+
+func TestAffected(t *testing.T) {
+	dir, g, cleanup := repotest.Init(t)
+	defer cleanup()
+	first := repotest.CommitFiles(t, g, dir, map[string]string{
+		"go.mod":        "module github.com/org/repo\n",
+		"lib/lib.go":    "package lib\n",
+		"svc/main.go":   "package main\n\nimport _ \"github.com/org/repo/lib\"\n",
+		"other/main.go": "package main\n",
+	})
+	second := repotest.CommitFiles(t, g, dir, map[string]string{"lib/lib.go": "package lib\n\nvar X = 1\n"})
+
+	ctx := context.Background()
+	r, err := repo.Open(ctx, filepath.Join(dir, "svc"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := Affected(ctx, r, repo.Range{From: first, To: second}, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(res.Changed, []string{"lib/lib.go"}) {
+		t.Error("unexpected changed files", res.Changed)
+	}
+	if expected := []string{"lib", "svc"}; !reflect.DeepEqual(res.Packages, expected) {
+		t.Error("expected", expected, "but got", res.Packages)
+	}
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := Affected(canceled, r, repo.Range{From: first, To: second}, Options{}); err == nil {
+		t.Error("a canceled context should fail")
+	}
+}
@@ -0,0 +1,152 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2017 RightScale, Inc, All Rights Reserved Worldwide.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package impact
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/rightscale/ci/gdc/graph"
+)
+
+var (
+	posType     = reflect.TypeOf(token.NoPos)
+	commentType = reflect.TypeOf(&ast.CommentGroup{})
+	objectType  = reflect.TypeOf(&ast.Object{})
+	scopeType   = reflect.TypeOf(&ast.Scope{})
+)
+
+// Whether two versions of a Go file only differ by formatting and comments.
+// Build constraints, //go: directives and cgo preambles are not comments
+func sameGoAST(name string, a, b []byte) bool {
+	fset := token.NewFileSet()
+	fa, errA := parser.ParseFile(fset, name, a, parser.ParseComments|parser.SkipObjectResolution)
+	fb, errB := parser.ParseFile(fset, name, b, parser.ParseComments|parser.SkipObjectResolution)
+	if errA != nil || errB != nil {
+		return false
+	}
+	if !reflect.DeepEqual(meaningfulComments(fa), meaningfulComments(fb)) {
+		return false
+	}
+	return equalNodes(reflect.ValueOf(fa), reflect.ValueOf(fb))
+}
+
+// Returns the comments of a file that change how it's built
+func meaningfulComments(f *ast.File) []string {
+	var res []string
+	for _, group := range f.Comments {
+		for _, c := range group.List {
+			text := c.Text
+			switch {
+			case strings.HasPrefix(text, "//go:"), strings.HasPrefix(text, "//line "):
+				res = append(res, text)
+			case strings.HasPrefix(text, "// +build") && group.End() < f.Package:
+				res = append(res, text)
+			}
+		}
+	}
+	for _, imp := range f.Imports {
+		if path, _ := strconv.Unquote(imp.Path.Value); path == "C" {
+			if imp.Doc != nil {
+				res = append(res, "cgo:"+imp.Doc.Text())
+			}
+			if gen := graph.CgoImportDecl(f, imp); gen != nil && gen.Doc != nil {
+				res = append(res, "cgo:"+gen.Doc.Text())
+			}
+		}
+	}
+	return res
+}
+
+// Compares two AST nodes, ignoring positions, comments and resolved objects
+func equalNodes(a, b reflect.Value) bool {
+	if a.Kind() != b.Kind() {
+		return false
+	}
+	switch a.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if a.IsNil() || b.IsNil() {
+			return a.IsNil() == b.IsNil()
+		}
+		if a.Kind() == reflect.Interface && a.Elem().Type() != b.Elem().Type() {
+			return false
+		}
+		return equalNodes(a.Elem(), b.Elem())
+	case reflect.Struct:
+		for i := 0; i < a.NumField(); i++ {
+			switch a.Field(i).Type() {
+			case posType, commentType, objectType, scopeType:
+				continue
+			}
+			if name := a.Type().Field(i).Name; name == "Comments" || name == "Unresolved" || name == "Imports" {
+				// Redundant or comment only fields of ast.File
+				continue
+			}
+			if !equalNodes(a.Field(i), b.Field(i)) {
+				return false
+			}
+		}
+		return true
+	case reflect.Slice:
+		if a.Len() != b.Len() {
+			return false
+		}
+		for i := 0; i < a.Len(); i++ {
+			if !equalNodes(a.Index(i), b.Index(i)) {
+				return false
+			}
+		}
+		return true
+	case reflect.String:
+		return a.String() == b.String()
+	case reflect.Bool:
+		return a.Bool() == b.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return a.Int() == b.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return a.Uint() == b.Uint()
+	default:
+		return reflect.DeepEqual(a.Interface(), b.Interface())
+	}
+}
+
+// Splits changed files between the ones that matter and the Go files whose
+// AST is the same in both sources
+func FilterFormattingChanges(srcA, srcB graph.FileSource, changed []string) (kept, dropped []string) {
+	for _, file := range changed {
+		if strings.HasSuffix(file, ".go") {
+			a, errA := srcA.ReadFile(file)
+			b, errB := srcB.ReadFile(file)
+			if errA == nil && errB == nil && sameGoAST(file, a, b) {
+				dropped = append(dropped, file)
+				continue
+			}
+		}
+		kept = append(kept, file)
+	}
+	return
+}
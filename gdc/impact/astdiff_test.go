@@ -0,0 +1,50 @@
+package impact
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/rightscale/ci/gdc/graph"
+)
+
+func TestSameGoAST(t *testing.T) {
+	base := "package a\n\nimport \"fmt\"\n\n// F prints\nfunc F(x int) {\n\tfmt.Println(x)\n}\n"
+	cases := []struct {
+		other string
+		same  bool
+	}{
+		{"package a\nimport \"fmt\"\n// F prints things\nfunc F(x int) { fmt.Println(x) /* done */ }\n", true},
+		{"package a\n\nimport \"fmt\"\n\nfunc F(y int) {\n\tfmt.Println(y)\n}\n", false},
+		{"package a\n\nimport \"fmt\"\n\nfunc F(x int) {\n\tfmt.Println(x, 1)\n}\n", false},
+		{"//go:build linux\n\npackage a\n\nimport \"fmt\"\n\nfunc F(x int) {\n\tfmt.Println(x)\n}\n", false},
+		{"// +build linux\n\npackage a\n\nimport \"fmt\"\n\nfunc F(x int) {\n\tfmt.Println(x)\n}\n", false},
+		{"package a\n\nimport \"fmt\"\n\n//go:noinline\nfunc F(x int) {\n\tfmt.Println(x)\n}\n", false},
+		{"package a\n\nimport \"fmt\"\n\nfunc F(x int) {\n\tfmt.Println(x)\n", false},
+	}
+	for _, c := range cases {
+		if res := sameGoAST("a.go", []byte(base), []byte(c.other)); res != c.same {
+			t.Errorf("sameGoAST should be %v for\n%s", c.same, c.other)
+		}
+	}
+
+	cgo := "package a\n\n// #include <stdio.h>\nimport \"C\"\n"
+	if sameGoAST("a.go", []byte(cgo), []byte("package a\n\n// #include <stdlib.h>\nimport \"C\"\n")) {
+		t.Error("cgo preamble changes should be meaningful")
+	}
+}
+
+func TestFilterFormattingChanges(t *testing.T) {
+	before := graph.MapSource{
+		"README.md":  "",
+		"lib/a/a.go": "package a\nimport \"github.com/org/repo/lib/b\"\n",
+		"lib/b/b.go": "package b\n",
+	}
+	after := before.Copy()
+	after["lib/a/a.go"] = "package a\n\n// Package a does things\nimport \"github.com/org/repo/lib/b\"\n"
+	after["lib/b/b.go"] = "package b\n\nvar X = 1\n"
+	after["README.md"] = "new"
+	kept, dropped := FilterFormattingChanges(before, after, []string{"README.md", "lib/a/a.go", "lib/b/b.go"})
+	if !reflect.DeepEqual(kept, []string{"README.md", "lib/b/b.go"}) || !reflect.DeepEqual(dropped, []string{"lib/a/a.go"}) {
+		t.Error("unexpected kept and dropped files", kept, dropped)
+	}
+}
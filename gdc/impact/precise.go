@@ -0,0 +1,451 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2017 RightScale, Inc, All Rights Reserved Worldwide.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package impact
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/importer"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"go/types"
+	"io"
+	"io/ioutil"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/rightscale/ci/gdc/graph"
+)
+
+// Key of a whole package in the symbol sets of the precise mode, used when a
+// package changed in a way that can't be narrowed down to declarations
+const wholePackage = "*"
+
+// declInfo is a package-level declaration of a type-checked package
+type declInfo struct {
+	Hash string   // hash of the declaration source, comments excluded
+	Refs []symbol // in-repo package-level declarations it references
+}
+
+// symbol is a package-level declaration: its package directory and its name,
+// Type.Method for methods
+type symbol struct {
+	Dir, Name string
+}
+
+// typeChecker type-checks the packages of a graph.FileSource. In-repo packages are
+// checked from the source, the others are given to the external importer
+type typeChecker struct {
+	src      graph.FileSource
+	g        *graph.Graph
+	fset     *token.FileSet
+	ctxt     build.Context
+	external types.Importer
+	pkgs     map[string]*types.Package
+	decls    map[string]map[string]*declInfo
+	errs     map[string]error
+}
+
+func newTypeChecker(src graph.FileSource, g *graph.Graph, external types.Importer) *typeChecker {
+	tc := &typeChecker{
+		src:   src,
+		g:     g,
+		fset:  token.NewFileSet(),
+		ctxt:  build.Default,
+		pkgs:  make(map[string]*types.Package),
+		decls: make(map[string]map[string]*declInfo),
+		errs:  make(map[string]error),
+	}
+	// Build constraints are evaluated against the files of src, not the disk
+	tc.ctxt.JoinPath = path.Join
+	tc.ctxt.OpenFile = func(name string) (io.ReadCloser, error) {
+		content, err := src.ReadFile(name)
+		if err != nil {
+			return nil, err
+		}
+		return ioutil.NopCloser(bytes.NewReader(content)), nil
+	}
+	tc.external = external
+	if tc.external == nil {
+		tc.external = importer.ForCompiler(tc.fset, "source", nil)
+	}
+	return tc
+}
+
+// Import implements types.Importer
+func (tc *typeChecker) Import(importPath string) (*types.Package, error) {
+	dir := tc.g.ImportDir(importPath)
+	if dir == "" || tc.g.Packages[dir] == nil {
+		return tc.external.Import(importPath)
+	}
+	if err := tc.check(dir); err != nil {
+		return nil, err
+	}
+	return tc.pkgs[dir], nil
+}
+
+// Type-checks the non-test files of the package in dir and records its declarations
+func (tc *typeChecker) check(dir string) error {
+	if err, ok := tc.errs[dir]; ok {
+		return err
+	}
+	if _, ok := tc.pkgs[dir]; ok {
+		return nil
+	}
+	// Guards against import cycles
+	tc.errs[dir] = fmt.Errorf("import cycle through %s", dir)
+
+	node := tc.g.Packages[dir]
+	if node == nil {
+		tc.errs[dir] = fmt.Errorf("no package in %s", dir)
+		return tc.errs[dir]
+	}
+	var files []*ast.File
+	for _, file := range node.GoFiles {
+		if ok, err := tc.ctxt.MatchFile(dir, path.Base(file)); err != nil || !ok {
+			continue
+		}
+		content, err := tc.src.ReadFile(file)
+		if err != nil {
+			tc.errs[dir] = err
+			return err
+		}
+		f, err := parser.ParseFile(tc.fset, file, content, 0)
+		if err != nil {
+			tc.errs[dir] = err
+			return err
+		}
+		files = append(files, f)
+	}
+
+	info := &types.Info{Uses: make(map[*ast.Ident]types.Object)}
+	conf := types.Config{Importer: tc, FakeImportC: true}
+	pkg, err := conf.Check(tc.g.ImportPath(dir), tc.fset, files, info)
+	if err != nil {
+		tc.errs[dir] = err
+		return err
+	}
+	delete(tc.errs, dir)
+	tc.pkgs[dir] = pkg
+	tc.decls[dir] = tc.collectDecls(files, info)
+	return nil
+}
+
+// Returns the package-level declarations of files by name
+func (tc *typeChecker) collectDecls(files []*ast.File, info *types.Info) map[string]*declInfo {
+	decls := make(map[string]*declInfo)
+	walkDecls(files, func(name string, hashed, body ast.Node) {
+		d := decls[name]
+		if d == nil {
+			d = &declInfo{}
+			decls[name] = d
+		}
+		// Several init and _ declarations can coexist, their hashes are combined
+		d.Hash = hashStrings(d.Hash, nodeHash(tc.fset, hashed))
+		d.Refs = append(d.Refs, tc.references(body, info)...)
+	})
+	return decls
+}
+
+// Calls fn for every name declared at the package level of files, with the
+// node whose source defines it and the node holding its references
+func walkDecls(files []*ast.File, fn func(name string, hashed, body ast.Node)) {
+	for _, f := range files {
+		for _, decl := range f.Decls {
+			switch decl := decl.(type) {
+			case *ast.FuncDecl:
+				fn(funcDeclName(decl), decl, decl)
+			case *ast.GenDecl:
+				for _, spec := range decl.Specs {
+					switch spec := spec.(type) {
+					case *ast.TypeSpec:
+						fn(spec.Name.Name, spec, spec)
+					case *ast.ValueSpec:
+						// The value of a constant depends on its position in the block
+						var hashed ast.Node = spec
+						if decl.Tok == token.CONST {
+							hashed = decl
+						}
+						for _, name := range spec.Names {
+							fn(name.Name, hashed, spec)
+						}
+					}
+				}
+			}
+		}
+	}
+}
+
+// Returns the name of a function declaration, Type.Method for methods
+func funcDeclName(decl *ast.FuncDecl) string {
+	if decl.Recv == nil || len(decl.Recv.List) == 0 {
+		return decl.Name.Name
+	}
+	typ := decl.Recv.List[0].Type
+	for {
+		switch t := typ.(type) {
+		case *ast.StarExpr:
+			typ = t.X
+			continue
+		case *ast.IndexExpr:
+			typ = t.X
+			continue
+		case *ast.IndexListExpr:
+			typ = t.X
+			continue
+		case *ast.Ident:
+			return t.Name + "." + decl.Name.Name
+		}
+		return decl.Name.Name
+	}
+}
+
+// Returns the in-repo package-level declarations used in node
+func (tc *typeChecker) references(node ast.Node, info *types.Info) []symbol {
+	var refs []symbol
+	ast.Inspect(node, func(n ast.Node) bool {
+		id, ok := n.(*ast.Ident)
+		if !ok {
+			return true
+		}
+		obj := info.Uses[id]
+		if obj == nil || obj.Pkg() == nil {
+			return true
+		}
+		dir := tc.g.ImportDir(obj.Pkg().Path())
+		if dir == "" {
+			return true
+		}
+		if fn, ok := obj.(*types.Func); ok {
+			if recv := fn.Type().(*types.Signature).Recv(); recv != nil {
+				if named := receiverName(recv.Type()); named != "" {
+					refs = append(refs, symbol{dir, named + "." + fn.Name()})
+				}
+				return true
+			}
+		}
+		if obj.Parent() == obj.Pkg().Scope() {
+			refs = append(refs, symbol{dir, obj.Name()})
+		}
+		return true
+	})
+	return refs
+}
+
+// Returns the name of the named type of a method receiver
+func receiverName(t types.Type) string {
+	if p, ok := t.(*types.Pointer); ok {
+		t = p.Elem()
+	}
+	if named, ok := t.(*types.Named); ok {
+		return named.Obj().Name()
+	}
+	return ""
+}
+
+// Returns a hash of the source of a node, comments excluded
+func nodeHash(fset *token.FileSet, node ast.Node) string {
+	var buf bytes.Buffer
+	printer.Fprint(&buf, fset, node)
+	return hashStrings(buf.String())
+}
+
+func hashStrings(list ...string) string {
+	h := sha256.New()
+	for _, s := range list {
+		fmt.Fprintf(h, "%d:%s", len(s), s)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Returns the names of the declarations that differ between two versions of a package
+func changedDecls(a, b map[string]*declInfo) []string {
+	var res []string
+	for name, da := range a {
+		if db, ok := b[name]; !ok || db.Hash != da.Hash {
+			res = append(res, name)
+		}
+	}
+	for name := range b {
+		if _, ok := a[name]; !ok {
+			res = append(res, name)
+		}
+	}
+	sort.Strings(res)
+	return res
+}
+
+// Returns the packages affected by the changes between two trees, at the
+// declaration level: a package importing a changed package is only affected
+// if it uses one of the changed declarations, directly or through other
+// declarations. Packages that fail to type-check are handled at the package
+// level. The candidates are the packages of g affected at the package level
+func PreciseAffectedPackages(ctx context.Context, g *graph.Graph, srcA, srcB graph.FileSource, changed []string, ic graph.Inputs, external types.Importer) ([]string, error) {
+	candidates := g.AffectedPackages(changed, ic)
+	var checkers []*typeChecker
+	for _, src := range []graph.FileSource{srcA, srcB} {
+		sg, err := graph.Build(ctx, src, g.ProjectDir, graph.Options{Logger: g.Logger()})
+		if err != nil {
+			return nil, err
+		}
+		checkers = append(checkers, newTypeChecker(src, sg, external))
+	}
+
+	changedSyms := make(map[symbol]bool)
+	direct := make(map[string]bool)
+	goChanged := make(map[string]bool)
+	for _, file := range changed {
+		if graph.IsRootFile(file) {
+			return candidates, nil
+		}
+		for _, pattern := range ic.Global {
+			if file == pattern || graph.MatchesInput(pattern, file) {
+				return candidates, nil
+			}
+		}
+		for target, patterns := range ic.Targets {
+			for _, pattern := range patterns {
+				if file == pattern || graph.MatchesInput(pattern, file) {
+					for _, dir := range g.TargetPackages(target) {
+						changedSyms[symbol{dir, wholePackage}] = true
+					}
+				}
+			}
+		}
+		if graph.IsVendored(path.Dir(file)) {
+			// Vendored packages are not type-checked, their importers change as a whole
+			if vendorDir := g.OwningVendorPackage(file); vendorDir != "" {
+				for _, dir := range g.VendorImporters(vendorDir) {
+					direct[dir] = true
+					changedSyms[symbol{dir, wholePackage}] = true
+				}
+			}
+			continue
+		}
+		for _, dir := range append(g.InputOwners(file), g.ProtoChangedPackages(file)...) {
+			direct[dir] = true
+			changedSyms[symbol{dir, wholePackage}] = true
+		}
+		// Other files of a package directory only count as embedded or native files
+		dir := path.Dir(file)
+		if g.Packages[dir] == nil || !strings.HasSuffix(file, ".go") {
+			continue
+		}
+		direct[dir] = true
+		switch {
+		case strings.HasSuffix(file, "_test.go"):
+			// Tests are never imported
+		case !graph.SameContent(srcA, srcB, file):
+			goChanged[dir] = true
+		default:
+			changedSyms[symbol{dir, wholePackage}] = true
+		}
+	}
+
+	for dir := range goChanged {
+		errA, errB := checkers[0].check(dir), checkers[1].check(dir)
+		if errA != nil || errB != nil {
+			g.Logger().Printf("Cannot type-check %s, using package granularity: %v %v\n", dir, errA, errB)
+			changedSyms[symbol{dir, wholePackage}] = true
+			continue
+		}
+		for _, name := range changedDecls(checkers[0].decls[dir], checkers[1].decls[dir]) {
+			changedSyms[symbol{dir, name}] = true
+			switch {
+			case name == "init" || name == "_":
+				// Side effects reach every importer
+				changedSyms[symbol{dir, wholePackage}] = true
+			case strings.Contains(name, "."):
+				// Values of the type may be used through an interface
+				changedSyms[symbol{dir, strings.SplitN(name, ".", 2)[0]}] = true
+			}
+		}
+	}
+
+	touched := func(dir string) bool {
+		for sym := range changedSyms {
+			if sym.Dir == dir {
+				return true
+			}
+		}
+		return false
+	}
+	isChanged := func(sym symbol) bool {
+		return changedSyms[sym] || changedSyms[symbol{sym.Dir, wholePackage}]
+	}
+
+	for progress := true; progress; {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		progress = false
+		for _, dir := range candidates {
+			if changedSyms[symbol{dir, wholePackage}] {
+				continue
+			}
+			for _, tc := range checkers {
+				if tc.g.Packages[dir] == nil {
+					continue
+				}
+				if err := tc.check(dir); err != nil {
+					// Falls back to the imports of the package
+					for _, imp := range tc.g.Packages[dir].Imports {
+						if touched(imp) {
+							changedSyms[symbol{dir, wholePackage}] = true
+							progress = true
+							break
+						}
+					}
+					continue
+				}
+				for name, decl := range tc.decls[dir] {
+					if changedSyms[symbol{dir, name}] {
+						continue
+					}
+					for _, ref := range decl.Refs {
+						if isChanged(ref) {
+							changedSyms[symbol{dir, name}] = true
+							progress = true
+							break
+						}
+					}
+				}
+			}
+		}
+	}
+
+	var res []string
+	for _, dir := range candidates {
+		if direct[dir] || touched(dir) {
+			res = append(res, dir)
+		}
+	}
+	return res, nil
+}
@@ -0,0 +1,50 @@
+package impact
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/rightscale/ci/gdc/graph"
+)
+
+var preciseRepo = graph.MapSource{
+	"lib/lib.go":      "package lib\n\ntype T struct{ A int }\n\nfunc (t T) Get() int { return t.A }\n\nfunc Used() int { return helper() }\n\nfunc Unused() int { return 1 }\n\nfunc helper() int { return 1 }\n",
+	"lib/lib_test.go": "package lib\n",
+	"app/app.go":      "package app\n\nimport \"github.com/org/repo/lib\"\n\nfunc Run() int { return lib.Used() }\n",
+	"tool/tool.go":    "package tool\n\nimport \"github.com/org/repo/lib\"\n\nfunc Run(t lib.T) int { return t.Get() }\n",
+	"cmd/main.go":     "package main\n\nimport \"github.com/org/repo/app\"\n\nfunc main() { app.Run() }\n",
+	"broken/b.go":     "package broken\n\nimport \"github.com/org/repo/lib\"\n\nvar X = lib.Missing\n",
+}
+
+func TestPreciseAffectedPackages(t *testing.T) {
+	g, err := graph.Build(context.Background(), preciseRepo, "github.com/org/repo", graph.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		file, content string
+		expected      []string
+	}{
+		// Only the comment changes
+		{"lib/lib.go", "package lib\n\n// T is a thing\ntype T struct{ A int }\n\nfunc (t T) Get() int { return t.A }\n\nfunc Used() int { return helper() }\n\nfunc Unused() int { return 1 }\n\nfunc helper() int { return 1 }\n", []string{"lib"}},
+		// Nobody uses Unused, broken does not type-check and imports lib
+		{"lib/lib.go", "package lib\n\ntype T struct{ A int }\n\nfunc (t T) Get() int { return t.A }\n\nfunc Used() int { return helper() }\n\nfunc Unused() int { return 2 }\n\nfunc helper() int { return 1 }\n", []string{"broken", "lib"}},
+		// helper is used through Used
+		{"lib/lib.go", "package lib\n\ntype T struct{ A int }\n\nfunc (t T) Get() int { return t.A }\n\nfunc Used() int { return helper() }\n\nfunc Unused() int { return 1 }\n\nfunc helper() int { return 2 }\n", []string{"app", "broken", "cmd", "lib"}},
+		// Methods
+		{"lib/lib.go", "package lib\n\ntype T struct{ A int }\n\nfunc (t T) Get() int { return t.A + 1 }\n\nfunc Used() int { return helper() }\n\nfunc Unused() int { return 1 }\n\nfunc helper() int { return 1 }\n", []string{"broken", "lib", "tool"}},
+		// Tests are never imported
+		{"lib/lib_test.go", "package lib\n\nfunc TestX() {}\n", []string{"lib"}},
+		// Files of the package directory it isn't built from change nothing
+		{"lib/data.json", "{}", nil},
+	}
+	for _, c := range cases {
+		after := preciseRepo.Copy()
+		after[c.file] = c.content
+		res, err := PreciseAffectedPackages(context.Background(), g, preciseRepo, after, []string{c.file}, graph.Inputs{}, nil)
+		if err != nil || !reflect.DeepEqual(res, c.expected) {
+			t.Error("packages affected by the change of", c.file, "should be", c.expected, "but got", res, err)
+		}
+	}
+}
@@ -0,0 +1,264 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2017 RightScale, Inc, All Rights Reserved Worldwide.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package impact
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"golang.org/x/tools/go/callgraph"
+	"golang.org/x/tools/go/callgraph/cha"
+	"golang.org/x/tools/go/callgraph/rta"
+	"golang.org/x/tools/go/packages"
+	"golang.org/x/tools/go/ssa"
+	"golang.org/x/tools/go/ssa/ssautil"
+
+	"github.com/rightscale/ci/gdc/graph"
+)
+
+// FuncKey identifies a package-level function: the path of its package
+// (with the _test suffix for external test packages) and its name,
+// Type.Method for methods
+type FuncKey struct {
+	Pkg, Name string
+}
+
+// ChangedCode is what changed between two trees, in terms of functions
+type ChangedCode struct {
+	Funcs map[FuncKey]bool
+	// Packages where something else than a function changed, all their
+	// functions are considered changed
+	Packages map[string]bool
+}
+
+// Returns the functions changed between two trees. Changes that are not
+// limited to functions (types, variables, non-Go files...) change the
+// whole package
+func ChangedFunctions(g *graph.Graph, srcA, srcB graph.FileSource, changed []string, ic graph.Inputs) ChangedCode {
+	res := ChangedCode{Funcs: make(map[FuncKey]bool), Packages: make(map[string]bool)}
+	whole := func(dirs []string) {
+		for _, dir := range dirs {
+			res.Packages[g.ImportPath(dir)] = true
+			res.Packages[g.ImportPath(dir)+"_test"] = true
+		}
+	}
+	for _, file := range changed {
+		// Root files and inputs are handled like in AffectedPackages
+		if changedPkgs := g.ChangedPackages([]string{file}, ic); !strings.HasSuffix(file, ".go") || len(changedPkgs) > 1 || graph.IsVendored(path.Dir(file)) {
+			whole(changedPkgs)
+			continue
+		}
+		dir := path.Dir(file)
+		if g.Packages[dir] == nil {
+			continue
+		}
+		pkgPath := g.ImportPath(dir)
+		declsA, nameA, errA := fileDeclHashes(srcA, file)
+		declsB, nameB, errB := fileDeclHashes(srcB, file)
+		if errA != nil || errB != nil || graph.SameContent(srcA, srcB, file) {
+			whole([]string{dir})
+			continue
+		}
+		for _, name := range []string{nameA, nameB} {
+			if name == "" {
+				continue
+			}
+			key := pkgPath
+			if strings.HasSuffix(name, "_test") {
+				key += "_test"
+			}
+			for _, decl := range changedHashes(declsA, declsB) {
+				if decl.isFunc && decl.name != "init" {
+					res.Funcs[FuncKey{key, decl.name}] = true
+				} else {
+					res.Packages[key] = true
+				}
+			}
+		}
+	}
+	return res
+}
+
+type declHash struct {
+	name   string
+	isFunc bool
+	hash   string
+}
+
+// Returns the hashes of the declarations of a Go file and its package name,
+// nothing if the file does not exist
+func fileDeclHashes(src graph.FileSource, file string) (map[string]declHash, string, error) {
+	content, err := src.ReadFile(file)
+	if os.IsNotExist(err) {
+		return nil, "", nil
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, file, content, 0)
+	if err != nil {
+		return nil, "", err
+	}
+	decls := make(map[string]declHash)
+	walkDecls([]*ast.File{f}, func(name string, hashed, body ast.Node) {
+		_, isFunc := hashed.(*ast.FuncDecl)
+		d := decls[name]
+		decls[name] = declHash{name: name, isFunc: isFunc, hash: hashStrings(d.hash, nodeHash(fset, hashed))}
+	})
+	return decls, f.Name.Name, nil
+}
+
+// Returns the declarations that differ between two versions of a file
+func changedHashes(a, b map[string]declHash) []declHash {
+	var res []declHash
+	for name, da := range a {
+		if db, ok := b[name]; !ok || db.hash != da.hash {
+			res = append(res, da)
+		}
+	}
+	for name, db := range b {
+		if _, ok := a[name]; !ok {
+			res = append(res, db)
+		}
+	}
+	return res
+}
+
+// Loads the given packages with their tests, from dir
+func LoadTestPackages(ctx context.Context, dir string, patterns []string) ([]*packages.Package, error) {
+	cfg := &packages.Config{Context: ctx, Mode: packages.LoadAllSyntax, Tests: true, Dir: dir}
+	pkgs, err := packages.Load(cfg, patterns...)
+	if err != nil {
+		return nil, err
+	}
+	if packages.PrintErrors(pkgs) > 0 {
+		return nil, errors.New("packages contain errors")
+	}
+	return pkgs, nil
+}
+
+// Returns the key of a function, closures belong to their enclosing function
+func ssaFuncKey(fn *ssa.Function) (FuncKey, bool) {
+	for fn.Parent() != nil {
+		fn = fn.Parent()
+	}
+	if origin := fn.Origin(); origin != nil {
+		fn = origin
+	}
+	if fn.Pkg == nil {
+		return FuncKey{}, false
+	}
+	name := fn.Name()
+	if recv := fn.Signature.Recv(); recv != nil {
+		name = receiverName(recv.Type()) + "." + name
+	}
+	return FuncKey{fn.Pkg.Pkg.Path(), name}, true
+}
+
+// Returns the tests reaching a changed function in the call graph built with
+// algo (cha or rta), by package import path
+func SelectTests(pkgs []*packages.Package, algo string, changes ChangedCode) (map[string][]string, error) {
+	prog, ssaPkgs := ssautil.AllPackages(pkgs, ssa.InstantiateGenerics)
+	prog.Build()
+
+	var tests, roots []*ssa.Function
+	for _, pkg := range ssaPkgs {
+		if pkg == nil {
+			continue
+		}
+		if init := pkg.Func("init"); init != nil {
+			roots = append(roots, init)
+		}
+		for name, member := range pkg.Members {
+			fn, ok := member.(*ssa.Function)
+			if ok && strings.HasPrefix(name, "Test") && isTestSignature(fn) {
+				tests = append(tests, fn)
+				roots = append(roots, fn)
+			}
+		}
+	}
+
+	var cg *callgraph.Graph
+	switch algo {
+	case "cha":
+		cg = cha.CallGraph(prog)
+	case "rta":
+		cg = rta.Analyze(roots, true).CallGraph
+	default:
+		return nil, fmt.Errorf("unknown call graph algorithm %q, should be cha or rta", algo)
+	}
+
+	// Walks the graph backwards from the changed functions
+	reaches := make(map[*ssa.Function]bool)
+	var queue []*callgraph.Node
+	for fn, node := range cg.Nodes {
+		if fn == nil {
+			continue
+		}
+		if key, ok := ssaFuncKey(fn); ok && (changes.Funcs[key] || changes.Packages[key.Pkg]) {
+			reaches[fn] = true
+			queue = append(queue, node)
+		}
+	}
+	for len(queue) > 0 {
+		node := queue[0]
+		queue = queue[1:]
+		for _, edge := range node.In {
+			if caller := edge.Caller.Func; !reaches[caller] {
+				reaches[caller] = true
+				queue = append(queue, edge.Caller)
+			}
+		}
+	}
+
+	// Every test of a package is selected when the package changed as a whole,
+	// since its initialization may have changed
+	selected := make(map[string][]string)
+	for _, test := range tests {
+		pkg := strings.TrimSuffix(test.Pkg.Pkg.Path(), "_test")
+		if reaches[test] || changes.Packages[pkg] || changes.Packages[pkg+"_test"] {
+			if !graph.Contains(selected[pkg], test.Name()) {
+				selected[pkg] = append(selected[pkg], test.Name())
+			}
+		}
+	}
+	for pkg := range selected {
+		sort.Strings(selected[pkg])
+	}
+	return selected, nil
+}
+
+// Whether fn looks like func(*testing.T)
+func isTestSignature(fn *ssa.Function) bool {
+	params := fn.Signature.Params()
+	return params.Len() == 1 && params.At(0).Type().String() == "*testing.T" && fn.Signature.Results().Len() == 0
+}
@@ -0,0 +1,67 @@
+package impact
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/rightscale/ci/gdc/graph"
+)
+
+var testSelectRepo = graph.MapSource{
+	"go.mod":               "module github.com/org/repo\n\ngo 1.18\n",
+	"lib/lib.go":           "package lib\n\nfunc Add(a, b int) int { return a + b }\n\nfunc Mul(a, b int) int { return a * b }\n",
+	"lib/lib_test.go":      "package lib\n\nimport \"testing\"\n\nfunc TestAdd(t *testing.T) { Add(1, 2) }\n\nfunc TestMul(t *testing.T) { Mul(1, 2) }\n",
+	"app/app.go":           "package app\n\nimport \"github.com/org/repo/lib\"\n\nfunc Double(a int) int { return lib.Mul(a, 2) }\n\nfunc Inc(a int) int { return a + 1 }\n",
+	"app/app_test.go":      "package app_test\n\nimport (\n\"testing\"\n\n\"github.com/org/repo/app\"\n)\n\nfunc TestDouble(t *testing.T) { app.Double(1) }\n\nfunc TestInc(t *testing.T) { func() { app.Inc(1) }() }\n",
+	"app/internal_test.go": "package app\n\nimport \"testing\"\n\nfunc TestInternal(t *testing.T) {}\n",
+}
+
+func TestSelectTests(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gdc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for name, content := range testSelectRepo {
+		file := filepath.Join(dir, filepath.FromSlash(name))
+		os.MkdirAll(filepath.Dir(file), 0755)
+		if err := ioutil.WriteFile(file, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	pkgs, err := LoadTestPackages(context.Background(), dir, []string{"./..."})
+	if err != nil {
+		t.Skip("cannot load packages:", err)
+	}
+
+	g, err := graph.Build(context.Background(), testSelectRepo, "github.com/org/repo", graph.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	after := testSelectRepo.Copy()
+	after["lib/lib.go"] = "package lib\n\n// Add adds\nfunc Add(a, b int) int { return a + b }\n\nfunc Mul(a, b int) int { return b * a }\n"
+	after["app/app.go"] = "package app\n\nimport \"github.com/org/repo/lib\"\n\nfunc Double(a int) int { return lib.Mul(a, 2) }\n\nfunc Inc(a int) int { return a + 2 }\n"
+	changes := ChangedFunctions(g, testSelectRepo, after, []string{"app/app.go", "lib/lib.go"}, graph.Inputs{})
+	expectedChanges := map[FuncKey]bool{{"github.com/org/repo/lib", "Mul"}: true, {"github.com/org/repo/app", "Inc"}: true}
+	if !reflect.DeepEqual(changes.Funcs, expectedChanges) || len(changes.Packages) != 0 {
+		t.Error("changed functions should be", expectedChanges, "but got", changes)
+	}
+
+	for _, algo := range []string{"cha", "rta"} {
+		selected, err := SelectTests(pkgs, algo, changes)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := map[string][]string{
+			"github.com/org/repo/lib": {"TestMul"},
+			"github.com/org/repo/app": {"TestDouble", "TestInc"},
+		}
+		if !reflect.DeepEqual(selected, expected) {
+			t.Error(algo, "selected tests should be", expected, "but got", selected)
+		}
+	}
+}
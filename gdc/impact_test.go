@@ -0,0 +1,94 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"gopkg.in/src-d/go-git.v4/plumbing/format/diff"
+
+	"github.com/rightscale/ci/gdc/graph"
+)
+
+type testChunk struct {
+	content string
+	op      diff.Operation
+}
+
+func (c testChunk) Content() string      { return c.content }
+func (c testChunk) Type() diff.Operation { return c.op }
+
+func TestParseCoverProfile(t *testing.T) {
+	profile := `mode: set
+github.com/org/repo/lib/a/a.go:3.20,5.2 1 1
+github.com/org/repo/lib/a/a.go:6.2,8.3 2 1
+github.com/org/repo/lib/a/a.go:10.2,12.3 1 0
+github.com/org/repo/lib/a/a.go:20.2,21.3 1 3
+github.com/other/x/x.go:1.1,2.2 1 1
+`
+	covered, err := parseCoverProfile(strings.NewReader(profile), buildGraph(graph.MapSource{}, "github.com/org/repo").ImportDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string][]lineRange{"lib/a/a.go": {{3, 8}, {20, 21}}}
+	if !reflect.DeepEqual(covered, expected) {
+		t.Error("covered lines should be", expected, "but got", covered)
+	}
+	if _, err := parseCoverProfile(strings.NewReader("garbage\n"), buildGraph(graph.MapSource{}, "github.com/org/repo").ImportDir); err == nil {
+		t.Error("invalid profiles should be rejected")
+	}
+}
+
+func TestChunkLines(t *testing.T) {
+	chunks := []diff.Chunk{
+		testChunk{"l1\nl2\n", diff.Equal},
+		testChunk{"l3\n", diff.Delete},
+		testChunk{"new3\n", diff.Add},
+		testChunk{"l4\nl5\nl6\n", diff.Equal},
+		testChunk{"added\n", diff.Add},
+		testChunk{"l7\n", diff.Equal},
+	}
+	res := chunkLines(chunks)
+	expected := []int{3, 4, 6, 7}
+	if !reflect.DeepEqual(res, expected) {
+		t.Error("changed lines should be", expected, "but got", res)
+	}
+}
+
+func TestImpactQuery(t *testing.T) {
+	idx := &impactIndex{Tests: map[string]map[string][]lineRange{
+		testID("github.com/org/repo/lib/a", "TestA"):  {"lib/a/a.go": {{3, 8}}},
+		testID("github.com/org/repo/lib/a", "TestB"):  {"lib/a/a.go": {{20, 21}}, "lib/b/b.go": {{1, 5}}},
+		testID("github.com/org/repo/svc", "TestMain"): {"svc/main.go": {{1, 50}}, "lib/b/b.go": {{10, 12}}},
+	}}
+	res := idx.query(map[string][]int{"lib/a/a.go": {5}, "lib/b/b.go": {11}}, nil)
+	expected := map[string][]string{
+		"github.com/org/repo/lib/a": {"TestA"},
+		"github.com/org/repo/svc":   {"TestMain"},
+	}
+	if !reflect.DeepEqual(res, expected) {
+		t.Error("selected tests should be", expected, "but got", res)
+	}
+	res = idx.query(map[string][]int{"lib/a/a.go": {5}}, []string{"lib/b/b.go"})
+	expected = map[string][]string{
+		"github.com/org/repo/lib/a": {"TestA", "TestB"},
+		"github.com/org/repo/svc":   {"TestMain"},
+	}
+	if !reflect.DeepEqual(res, expected) {
+		t.Error("stale files should select all their tests,", expected, "but got", res)
+	}
+	idx.Unknown = []string{testID("github.com/org/repo/svc", "TestPanic"), testID("github.com/org/repo/lib/b", "TestB")}
+	res = idx.query(map[string][]int{"lib/a/a.go": {5}}, nil)
+	expected = map[string][]string{
+		"github.com/org/repo/lib/a": {"TestA"},
+		"github.com/org/repo/lib/b": {"TestB"},
+		"github.com/org/repo/svc":   {"TestPanic"},
+	}
+	if !reflect.DeepEqual(res, expected) {
+		t.Error("tests of unknown coverage should always be selected,", expected, "but got", res)
+	}
+	idx.forget("github.com/org/repo/svc")
+	if _, ok := idx.Tests[testID("github.com/org/repo/svc", "TestMain")]; ok || len(idx.Unknown) != 1 {
+		t.Error("the tests of svc should be forgotten, got", idx.Tests, idx.Unknown)
+	}
+}
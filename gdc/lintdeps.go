@@ -0,0 +1,256 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2017 RightScale, Inc, All Rights Reserved Worldwide.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/rightscale/ci/gdc/graph"
+)
+
+// depsConfig is the "deps" section of .gdc.yml, checked by gdc lint-deps
+type depsConfig struct {
+	Rules       []depsRule `yaml:"rules"`
+	Cycles      string     `yaml:"cycles"`       // what cycles are reported: between directories (dir), modules (module) or none
+	CyclesDepth int        `yaml:"cycles_depth"` // with dir, directories are collapsed to this number of path elements, 0 keeps them
+}
+
+// depsRule restricts what the nodes whose directory matches From may depend on
+type depsRule struct {
+	From      string   `yaml:"from"`       // pattern of the directories the rule applies to
+	Allow     []string `yaml:"allow"`      // when set, the only directories they may depend on, besides the ones From matches
+	Deny      []string `yaml:"deny"`       // directories they must not depend on
+	SkipTests bool     `yaml:"skip_tests"` // don't check the dependencies of their tests
+}
+
+func (dc *depsConfig) setDefaults() error {
+	switch dc.Cycles {
+	case "":
+		dc.Cycles = "dir"
+	case "dir", "module", "none":
+	default:
+		return fmt.Errorf("unknown deps cycles %q, should be dir, module or none", dc.Cycles)
+	}
+	for i, rule := range dc.Rules {
+		if rule.From == "" {
+			return fmt.Errorf("deps rule #%d has no from pattern", i+1)
+		}
+		if len(rule.Allow) == 0 && len(rule.Deny) == 0 {
+			return fmt.Errorf("deps rule #%d has neither allow nor deny patterns", i+1)
+		}
+	}
+	return nil
+}
+
+// depViolation is an edge breaking a rule
+type depViolation struct {
+	Edge   graph.Edge
+	Rule   depsRule
+	Reason string
+}
+
+func (v depViolation) String() string {
+	return fmt.Sprintf("%s:%d: %s depends on %s, %s (rule from %s)", v.Edge.File, v.Edge.Line, v.Edge.From, v.Edge.To, v.Reason, v.Rule.From)
+}
+
+// Returns the edges breaking one of the rules, in edge order
+func checkDepRules(g *graph.Graph, rules []depsRule) []depViolation {
+	var res []depViolation
+	for _, e := range g.Edges {
+		from, to := g.Nodes[e.From].Dir(), g.Nodes[e.To].Dir()
+		for _, rule := range rules {
+			if rule.SkipTests && e.Test || !graph.MatchesInput(rule.From, from) {
+				continue
+			}
+			// Dependencies between the directories a rule applies to are always
+			// allowed, but can be denied
+			if pattern := matchingInput(rule.Deny, to); pattern != "" {
+				res = append(res, depViolation{Edge: e, Rule: rule, Reason: "denied by " + pattern})
+			} else if len(rule.Allow) > 0 && !graph.MatchesInput(rule.From, to) && matchingInput(rule.Allow, to) == "" {
+				res = append(res, depViolation{Edge: e, Rule: rule, Reason: "not allowed by " + strings.Join(rule.Allow, ", ")})
+			}
+		}
+	}
+	return res
+}
+
+// Returns the group of a node cycles are looked for between, "" to leave it out
+func cycleGroup(g *graph.Graph, node *graph.Node, dc depsConfig) string {
+	if dc.Cycles == "module" {
+		if m := g.ModuleOfDir(node.Dir()); m != nil {
+			return m.Dir
+		}
+		return ""
+	}
+	if dc.CyclesDepth > 0 {
+		return collapseDir(node.Dir(), dc.CyclesDepth)
+	}
+	return node.Dir()
+}
+
+// Returns the cycles between the groups of nodes, see cycleGroup, through
+// edges needed to build. A cycle is given as the edges going around it, one
+// per pair of groups, starting with the smallest group
+func dependencyCycles(g *graph.Graph, dc depsConfig) [][]graph.Edge {
+	if dc.Cycles == "none" {
+		return nil
+	}
+	// Edges between groups, the first one found between two groups stands for all of them
+	edges := make(map[string]map[string]graph.Edge)
+	for _, e := range g.Edges {
+		from, to := cycleGroup(g, g.Nodes[e.From], dc), cycleGroup(g, g.Nodes[e.To], dc)
+		if e.Test || from == "" || to == "" || from == to {
+			continue
+		}
+		if edges[from] == nil {
+			edges[from] = make(map[string]graph.Edge)
+		}
+		if _, ok := edges[from][to]; !ok {
+			edges[from][to] = e
+		}
+	}
+	var groups []string
+	for group := range edges {
+		groups = append(groups, group)
+	}
+	sort.Strings(groups)
+	targets := func(group string) []string {
+		var res []string
+		for to := range edges[group] {
+			res = append(res, to)
+		}
+		sort.Strings(res)
+		return res
+	}
+
+	// Tarjan's strongly connected components
+	index := make(map[string]int)
+	low := make(map[string]int)
+	onStack := make(map[string]bool)
+	var stack []string
+	var components [][]string
+	var visit func(string)
+	visit = func(v string) {
+		index[v] = len(index)
+		low[v] = index[v]
+		stack = append(stack, v)
+		onStack[v] = true
+		for _, w := range targets(v) {
+			if _, ok := index[w]; !ok {
+				visit(w)
+				if low[w] < low[v] {
+					low[v] = low[w]
+				}
+			} else if onStack[w] && index[w] < low[v] {
+				low[v] = index[w]
+			}
+		}
+		if low[v] == index[v] {
+			var component []string
+			for {
+				w := stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+				onStack[w] = false
+				component = append(component, w)
+				if w == v {
+					break
+				}
+			}
+			if len(component) > 1 {
+				sort.Strings(component)
+				components = append(components, component)
+			}
+		}
+	}
+	for _, group := range groups {
+		if _, ok := index[group]; !ok {
+			visit(group)
+		}
+	}
+	sort.Slice(components, func(i, j int) bool { return components[i][0] < components[j][0] })
+
+	// The shortest cycle through the smallest group of each component
+	var res [][]graph.Edge
+	for _, component := range components {
+		start := component[0]
+		parent := map[string]string{}
+		queue := []string{start}
+		for len(queue) > 0 && parent[start] == "" {
+			v := queue[0]
+			queue = queue[1:]
+			for _, w := range targets(v) {
+				if _, seen := parent[w]; seen || !contains(component, w) {
+					continue
+				}
+				parent[w] = v
+				queue = append(queue, w)
+			}
+		}
+		var cycle []graph.Edge
+		for v := start; ; {
+			p := parent[v]
+			cycle = append([]graph.Edge{edges[p][v]}, cycle...)
+			if v = p; v == start {
+				break
+			}
+		}
+		res = append(res, cycle)
+	}
+	return res
+}
+
+// Implements "gdc lint-deps"
+func lintDepsCommand(args []string) {
+	fs := flag.NewFlagSet("lint-deps", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Println("Usage: gdc lint-deps")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	g := getRepoGraph()
+	dc := getConfig().Deps
+	violations := checkDepRules(g, dc.Rules)
+	for _, v := range violations {
+		fmt.Println(v)
+	}
+	cycles := dependencyCycles(g, dc)
+	for _, cycle := range cycles {
+		var groups []string
+		for _, e := range cycle {
+			groups = append(groups, cycleGroup(g, g.Nodes[e.From], dc))
+		}
+		groups = append(groups, groups[0])
+		fmt.Printf("cycle: %s\n", strings.Join(groups, " -> "))
+		for _, e := range cycle {
+			fmt.Printf("  %s:%d: %s depends on %s\n", e.File, e.Line, e.From, e.To)
+		}
+	}
+	if len(violations) > 0 || len(cycles) > 0 {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/rightscale/ci/gdc/graph"
+)
+
+var layeredRepo = graph.MapSource{
+	"internal/domain/user.go":      "package domain\n\nimport (\n\t\"fmt\"\n\n\t\"github.com/org/repo/internal/http\"\n)\n",
+	"internal/domain/user_test.go": "package domain\n\nimport \"github.com/org/repo/cmd/tool\"\n",
+	"internal/http/http.go":        "package http\n\nimport \"github.com/org/repo/pkg/log\"\n",
+	"pkg/log/log.go":               "package log\n\nimport \"github.com/org/repo/cmd/tool\"\n",
+	"cmd/tool/main.go":             "package main\n\nimport \"github.com/org/repo/pkg/util\"\n",
+	"pkg/util/util.go":             "package util\n",
+}
+
+func TestCheckDepRules(t *testing.T) {
+	g := buildGraph(layeredRepo, "github.com/org/repo")
+	rules := []depsRule{
+		{From: "internal/domain", Deny: []string{"internal/http"}, SkipTests: true},
+		{From: "pkg/*", Deny: []string{"cmd/*"}},
+		{From: "internal/*", Allow: []string{"pkg/*"}},
+	}
+	var res []string
+	for _, v := range checkDepRules(g, rules) {
+		res = append(res, v.String())
+	}
+	expected := []string{
+		"internal/domain/user_test.go:3: go:internal/domain depends on go:cmd/tool, not allowed by pkg/* (rule from internal/*)",
+		"internal/domain/user.go:6: go:internal/domain depends on go:internal/http, denied by internal/http (rule from internal/domain)",
+		"pkg/log/log.go:3: go:pkg/log depends on go:cmd/tool, denied by cmd/* (rule from pkg/*)",
+	}
+	if !reflect.DeepEqual(res, expected) {
+		t.Errorf("violations should be\n%v\nbut got\n%v", expected, res)
+	}
+}
+
+func TestCheckDepRulesDenyWithinFrom(t *testing.T) {
+	g := buildGraph(layeredRepo, "github.com/org/repo")
+	var res []string
+	for _, v := range checkDepRules(g, []depsRule{{From: "internal/*", Deny: []string{"internal/http"}}}) {
+		res = append(res, v.String())
+	}
+	expected := []string{
+		"internal/domain/user.go:6: go:internal/domain depends on go:internal/http, denied by internal/http (rule from internal/*)",
+	}
+	if !reflect.DeepEqual(res, expected) {
+		t.Errorf("violations should be\n%v\nbut got\n%v", expected, res)
+	}
+}
+
+func TestDependencyCycles(t *testing.T) {
+	g := buildGraph(layeredRepo, "github.com/org/repo")
+
+	if cycles := dependencyCycles(g, depsConfig{Cycles: "dir"}); len(cycles) != 0 {
+		t.Error("packages should have no cycle, got", cycles)
+	}
+	// pkg/log -> cmd/tool -> pkg/util, test edges are left out
+	cycles := dependencyCycles(g, depsConfig{Cycles: "dir", CyclesDepth: 1})
+	expected := [][]graph.Edge{{
+		{From: "go:cmd/tool", To: "go:pkg/util", File: "cmd/tool/main.go", Line: 3},
+		{From: "go:pkg/log", To: "go:cmd/tool", File: "pkg/log/log.go", Line: 3},
+	}}
+	if !reflect.DeepEqual(cycles, expected) {
+		t.Errorf("cycles should be\n%+v\nbut got\n%+v", expected, cycles)
+	}
+	if cycles := dependencyCycles(g, depsConfig{Cycles: "none", CyclesDepth: 1}); cycles != nil {
+		t.Error("cycles should not be looked for, got", cycles)
+	}
+}
@@ -0,0 +1,719 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2017 RightScale, Inc, All Rights Reserved Worldwide.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+const dockerHubRegistry = "registry-1.docker.io"
+
+// Manifest media types we know how to copy
+const (
+	mediaTypeDockerManifest     = "application/vnd.docker.distribution.manifest.v2+json"
+	mediaTypeDockerManifestList = "application/vnd.docker.distribution.manifest.list.v2+json"
+	mediaTypeOCIManifest        = "application/vnd.oci.image.manifest.v1+json"
+	mediaTypeOCIIndex           = "application/vnd.oci.image.index.v1+json"
+)
+
+var manifestAccept = strings.Join([]string{
+	mediaTypeDockerManifest,
+	mediaTypeDockerManifestList,
+	mediaTypeOCIManifest,
+	mediaTypeOCIIndex,
+}, ", ")
+
+// imageRef is a parsed image reference like rightscale/app:master
+type imageRef struct {
+	Registry   string
+	Repository string
+	Tag        string
+}
+
+func (r imageRef) String() string {
+	if r.Registry == dockerHubRegistry {
+		return fmt.Sprintf("%s:%s", r.Repository, r.Tag)
+	}
+	return fmt.Sprintf("%s/%s:%s", r.Registry, r.Repository, r.Tag)
+}
+
+// Parses an image reference the same way the docker CLI does: the first path
+// component is a registry only if it looks like a host name, otherwise DockerHub
+// is assumed (and "library/" for single-component names)
+func parseImageRef(ref string) (imageRef, error) {
+	var res imageRef
+	if ref == "" {
+		return res, errors.New("empty image reference")
+	}
+	if strings.Contains(ref, "@") {
+		return res, fmt.Errorf("image reference %q must use a tag, not a digest", ref)
+	}
+
+	name := ref
+	res.Tag = "latest"
+	if i := strings.LastIndex(ref, ":"); i > strings.LastIndex(ref, "/") {
+		name, res.Tag = ref[:i], ref[i+1:]
+	}
+	if name == "" || res.Tag == "" {
+		return res, fmt.Errorf("invalid image reference %q", ref)
+	}
+
+	parts := strings.SplitN(name, "/", 2)
+	if len(parts) == 2 && (strings.ContainsAny(parts[0], ".:") || parts[0] == "localhost") {
+		res.Registry, res.Repository = parts[0], parts[1]
+	} else {
+		res.Registry, res.Repository = dockerHubRegistry, name
+	}
+	if res.Registry == "docker.io" || res.Registry == "index.docker.io" {
+		res.Registry = dockerHubRegistry
+	}
+	if res.Registry == dockerHubRegistry && !strings.Contains(res.Repository, "/") {
+		res.Repository = "library/" + res.Repository
+	}
+
+	return res, nil
+}
+
+// descriptor points to a blob or a manifest in a registry
+type descriptor struct {
+	MediaType string   `json:"mediaType"`
+	Digest    string   `json:"digest"`
+	Size      int64    `json:"size"`
+	URLs      []string `json:"urls,omitempty"`
+}
+
+// manifest holds the fields shared by image manifests and manifest lists
+type manifest struct {
+	MediaType string       `json:"mediaType"`
+	Config    *descriptor  `json:"config,omitempty"`
+	Layers    []descriptor `json:"layers,omitempty"`
+	Manifests []descriptor `json:"manifests,omitempty"`
+}
+
+// registryClient talks the Docker Registry HTTP API V2 against a single registry
+type registryClient struct {
+	Host     string
+	Username string
+	Password string
+	Scopes   []string
+	HTTP     *http.Client
+
+	token string
+	basic bool
+}
+
+// Returns a client for the given registry, using the credentials of that
+// registry only, see registryCredentials
+func newRegistryClient(host string, scopes ...string) *registryClient {
+	username, password := registryCredentials(host)
+	return &registryClient{
+		Host:     host,
+		Username: username,
+		Password: password,
+		Scopes:   scopes,
+		HTTP:     http.DefaultClient,
+	}
+}
+
+// Returns the credentials of a registry: DOCKERHUB_USER and DOCKERHUB_PASSWORD
+// for DockerHub, like docker-shared.sh does, otherwise the ones the docker CLI
+// would use from its config file or credential helpers. Registries without
+// credentials are accessed anonymously
+func registryCredentials(host string) (username, password string) {
+	if host == dockerHubRegistry && os.Getenv("DOCKERHUB_USER") != "" {
+		return os.Getenv("DOCKERHUB_USER"), os.Getenv("DOCKERHUB_PASSWORD")
+	}
+
+	dir := os.Getenv("DOCKER_CONFIG")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", ""
+		}
+		dir = filepath.Join(home, ".docker")
+	}
+	content, err := ioutil.ReadFile(filepath.Join(dir, "config.json"))
+	if err != nil {
+		return "", ""
+	}
+	var cfg struct {
+		Auths map[string]struct {
+			Auth     string `json:"auth"`
+			Username string `json:"username"`
+			Password string `json:"password"`
+		} `json:"auths"`
+		CredsStore  string            `json:"credsStore"`
+		CredHelpers map[string]string `json:"credHelpers"`
+	}
+	if err := json.Unmarshal(content, &cfg); err != nil {
+		return "", ""
+	}
+
+	// The docker CLI stores DockerHub under its index server address
+	key := host
+	if host == dockerHubRegistry {
+		key = "https://index.docker.io/v1/"
+	}
+	if helper := cfg.CredHelpers[key]; helper != "" {
+		return helperCredentials(helper, key)
+	}
+	if cfg.CredsStore != "" {
+		return helperCredentials(cfg.CredsStore, key)
+	}
+	for server, auth := range cfg.Auths {
+		if server != key && strings.TrimPrefix(strings.TrimPrefix(server, "https://"), "http://") != key {
+			continue
+		}
+		if auth.Auth == "" {
+			return auth.Username, auth.Password
+		}
+		decoded, err := base64.StdEncoding.DecodeString(auth.Auth)
+		if err != nil {
+			return "", ""
+		}
+		parts := strings.SplitN(string(decoded), ":", 2)
+		if len(parts) != 2 {
+			return "", ""
+		}
+		return parts[0], parts[1]
+	}
+	return "", ""
+}
+
+// Asks the docker-credential-<helper> binary for the credentials of a registry
+func helperCredentials(helper, server string) (username, password string) {
+	cmd := exec.Command("docker-credential-"+helper, "get")
+	cmd.Stdin = strings.NewReader(server)
+	out, err := cmd.Output()
+	if err != nil {
+		return "", ""
+	}
+	var creds struct {
+		Username string `json:"Username"`
+		Secret   string `json:"Secret"`
+	}
+	if err := json.Unmarshal(out, &creds); err != nil {
+		return "", ""
+	}
+	return creds.Username, creds.Secret
+}
+
+func (c *registryClient) url(format string, args ...interface{}) string {
+	return "https://" + c.Host + fmt.Sprintf(format, args...)
+}
+
+// Performs a request, authenticating once if the registry asks for it
+func (c *registryClient) do(method, rawURL string, header http.Header, body []byte) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequest(method, rawURL, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		for k, v := range header {
+			req.Header[k] = v
+		}
+		if body != nil {
+			req.ContentLength = int64(len(body))
+		}
+		c.authorize(req)
+
+		resp, err := c.HTTP.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusUnauthorized || attempt > 0 {
+			return resp, nil
+		}
+		challenge := resp.Header.Get("WWW-Authenticate")
+		resp.Body.Close()
+		if err := c.authenticate(challenge); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// Adds the credentials obtained by authenticate to a request
+func (c *registryClient) authorize(req *http.Request) {
+	switch {
+	case c.token != "":
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	case c.basic && (c.Username != "" || c.Password != ""):
+		req.SetBasicAuth(c.Username, c.Password)
+	}
+}
+
+// Handles a WWW-Authenticate challenge, fetching a bearer token if needed
+func (c *registryClient) authenticate(challenge string) error {
+	scheme, params := parseChallenge(challenge)
+	switch strings.ToLower(scheme) {
+	case "basic":
+		c.basic = true
+		return nil
+	case "bearer":
+	default:
+		return fmt.Errorf("unsupported registry auth challenge %q", challenge)
+	}
+
+	realm, err := url.Parse(params["realm"])
+	if err != nil || params["realm"] == "" {
+		return fmt.Errorf("invalid registry auth realm in %q", challenge)
+	}
+	q := realm.Query()
+	if params["service"] != "" {
+		q.Set("service", params["service"])
+	}
+	scopes := c.Scopes
+	if len(scopes) == 0 && params["scope"] != "" {
+		scopes = []string{params["scope"]}
+	}
+	for _, scope := range scopes {
+		q.Add("scope", scope)
+	}
+	realm.RawQuery = q.Encode()
+
+	req, err := http.NewRequest("GET", realm.String(), nil)
+	if err != nil {
+		return err
+	}
+	if c.Username != "" || c.Password != "" {
+		req.SetBasicAuth(c.Username, c.Password)
+	}
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("registry token request failed: %s", resp.Status)
+	}
+
+	var tok struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tok); err != nil {
+		return err
+	}
+	c.token = tok.Token
+	if c.token == "" {
+		c.token = tok.AccessToken
+	}
+	if c.token == "" {
+		return errors.New("registry token response did not contain a token")
+	}
+	return nil
+}
+
+// Splits `Bearer realm="x",service="y"` into the scheme and its parameters
+func parseChallenge(challenge string) (scheme string, params map[string]string) {
+	params = make(map[string]string)
+	challenge = strings.TrimSpace(challenge)
+	i := strings.IndexByte(challenge, ' ')
+	if i < 0 {
+		return challenge, params
+	}
+	scheme, rest := challenge[:i], challenge[i+1:]
+
+	for len(rest) > 0 {
+		rest = strings.TrimLeft(rest, ", ")
+		eq := strings.IndexByte(rest, '=')
+		if eq < 0 {
+			break
+		}
+		key := strings.ToLower(strings.TrimSpace(rest[:eq]))
+		rest = rest[eq+1:]
+		var value string
+		if strings.HasPrefix(rest, "\"") {
+			end := strings.IndexByte(rest[1:], '"')
+			if end < 0 {
+				value, rest = rest[1:], ""
+			} else {
+				value, rest = rest[1:end+1], rest[end+2:]
+			}
+		} else if end := strings.IndexByte(rest, ','); end >= 0 {
+			value, rest = rest[:end], rest[end:]
+		} else {
+			value, rest = rest, ""
+		}
+		params[key] = value
+	}
+
+	return
+}
+
+// Returns the raw manifest stored under reference (a tag or a digest)
+func (c *registryClient) getManifest(repo, reference string) (body []byte, mediaType string, err error) {
+	header := http.Header{"Accept": {manifestAccept}}
+	resp, err := c.do("GET", c.url("/v2/%s/manifests/%s", repo, reference), header, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("GET manifest %s:%s failed: %s", repo, reference, resp.Status)
+	}
+	body, err = ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, "", err
+	}
+
+	mediaType = resp.Header.Get("Content-Type")
+	var m manifest
+	if json.Unmarshal(body, &m) == nil && m.MediaType != "" {
+		mediaType = m.MediaType
+	}
+	return body, mediaType, nil
+}
+
+// Stores a raw manifest under reference, returning the digest reported by the registry
+func (c *registryClient) putManifest(repo, reference, mediaType string, body []byte) (string, error) {
+	header := http.Header{"Content-Type": {mediaType}}
+	resp, err := c.do("PUT", c.url("/v2/%s/manifests/%s", repo, reference), header, body)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
+		msg, _ := ioutil.ReadAll(resp.Body)
+		return "", fmt.Errorf("PUT manifest %s:%s failed: %s %s", repo, reference, resp.Status, bytes.TrimSpace(msg))
+	}
+	return resp.Header.Get("Docker-Content-Digest"), nil
+}
+
+// Returns the digest of the manifest stored under reference
+func (c *registryClient) manifestDigest(repo, reference string) (string, error) {
+	header := http.Header{"Accept": {manifestAccept}}
+	resp, err := c.do("HEAD", c.url("/v2/%s/manifests/%s", repo, reference), header, nil)
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("HEAD manifest %s:%s failed: %s", repo, reference, resp.Status)
+	}
+	if digest := resp.Header.Get("Docker-Content-Digest"); digest != "" {
+		return digest, nil
+	}
+
+	// Not every registry sends the header, hash the manifest ourselves
+	body, _, err := c.getManifest(repo, reference)
+	if err != nil {
+		return "", err
+	}
+	return sha256Digest(body), nil
+}
+
+func (c *registryClient) blobExists(repo, digest string) (bool, error) {
+	resp, err := c.do("HEAD", c.url("/v2/%s/blobs/%s", repo, digest), nil, nil)
+	if err != nil {
+		return false, err
+	}
+	resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	default:
+		return false, fmt.Errorf("HEAD blob %s@%s failed: %s", repo, digest, resp.Status)
+	}
+}
+
+// Tries to mount a blob from another repository of the same registry. Returns
+// mounted=false and the upload location when the registry refused the mount
+func (c *registryClient) mountBlob(repo, fromRepo, digest string) (mounted bool, location string, err error) {
+	q := url.Values{"mount": {digest}, "from": {fromRepo}}
+	resp, err := c.do("POST", c.url("/v2/%s/blobs/uploads/?%s", repo, q.Encode()), nil, nil)
+	if err != nil {
+		return false, "", err
+	}
+	resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusCreated:
+		return true, "", nil
+	case http.StatusAccepted:
+		location, err = c.resolveLocation(resp)
+		return false, location, err
+	default:
+		return false, "", fmt.Errorf("mount of blob %s from %s into %s failed: %s", digest, fromRepo, repo, resp.Status)
+	}
+}
+
+// Starts a new blob upload, returning its location
+func (c *registryClient) startUpload(repo string) (string, error) {
+	resp, err := c.do("POST", c.url("/v2/%s/blobs/uploads/", repo), nil, nil)
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		return "", fmt.Errorf("blob upload to %s failed: %s", repo, resp.Status)
+	}
+	return c.resolveLocation(resp)
+}
+
+func (c *registryClient) resolveLocation(resp *http.Response) (string, error) {
+	loc, err := resp.Location()
+	if err != nil {
+		return "", fmt.Errorf("registry did not return an upload location: %v", err)
+	}
+	return loc.String(), nil
+}
+
+// Finishes an upload with the whole blob in a single PUT, streaming it from
+// blob. size is -1 when unknown. The stream can't be sent twice, so the
+// client must already be authenticated, which starting the upload did
+func (c *registryClient) uploadBlob(location, digest string, blob io.Reader, size int64) error {
+	u, err := url.Parse(location)
+	if err != nil {
+		return err
+	}
+	q := u.Query()
+	q.Set("digest", digest)
+	u.RawQuery = q.Encode()
+
+	req, err := http.NewRequest("PUT", u.String(), blob)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.ContentLength = size
+	c.authorize(req)
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		return fmt.Errorf("upload of blob %s failed: %s", digest, resp.Status)
+	}
+	return nil
+}
+
+// Opens a blob for reading, along with its size (-1 when unknown). The
+// content is not checked against the digest, it's up to the caller
+func (c *registryClient) openBlob(repo, digest string) (io.ReadCloser, int64, error) {
+	resp, err := c.do("GET", c.url("/v2/%s/blobs/%s", repo, digest), nil, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, 0, fmt.Errorf("GET blob %s@%s failed: %s", repo, digest, resp.Status)
+	}
+	return resp.Body, resp.ContentLength, nil
+}
+
+func sha256Digest(content []byte) string {
+	sum := sha256.Sum256(content)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// imagePromoter copies a tag between repositories without pulling layers locally
+type imagePromoter struct {
+	src, dst       imageRef
+	srcClt, dstClt *registryClient
+	out            io.Writer
+}
+
+func newImagePromoter(src, dst imageRef, out io.Writer) *imagePromoter {
+	p := &imagePromoter{src: src, dst: dst, out: out}
+	if src.Registry == dst.Registry {
+		scopes := []string{"repository:" + dst.Repository + ":pull,push"}
+		if src.Repository != dst.Repository {
+			scopes = append(scopes, "repository:"+src.Repository+":pull")
+		}
+		p.srcClt = newRegistryClient(src.Registry, scopes...)
+		p.dstClt = p.srcClt
+	} else {
+		p.srcClt = newRegistryClient(src.Registry, "repository:"+src.Repository+":pull")
+		p.dstClt = newRegistryClient(dst.Registry, "repository:"+dst.Repository+":pull,push")
+	}
+	return p
+}
+
+func (p *imagePromoter) sameRepo() bool {
+	return p.src.Registry == p.dst.Registry && p.src.Repository == p.dst.Repository
+}
+
+func (p *imagePromoter) logf(format string, args ...interface{}) {
+	if Verbose && p.out != nil {
+		fmt.Fprintf(p.out, format, args...)
+	}
+}
+
+// Copies src to dst and verifies both tags resolve to the same digest
+func (p *imagePromoter) promote() (digest string, err error) {
+	body, mediaType, err := p.srcClt.getManifest(p.src.Repository, p.src.Tag)
+	if err != nil {
+		return "", err
+	}
+	digest = sha256Digest(body)
+	p.logf("Source %s has digest %s (%s)\n", p.src, digest, mediaType)
+
+	if !p.sameRepo() {
+		if err := p.copyReferences(body, mediaType); err != nil {
+			return "", err
+		}
+	}
+	if _, err := p.dstClt.putManifest(p.dst.Repository, p.dst.Tag, mediaType, body); err != nil {
+		return "", err
+	}
+
+	dstDigest, err := p.dstClt.manifestDigest(p.dst.Repository, p.dst.Tag)
+	if err != nil {
+		return "", err
+	}
+	if dstDigest != digest {
+		return "", fmt.Errorf("digest mismatch after promotion: %s is %s but %s is %s", p.src, digest, p.dst, dstDigest)
+	}
+	return digest, nil
+}
+
+// Makes sure everything referenced by a manifest exists in the destination repository
+func (p *imagePromoter) copyReferences(body []byte, mediaType string) error {
+	var m manifest
+	if err := json.Unmarshal(body, &m); err != nil {
+		return fmt.Errorf("cannot parse manifest: %v", err)
+	}
+
+	switch mediaType {
+	case mediaTypeDockerManifestList, mediaTypeOCIIndex:
+		for _, child := range m.Manifests {
+			childBody, childType, err := p.srcClt.getManifest(p.src.Repository, child.Digest)
+			if err != nil {
+				return err
+			}
+			if err := p.copyReferences(childBody, childType); err != nil {
+				return err
+			}
+			if _, err := p.dstClt.putManifest(p.dst.Repository, child.Digest, childType, childBody); err != nil {
+				return err
+			}
+		}
+	case mediaTypeDockerManifest, mediaTypeOCIManifest:
+		blobs := m.Layers
+		if m.Config != nil {
+			blobs = append([]descriptor{*m.Config}, blobs...)
+		}
+		for _, blob := range blobs {
+			if len(blob.URLs) > 0 {
+				// Foreign layers are not stored in the registry
+				continue
+			}
+			if err := p.copyBlob(blob.Digest); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("unsupported manifest media type %q", mediaType)
+	}
+
+	return nil
+}
+
+func (p *imagePromoter) copyBlob(digest string) error {
+	exists, err := p.dstClt.blobExists(p.dst.Repository, digest)
+	if err != nil {
+		return err
+	}
+	if exists {
+		p.logf("  blob %s already present\n", digest)
+		return nil
+	}
+
+	var location string
+	if p.src.Registry == p.dst.Registry {
+		var mounted bool
+		mounted, location, err = p.dstClt.mountBlob(p.dst.Repository, p.src.Repository, digest)
+		if err != nil {
+			return err
+		}
+		if mounted {
+			p.logf("  blob %s mounted from %s\n", digest, p.src.Repository)
+			return nil
+		}
+	} else {
+		location, err = p.dstClt.startUpload(p.dst.Repository)
+		if err != nil {
+			return err
+		}
+	}
+
+	// No mount possible, the blob has to travel through us, streamed from the
+	// source to the destination so that layers are never held in memory
+	blob, size, err := p.srcClt.openBlob(p.src.Repository, digest)
+	if err != nil {
+		return err
+	}
+	defer blob.Close()
+	hash := sha256.New()
+	if err := p.dstClt.uploadBlob(location, digest, io.TeeReader(blob, hash), size); err != nil {
+		return err
+	}
+	if actual := "sha256:" + hex.EncodeToString(hash.Sum(nil)); actual != digest {
+		return fmt.Errorf("blob %s@%s does not match its digest, got %s", p.src.Repository, digest, actual)
+	}
+	p.logf("  blob %s copied (%d bytes)\n", digest, size)
+	return nil
+}
+
+// Implements "gdc image <subcommand>"
+func imageCommand(args []string) {
+	if len(args) == 0 || args[0] != "promote" || len(args) != 3 {
+		fmt.Println("Usage: gdc image promote <src image:tag> <dst image:tag>")
+		os.Exit(1)
+	}
+
+	src, err := parseImageRef(args[1])
+	if err != nil {
+		fmt.Printf("ERROR! %v\n", err)
+		os.Exit(1)
+	}
+	dst, err := parseImageRef(args[2])
+	if err != nil {
+		fmt.Printf("ERROR! %v\n", err)
+		os.Exit(1)
+	}
+
+	digest, err := newImagePromoter(src, dst, os.Stdout).promote()
+	if err != nil {
+		fmt.Printf("ERROR! Promoting %s to %s: %v\n", src, dst, err)
+		os.Exit(1)
+	}
+	fmt.Printf("Promoted %s to %s (%s)\n", src, dst, digest)
+}
@@ -0,0 +1,276 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestParseImageRef(t *testing.T) {
+	tests := map[string]imageRef{
+		"rightscale/app:master":     {dockerHubRegistry, "rightscale/app", "master"},
+		"rightscale/app":            {dockerHubRegistry, "rightscale/app", "latest"},
+		"ubuntu:16.04":              {dockerHubRegistry, "library/ubuntu", "16.04"},
+		"docker.io/rightscale/app":  {dockerHubRegistry, "rightscale/app", "latest"},
+		"quay.io/team/app:v1":       {"quay.io", "team/app", "v1"},
+		"localhost:5000/app:latest": {"localhost:5000", "app", "latest"},
+		"localhost/team/app:x":      {"localhost", "team/app", "x"},
+	}
+	for ref, expected := range tests {
+		res, err := parseImageRef(ref)
+		if err != nil {
+			t.Error(ref, "returned error", err)
+			continue
+		}
+		if !reflect.DeepEqual(res, expected) {
+			t.Error(ref, "should return", expected, "but returned", res)
+		}
+	}
+
+	for _, ref := range []string{"", "app@sha256:abc", "app:"} {
+		if _, err := parseImageRef(ref); err == nil {
+			t.Error(ref, "should return an error")
+		}
+	}
+}
+
+// fakeRegistry is a tiny in-memory registry that only accepts bearer tokens
+type fakeRegistry struct {
+	sync.Mutex
+	manifests map[string][]byte // repo:reference -> manifest
+	types     map[string]string
+	blobs     map[string]map[string][]byte // repo -> digest -> blob
+	mounts    int
+	uploads   int
+}
+
+func (f *fakeRegistry) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.Lock()
+	defer f.Unlock()
+
+	if r.URL.Path == "/token" {
+		w.Write([]byte(`{"token":"secret"}`))
+		return
+	}
+	if r.Header.Get("Authorization") != "Bearer secret" {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="https://`+r.Host+`/token",service="fake"`)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	path := strings.TrimPrefix(r.URL.Path, "/v2/")
+	switch {
+	case strings.Contains(path, "/manifests/"):
+		parts := strings.SplitN(path, "/manifests/", 2)
+		key := parts[0] + ":" + parts[1]
+		switch r.Method {
+		case "GET", "HEAD":
+			body, ok := f.manifests[key]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.Header().Set("Content-Type", f.types[key])
+			w.Header().Set("Docker-Content-Digest", sha256Digest(body))
+			w.Write(body)
+		case "PUT":
+			body, _ := ioutil.ReadAll(r.Body)
+			digest := sha256Digest(body)
+			f.manifests[key] = body
+			f.manifests[parts[0]+":"+digest] = body
+			f.types[key] = r.Header.Get("Content-Type")
+			f.types[parts[0]+":"+digest] = r.Header.Get("Content-Type")
+			w.Header().Set("Docker-Content-Digest", digest)
+			w.WriteHeader(http.StatusCreated)
+		}
+	case strings.Contains(path, "/blobs/uploads/"):
+		repo := strings.SplitN(path, "/blobs/uploads/", 2)[0]
+		if f.blobs[repo] == nil {
+			f.blobs[repo] = make(map[string][]byte)
+		}
+		switch r.Method {
+		case "POST":
+			from, digest := r.URL.Query().Get("from"), r.URL.Query().Get("mount")
+			if blob, ok := f.blobs[from][digest]; ok && digest != "" {
+				f.blobs[repo][digest] = blob
+				f.mounts++
+				w.WriteHeader(http.StatusCreated)
+				return
+			}
+			w.Header().Set("Location", "/v2/"+repo+"/blobs/uploads/1234?state=x")
+			w.WriteHeader(http.StatusAccepted)
+		case "PUT":
+			blob, _ := ioutil.ReadAll(r.Body)
+			f.blobs[repo][r.URL.Query().Get("digest")] = blob
+			f.uploads++
+			w.WriteHeader(http.StatusCreated)
+		}
+	case strings.Contains(path, "/blobs/"):
+		parts := strings.SplitN(path, "/blobs/", 2)
+		blob, ok := f.blobs[parts[0]][parts[1]]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write(blob)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func newFakeRegistry() (*fakeRegistry, *httptest.Server) {
+	config := []byte(`{"config":{}}`)
+	layer := []byte("layer content")
+	fake := &fakeRegistry{
+		manifests: make(map[string][]byte),
+		types:     make(map[string]string),
+		blobs: map[string]map[string][]byte{
+			"team/app": {sha256Digest(config): config, sha256Digest(layer): layer},
+		},
+	}
+	body := []byte(`{"schemaVersion":2,"mediaType":"` + mediaTypeDockerManifest + `",` +
+		`"config":{"mediaType":"application/vnd.docker.container.image.v1+json","digest":"` + sha256Digest(config) + `","size":13},` +
+		`"layers":[{"mediaType":"application/vnd.docker.image.rootfs.diff.tar.gzip","digest":"` + sha256Digest(layer) + `","size":13}]}`)
+	fake.manifests["team/app:latest"] = body
+	fake.types["team/app:latest"] = mediaTypeDockerManifest
+
+	return fake, httptest.NewTLSServer(fake)
+}
+
+func promoteWithFake(t *testing.T, srv *httptest.Server, src, dst string) string {
+	u, _ := url.Parse(srv.URL)
+	srcRef, _ := parseImageRef(u.Host + "/" + src)
+	dstRef, _ := parseImageRef(u.Host + "/" + dst)
+
+	p := newImagePromoter(srcRef, dstRef, nil)
+	p.srcClt.HTTP = srv.Client()
+	p.dstClt.HTTP = srv.Client()
+	digest, err := p.promote()
+	if err != nil {
+		t.Fatal("promote", src, "to", dst, "failed:", err)
+	}
+	return digest
+}
+
+func TestPromoteSameRepository(t *testing.T) {
+	fake, srv := newFakeRegistry()
+	defer srv.Close()
+
+	digest := promoteWithFake(t, srv, "team/app:latest", "team/app:master")
+	if digest != sha256Digest(fake.manifests["team/app:latest"]) {
+		t.Error("unexpected digest", digest)
+	}
+	if string(fake.manifests["team/app:master"]) != string(fake.manifests["team/app:latest"]) {
+		t.Error("master tag should hold the same manifest as latest")
+	}
+	if fake.mounts != 0 || fake.uploads != 0 {
+		t.Error("no blob should be copied inside the same repository, got", fake.mounts, "mounts and", fake.uploads, "uploads")
+	}
+}
+
+func TestPromoteCrossRepositoryMountsBlobs(t *testing.T) {
+	fake, srv := newFakeRegistry()
+	defer srv.Close()
+
+	promoteWithFake(t, srv, "team/app:latest", "other/app:production")
+	if fake.mounts != 2 || fake.uploads != 0 {
+		t.Error("expected 2 mounts and 0 uploads, got", fake.mounts, "mounts and", fake.uploads, "uploads")
+	}
+	if len(fake.blobs["other/app"]) != 2 {
+		t.Error("expected both blobs in other/app, got", len(fake.blobs["other/app"]))
+	}
+}
+
+func TestParseChallenge(t *testing.T) {
+	scheme, params := parseChallenge(`Bearer realm="https://auth.docker.io/token",service="registry.docker.io",scope="repository:a/b:pull,push"`)
+	expected := map[string]string{
+		"realm":   "https://auth.docker.io/token",
+		"service": "registry.docker.io",
+		"scope":   "repository:a/b:pull,push",
+	}
+	if scheme != "Bearer" || !reflect.DeepEqual(params, expected) {
+		t.Error("unexpected challenge parse:", scheme, params)
+	}
+}
+
+func TestRegistryCredentials(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gdc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	config := `{"auths": {
+		"https://index.docker.io/v1/": {"auth": "aHViOmh1YnBhc3M="},
+		"quay.io": {"auth": "cXVheTpxdWF5cGFzcw=="}
+	}}`
+	if err := ioutil.WriteFile(filepath.Join(dir, "config.json"), []byte(config), 0600); err != nil {
+		t.Fatal(err)
+	}
+	for k, v := range map[string]string{"DOCKER_CONFIG": dir, "DOCKERHUB_USER": "env", "DOCKERHUB_PASSWORD": "envpass"} {
+		defer os.Setenv(k, os.Getenv(k))
+		os.Setenv(k, v)
+	}
+
+	tests := []struct{ host, username, password string }{
+		{dockerHubRegistry, "env", "envpass"},
+		{"quay.io", "quay", "quaypass"},
+		{"registry.example.com", "", ""},
+	}
+	for _, test := range tests {
+		if username, password := registryCredentials(test.host); username != test.username || password != test.password {
+			t.Errorf("%s: expected %q/%q, got %q/%q", test.host, test.username, test.password, username, password)
+		}
+	}
+
+	os.Setenv("DOCKERHUB_USER", "")
+	if username, password := registryCredentials(dockerHubRegistry); username != "hub" || password != "hubpass" {
+		t.Errorf("DockerHub credentials should come from the docker config, got %q/%q", username, password)
+	}
+}
+
+func TestPromoteCrossRegistryStreamsBlobs(t *testing.T) {
+	src, srcSrv := newFakeRegistry()
+	defer srcSrv.Close()
+	dst, dstSrv := newFakeRegistry()
+	defer dstSrv.Close()
+	dst.blobs = make(map[string]map[string][]byte)
+
+	promote := func() error {
+		srcURL, _ := url.Parse(srcSrv.URL)
+		dstURL, _ := url.Parse(dstSrv.URL)
+		srcRef, _ := parseImageRef(srcURL.Host + "/team/app:latest")
+		dstRef, _ := parseImageRef(dstURL.Host + "/team/app:production")
+		p := newImagePromoter(srcRef, dstRef, nil)
+		p.srcClt.HTTP = srcSrv.Client()
+		p.dstClt.HTTP = dstSrv.Client()
+		_, err := p.promote()
+		return err
+	}
+	if err := promote(); err != nil {
+		t.Fatal(err)
+	}
+	if dst.uploads != 2 || len(dst.blobs["team/app"]) != 2 {
+		t.Error("expected both blobs uploaded, got", dst.uploads, "uploads and", len(dst.blobs["team/app"]), "blobs")
+	}
+	for digest, blob := range src.blobs["team/app"] {
+		if string(dst.blobs["team/app"][digest]) != string(blob) {
+			t.Error("blob", digest, "was not copied as is")
+		}
+	}
+
+	// A blob not matching its digest must fail the promotion
+	dst.blobs = make(map[string]map[string][]byte)
+	for digest := range src.blobs["team/app"] {
+		src.blobs["team/app"][digest] = []byte("corrupted")
+	}
+	if err := promote(); err == nil || !strings.Contains(err.Error(), "does not match its digest") {
+		t.Error("a corrupted blob should fail the promotion, got", err)
+	}
+}
@@ -0,0 +1,344 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2017 RightScale, Inc, All Rights Reserved Worldwide.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Package repo resolves the refs and commit ranges of a git repository and
+// reads its commits
+package repo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+)
+
+// Logger receives the details of the resolution of refs, a *log.Logger will do
+type Logger interface {
+	Printf(format string, v ...interface{})
+}
+
+// nopLogger discards every message
+type nopLogger struct{}
+
+func (nopLogger) Printf(format string, v ...interface{}) {}
+
+// Repo is an opened git repository
+type Repo struct {
+	Path string // root of the working directory
+	git  *git.Repository
+	log  Logger
+}
+
+// Opens the git repository holding dir, looking for it in the parent
+// directories too. A nil logger discards the messages
+func Open(ctx context.Context, dir string, logger Logger) (*Repo, error) {
+	if logger == nil {
+		logger = nopLogger{}
+	}
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		r, err := git.PlainOpen(dir)
+		if err == nil {
+			return &Repo{Path: dir, git: r, log: logger}, nil
+		}
+		if err != git.ErrRepositoryNotExists {
+			return nil, err
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return nil, errors.New("cannot find a git repo in the directory or any of its parents")
+		}
+		dir = parent
+	}
+}
+
+// Returns the underlying go-git repository
+func (r *Repo) Git() *git.Repository {
+	return r.git
+}
+
+// Range is a commit range. Its ends are SHAs, short SHAs, branches, tags or
+// HEAD~N
+type Range struct {
+	From string
+	To   string
+}
+
+// Parses a commit range given as <from>..<to> or <from>...<to>
+func ParseRange(commitRange string) (Range, error) {
+	sep := "..."
+	if !strings.Contains(commitRange, sep) {
+		sep = ".."
+	}
+	shas := strings.Split(commitRange, sep)
+	if len(shas) != 2 || shas[0] == "" || shas[1] == "" {
+		return Range{}, fmt.Errorf("invalid commit range %q, should be <sha1>..<sha2>", commitRange)
+	}
+	return Range{From: shas[0], To: shas[1]}, nil
+}
+
+// Returns the range as <from>..<to>
+func (rng Range) String() string {
+	return rng.From + ".." + rng.To
+}
+
+// Returns the full SHA of a SHA, short SHA, branch, tag or HEAD~N
+func (r *Repo) Resolve(ctx context.Context, ref string) (string, error) {
+	if strings.HasPrefix(ref, "HEAD") {
+		return r.resolveHead(ctx, ref)
+	}
+	if sha, err := r.branch(ref); err != nil || sha != "" {
+		return sha, err
+	}
+	if sha, err := r.tag(ref); err != nil || sha != "" {
+		return sha, err
+	}
+
+	switch {
+	case len(ref) == 40:
+		return ref, nil
+	case len(ref) > 40:
+		return "", fmt.Errorf("the given SHA (%v) is longer than 40 (length is %v)", ref, len(ref))
+	default:
+		return r.fullSHA(ctx, ref)
+	}
+}
+
+// Returns the SHA of a branch, "" if there is none
+func (r *Repo) branch(name string) (string, error) {
+	ref, err := r.git.Reference(plumbing.NewBranchReferenceName(name), true)
+	if err == plumbing.ErrReferenceNotFound {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	r.log.Printf(" Found branch %v with hash %v \n", name, ref.Hash())
+	return ref.Hash().String(), nil
+}
+
+// Returns the SHA of the commit of a tag, "" if there is none
+func (r *Repo) tag(name string) (string, error) {
+	ref, err := r.git.Reference(plumbing.NewTagReferenceName(name), true)
+	if err == plumbing.ErrReferenceNotFound {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	sha := ref.Hash()
+	if tag, err := r.git.TagObject(sha); err == nil {
+		// That is an annotated tag, extract Hash of destination
+		sha = tag.Target
+	}
+	r.log.Printf(" Found tag %v with hash %v \n", name, sha)
+	return sha.String(), nil
+}
+
+// Returns the only commit whose SHA starts with a short SHA
+func (r *Repo) fullSHA(ctx context.Context, shortSHA string) (string, error) {
+	commits, err := r.git.CommitObjects()
+	if err != nil {
+		return "", err
+	}
+	var results []string
+	err = commits.ForEach(func(commit *object.Commit) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if strings.HasPrefix(commit.Hash.String(), shortSHA) {
+			results = append(results, commit.Hash.String())
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	switch n := len(results); n {
+	case 0:
+		return "", fmt.Errorf("no SHA/branch/tag found like %q", shortSHA)
+	case 1:
+		return results[0], nil
+	default:
+		return "", fmt.Errorf("short SHA %s is ambiguous, %d matching SHAs found", shortSHA, n)
+	}
+}
+
+// Returns N for HEAD~N, 0 for HEAD
+func headN(ref string) (int, error) {
+	if ref == "HEAD" {
+		return 0, nil
+	}
+	if !strings.HasPrefix(ref, "HEAD~") {
+		return 0, fmt.Errorf("%s git ref should start with HEAD~", ref)
+	}
+	return strconv.Atoi(strings.TrimPrefix(ref, "HEAD~"))
+}
+
+// Returns the SHA of HEAD~N, following first parents
+func (r *Repo) resolveHead(ctx context.Context, ref string) (string, error) {
+	n, err := headN(ref)
+	if err != nil {
+		return "", err
+	}
+	head, err := r.git.Head()
+	if err != nil {
+		return "", err
+	}
+	commit, err := r.git.CommitObject(head.Hash())
+	if err != nil {
+		return "", err
+	}
+	for i := 0; i < n; i++ {
+		if err := ctx.Err(); err != nil {
+			return "", err
+		}
+		if commit.NumParents() == 0 {
+			return "", fmt.Errorf("%s goes past the first commit", ref)
+		}
+		commit, err = r.git.CommitObject(commit.ParentHashes[0])
+		if err != nil {
+			return "", err
+		}
+		r.log.Printf(" %s  \n", commit.Hash.String())
+	}
+	r.log.Printf(" %s translated to %s \n", ref, commit.Hash.String())
+	return commit.Hash.String(), nil
+}
+
+// Returns the commit of a ref
+func (r *Repo) commit(ctx context.Context, ref string) (*object.Commit, error) {
+	sha, err := r.Resolve(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+	return r.git.CommitObject(plumbing.NewHash(sha))
+}
+
+// Returns the patch between the ends of a range
+func (r *Repo) Patch(ctx context.Context, rng Range) (*object.Patch, error) {
+	from, err := r.commit(ctx, rng.From)
+	if err != nil {
+		return nil, err
+	}
+	to, err := r.commit(ctx, rng.To)
+	if err != nil {
+		return nil, err
+	}
+	return from.PatchContext(ctx, to)
+}
+
+// Returns the files changed between the ends of a range, sorted. A renamed
+// file is listed under both names
+func (r *Repo) ChangedFiles(ctx context.Context, rng Range) ([]string, error) {
+	r.log.Printf("changedPaths from %s to %s \n", rng.From, rng.To)
+	patch, err := r.Patch(ctx, rng)
+	if err != nil {
+		return nil, err
+	}
+
+	paths := make(map[string]bool)
+	for _, fpatch := range patch.FilePatches() {
+		from, to := fpatch.Files()
+		if from != nil {
+			paths[from.Path()] = true
+		}
+		if to != nil {
+			paths[to.Path()] = true
+		}
+	}
+	res := make([]string, 0, len(paths))
+	for p := range paths {
+		res = append(res, p)
+	}
+	sort.Strings(res)
+	return res, nil
+}
+
+// TreeSource gives access to the files of a commit, it's a graph.FileSource
+type TreeSource struct {
+	tree   *object.Tree
+	files  []string
+	hashes map[string]plumbing.Hash
+}
+
+// Returns the files of the commit of a ref
+func (r *Repo) Tree(ctx context.Context, ref string) (*TreeSource, error) {
+	commit, err := r.commit(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+	tree, err := commit.Tree()
+	if err != nil {
+		return nil, err
+	}
+
+	src := &TreeSource{tree: tree, hashes: make(map[string]plumbing.Hash)}
+	err = tree.Files().ForEach(func(f *object.File) error {
+		src.files = append(src.files, f.Name)
+		src.hashes[f.Name] = f.Hash
+		return ctx.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(src.files)
+
+	return src, nil
+}
+
+func (s *TreeSource) Files() []string {
+	return s.files
+}
+
+func (s *TreeSource) ReadFile(name string) ([]byte, error) {
+	if _, ok := s.hashes[name]; !ok {
+		return nil, os.ErrNotExist
+	}
+	f, err := s.tree.File(name)
+	if err != nil {
+		return nil, err
+	}
+	content, err := f.Contents()
+	return []byte(content), err
+}
+
+// Returns the git blob hash of a file of the tree
+func (s *TreeSource) BlobHash(name string) (string, bool) {
+	hash, ok := s.hashes[name]
+	return hash.String(), ok
+}
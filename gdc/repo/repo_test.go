@@ -0,0 +1,87 @@
+package repo
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"gopkg.in/src-d/go-git.v4/plumbing"
+
+	"github.com/rightscale/ci/gdc/internal/repotest"
+)
+
+func TestHeadN(t *testing.T) {
+	cases := map[string]int{"HEAD": 0, "HEAD~1": 1, "HEAD~5": 5, "HEAD~13": 13, "HEAD~101": 101}
+	for ref, expected := range cases {
+		if n, err := headN(ref); err != nil || n != expected {
+			t.Error(ref, "should return", expected, "but got", n, err)
+		}
+	}
+	for _, ref := range []string{"HEAD3", "HEAD~x"} {
+		if _, err := headN(ref); err == nil {
+			t.Error(ref, "should be rejected")
+		}
+	}
+}
+
+func TestParseRange(t *testing.T) {
+	for _, r := range []string{"abc..def", "abc...def"} {
+		if rng, err := ParseRange(r); err != nil || rng != (Range{From: "abc", To: "def"}) {
+			t.Error("unexpected result for", r, rng, err)
+		}
+	}
+	if _, err := ParseRange("abc"); err == nil {
+		t.Error("a range without .. should be rejected")
+	}
+}
+
+func TestRepo(t *testing.T) {
+	dir, g, cleanup := repotest.Init(t)
+	defer cleanup()
+	first := repotest.CommitFiles(t, g, dir, map[string]string{"README.md": "", "lib/lib.go": "package lib\n"})
+	if _, err := g.CreateTag("v1", plumbing.NewHash(first), nil); err != nil {
+		t.Fatal(err)
+	}
+	second := repotest.CommitFiles(t, g, dir, map[string]string{"lib/lib.go": "package lib\n\nvar X = 1\n", "svc/main.go": "package main\n"})
+
+	ctx := context.Background()
+	os.MkdirAll(filepath.Join(dir, "svc"), 0755)
+	r, err := Open(ctx, filepath.Join(dir, "svc"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Path != dir {
+		t.Error("repo path should be", dir, "but got", r.Path)
+	}
+	cases := map[string]string{"HEAD": second, "HEAD~1": first, "v1": first, "master": second, first[:7]: first, second: second}
+	for ref, expected := range cases {
+		if sha, err := r.Resolve(ctx, ref); err != nil || sha != expected {
+			t.Error(ref, "should resolve to", expected, "but got", sha, err)
+		}
+	}
+	for _, ref := range []string{"HEAD~2", "unknown"} {
+		if _, err := r.Resolve(ctx, ref); err == nil {
+			t.Error(ref, "should not resolve")
+		}
+	}
+
+	changed, err := r.ChangedFiles(ctx, Range{From: "v1", To: "HEAD"})
+	if expected := []string{"lib/lib.go", "svc/main.go"}; err != nil || !reflect.DeepEqual(changed, expected) {
+		t.Error("changed files should be", expected, "but got", changed, err)
+	}
+	tree, err := r.Tree(ctx, "HEAD~1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{"README.md", "lib/lib.go"}; !reflect.DeepEqual(tree.Files(), expected) {
+		t.Error("files should be", expected, "but got", tree.Files())
+	}
+	if content, err := tree.ReadFile("lib/lib.go"); err != nil || string(content) != "package lib\n" {
+		t.Error("unexpected content", string(content), err)
+	}
+	if _, err := tree.ReadFile("svc/main.go"); !os.IsNotExist(err) {
+		t.Error("files of other commits should not exist, got", err)
+	}
+}
@@ -0,0 +1,243 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2017 RightScale, Inc, All Rights Reserved Worldwide.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/rightscale/ci/gdc/graph"
+	"github.com/rightscale/ci/gdc/impact"
+)
+
+// runResult is the outcome of the command for one target
+type runResult struct {
+	Target   string
+	Status   string // ok, failed or skipped
+	Duration time.Duration
+	Err      error
+}
+
+// Runs task for every target with at most parallel tasks at a time. A target
+// only starts once the targets it depends on (see deps) are done. Unless
+// keepGoing is set, no target starts after a failure and the remaining ones
+// are reported as skipped. Results are returned in the order of targets
+func runTargets(targets []string, deps map[string][]string, parallel int, keepGoing bool, task func(target string) error) []runResult {
+	if parallel < 1 {
+		parallel = 1
+	}
+	type finished struct {
+		index int
+		res   runResult
+	}
+	results := make([]runResult, len(targets))
+	started := make([]bool, len(targets))
+	done := make(map[string]bool)
+	finishedc := make(chan finished)
+	running, failed := 0, false
+
+	for {
+		if !failed || keepGoing {
+			for i, target := range targets {
+				if running >= parallel {
+					break
+				}
+				if started[i] || !allDone(deps[target], done) {
+					continue
+				}
+				started[i] = true
+				running++
+				go func(i int, target string) {
+					start := time.Now()
+					err := task(target)
+					res := runResult{Target: target, Status: "ok", Duration: time.Since(start), Err: err}
+					if err != nil {
+						res.Status = "failed"
+					}
+					finishedc <- finished{i, res}
+				}(i, target)
+			}
+		}
+		if running == 0 {
+			break
+		}
+		f := <-finishedc
+		running--
+		results[f.index] = f.res
+		done[f.res.Target] = true
+		failed = failed || f.res.Err != nil
+	}
+
+	for i, target := range targets {
+		if !started[i] {
+			results[i] = runResult{Target: target, Status: "skipped"}
+		}
+	}
+	return results
+}
+
+func allDone(list []string, done map[string]bool) bool {
+	for _, item := range list {
+		if !done[item] {
+			return false
+		}
+	}
+	return true
+}
+
+// Replaces the {dir}, {pkg} and {target} placeholders of the command arguments.
+// When several values are given, an argument made of a placeholder only is
+// expanded to one argument per value, values are space separated otherwise
+func expandPlaceholders(args []string, values map[string][]string) []string {
+	var res []string
+	for _, arg := range args {
+		if list, ok := values[arg]; ok {
+			res = append(res, list...)
+			continue
+		}
+		for placeholder, list := range values {
+			arg = strings.Replace(arg, placeholder, strings.Join(list, " "), -1)
+		}
+		res = append(res, arg)
+	}
+	return res
+}
+
+// Returns the placeholder values of a list of targets
+func placeholderValues(g *graph.Graph, targets []string) map[string][]string {
+	values := map[string][]string{"{dir}": nil, "{pkg}": nil, "{target}": nil}
+	for _, target := range targets {
+		values["{dir}"] = append(values["{dir}"], filepath.Join(getRepoPath(), filepath.FromSlash(target)))
+		values["{pkg}"] = append(values["{pkg}"], g.ImportPath(target))
+		values["{target}"] = append(values["{target}"], target)
+	}
+	return values
+}
+
+// Runs a command from the repo root, its output is written to out once it's done
+// so that parallel commands don't mix their output
+func execTarget(args []string, out io.Writer, header string) error {
+	var buf bytes.Buffer
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Dir = getRepoPath()
+	cmd.Stdout = &buf
+	cmd.Stderr = &buf
+	err := cmd.Run()
+	out.Write(append([]byte("==> "+header+"\n"), buf.Bytes()...))
+	return err
+}
+
+// lockedWriter serializes the writes of parallel commands
+type lockedWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (lw *lockedWriter) Write(p []byte) (int, error) {
+	lw.mu.Lock()
+	defer lw.mu.Unlock()
+	return lw.w.Write(p)
+}
+
+// Writes the per-target summary table
+func printRunSummary(out io.Writer, results []runResult) {
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "TARGET\tSTATUS\tDURATION")
+	for _, res := range results {
+		duration := "-"
+		if res.Status != "skipped" {
+			duration = res.Duration.Round(10 * time.Millisecond).String()
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", res.Target, res.Status, duration)
+	}
+	w.Flush()
+}
+
+// Implements "gdc run"
+func runCommand(sha1, sha2 string, args []string) {
+	fs := flag.NewFlagSet("run", flag.ExitOnError)
+	parallel := fs.Int("parallel", 1, "number of commands run at the same time")
+	keepGoing := fs.Bool("keep-going", false, "keep running the other targets after a failure")
+	once := fs.Bool("once", false, "run the command once with the whole list of targets")
+	var opts impact.Options
+	fs.BoolVar(&opts.Tests, "tests", false, "run for the packages whose tests are affected")
+	fs.BoolVar(&opts.Precise, "precise", false, "only follow importers using the changed declarations")
+	commitRange := fs.String("range", "", "commit range as <sha1>..<sha2>, defaults to -sha1 and -sha2")
+	fs.Usage = func() {
+		fmt.Println("Usage: gdc run [-parallel N] [-keep-going] [-once] [-tests] [-precise] [-range <sha1>..<sha2>] -- <command> [args]")
+		fmt.Println("\n{dir}, {pkg} and {target} in the command are replaced by the directory, the import path and the repo relative directory of the target")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	command := fs.Args()
+	if len(command) == 0 {
+		fs.Usage()
+		os.Exit(1)
+	}
+	if *commitRange != "" {
+		var err error
+		if sha1, sha2, err = parseRange(*commitRange); err != nil {
+			fmt.Printf("ERROR! %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	affected := getAffectedPackages(sha1, sha2, opts)
+	g, targets := affected.Graph, affected.Packages
+	if len(targets) == 0 {
+		fmt.Println("No affected targets")
+		return
+	}
+	targets = topoSort(g, targets)
+
+	if *once {
+		err := execTarget(expandPlaceholders(command, placeholderValues(g, targets)), os.Stdout, strings.Join(command, " "))
+		if err != nil {
+			fmt.Printf("ERROR! %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	out := &lockedWriter{w: os.Stdout}
+	results := runTargets(targets, dependenciesWithin(g, targets), *parallel, *keepGoing, func(target string) error {
+		return execTarget(expandPlaceholders(command, placeholderValues(g, []string{target})), out, target)
+	})
+
+	fmt.Println()
+	printRunSummary(os.Stdout, results)
+	for _, res := range results {
+		if res.Status != "ok" {
+			os.Exit(1)
+		}
+	}
+}
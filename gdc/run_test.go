@@ -0,0 +1,69 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestRunTargets(t *testing.T) {
+	targets := []string{"lib/b", "lib/c", "lib/a", "other", "svc"}
+	deps := map[string][]string{"lib/a": {"lib/b"}, "other": {"lib/c"}, "svc": {"lib/a", "lib/b"}}
+
+	var mu sync.Mutex
+	var order []string
+	record := func(target string) error {
+		mu.Lock()
+		defer mu.Unlock()
+		for _, dep := range deps[target] {
+			if !contains(order, dep) {
+				t.Errorf("%s started before its dependency %s was done", target, dep)
+			}
+		}
+		order = append(order, target)
+		return nil
+	}
+	results := runTargets(targets, deps, 3, false, record)
+	for _, res := range results {
+		if res.Status != "ok" {
+			t.Error("unexpected result", res)
+		}
+	}
+	if len(order) != len(targets) {
+		t.Error("every target should run, got", order)
+	}
+
+	// Fail fast: nothing starts after lib/b fails
+	failing := func(target string) error {
+		if target == "lib/b" {
+			return errors.New("boom")
+		}
+		return nil
+	}
+	statuses := func(results []runResult) (res []string) {
+		for _, r := range results {
+			res = append(res, r.Status)
+		}
+		return
+	}
+	res := statuses(runTargets(targets, deps, 1, false, failing))
+	expected := []string{"failed", "skipped", "skipped", "skipped", "skipped"}
+	if !reflect.DeepEqual(res, expected) {
+		t.Error("fail fast statuses should be", expected, "but got", res)
+	}
+	res = statuses(runTargets(targets, deps, 1, true, failing))
+	expected = []string{"failed", "ok", "ok", "ok", "ok"}
+	if !reflect.DeepEqual(res, expected) {
+		t.Error("keep going statuses should be", expected, "but got", res)
+	}
+}
+
+func TestExpandPlaceholders(t *testing.T) {
+	values := map[string][]string{"{pkg}": {"x/a", "x/b"}, "{target}": {"a", "b"}}
+	res := expandPlaceholders([]string{"go", "test", "{pkg}", "-run=T", "targets={target}"}, values)
+	expected := []string{"go", "test", "x/a", "x/b", "-run=T", "targets=a b"}
+	if !reflect.DeepEqual(res, expected) {
+		t.Error("expanded command should be", expected, "but got", res)
+	}
+}
@@ -0,0 +1,355 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2017 RightScale, Inc, All Rights Reserved Worldwide.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Organization assumed for repos given without owner, like travis-setup.sh does
+const defaultOrg = "rightscale"
+
+// greenConfig is the "green" section of .gdc.yml
+type greenConfig struct {
+	Backend string `yaml:"backend"` // travis, github or file
+	Repo    string `yaml:"repo"`    // owner/name, defaults to TRAVIS_REPO_SLUG
+	URL     string `yaml:"url"`     // API endpoint of the travis and github backends
+	Dir     string `yaml:"dir"`     // directory of the file backend
+}
+
+func (gc *greenConfig) setDefaults() error {
+	if gc.Backend == "" {
+		gc.Backend = "travis"
+	}
+	if gc.Repo == "" {
+		gc.Repo = os.Getenv("TRAVIS_REPO_SLUG")
+	}
+	if gc.Repo != "" && !strings.Contains(gc.Repo, "/") {
+		gc.Repo = defaultOrg + "/" + gc.Repo
+	}
+	if gc.Dir == "" {
+		gc.Dir = ".gdc/green"
+	}
+	switch gc.Backend {
+	case "travis", "github", "file":
+		return nil
+	default:
+		return fmt.Errorf("unknown green backend %q, should be travis, github or file", gc.Backend)
+	}
+}
+
+// statusBackend tells whether a commit already has a successful build
+type statusBackend interface {
+	Name() string
+	IsGreen(sha string) (bool, error)
+}
+
+// statusRecorder is implemented by the backends gdc can record builds into
+type statusRecorder interface {
+	MarkGreen(sha string) error
+}
+
+// Returns the backend selected by the config
+func newStatusBackend(gc greenConfig) (statusBackend, error) {
+	needRepo := func() error {
+		if gc.Repo == "" {
+			return errors.New("no repo given, set green.repo, TRAVIS_REPO_SLUG or -repo")
+		}
+		return nil
+	}
+
+	switch gc.Backend {
+	case "travis":
+		if err := needRepo(); err != nil {
+			return nil, err
+		}
+		token := os.Getenv("TRAVIS_PRO_TOKEN")
+		if token == "" {
+			return nil, errors.New("need TRAVIS_PRO_TOKEN defined to be able to use green-SHA-skip-tests feature")
+		}
+		return &travisBackend{URL: gc.URL, Repo: gc.Repo, Token: token, HTTP: http.DefaultClient}, nil
+	case "github":
+		if err := needRepo(); err != nil {
+			return nil, err
+		}
+		return &githubBackend{URL: gc.URL, Repo: gc.Repo, Token: os.Getenv("GITHUB_TOKEN"), HTTP: http.DefaultClient}, nil
+	case "file":
+		return &fileStatusBackend{Dir: gc.Dir}, nil
+	default:
+		return nil, fmt.Errorf("unknown green backend %q", gc.Backend)
+	}
+}
+
+// travisBackend looks for a finished and passed build of the commit in the Travis API
+type travisBackend struct {
+	URL   string
+	Repo  string
+	Token string
+	HTTP  *http.Client
+}
+
+func (b *travisBackend) Name() string {
+	return "travis"
+}
+
+func (b *travisBackend) IsGreen(sha string) (bool, error) {
+	endpoint := b.URL
+	if endpoint == "" {
+		endpoint = "https://api.travis-ci.com"
+	}
+	req, err := http.NewRequest("GET", strings.TrimSuffix(endpoint, "/")+"/repos/"+b.Repo+"/builds", nil)
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Authorization", "token "+b.Token)
+	req.Header.Set("Accept", "application/json")
+
+	var builds []struct {
+		Commit string `json:"commit"`
+		State  string `json:"state"`
+		Result *int   `json:"result"`
+		Branch string `json:"branch"`
+	}
+	if err := getJSON(b.HTTP, req, &builds); err != nil {
+		return false, err
+	}
+	for _, build := range builds {
+		if build.Commit == sha && build.State == "finished" && build.Result != nil && *build.Result == 0 {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// githubBackend uses the combined commit status and the check runs of the commit.
+// The commit is green if it has at least one of them and all of them succeeded
+type githubBackend struct {
+	URL   string
+	Repo  string
+	Token string
+	HTTP  *http.Client
+}
+
+func (b *githubBackend) Name() string {
+	return "github"
+}
+
+func (b *githubBackend) get(path string, res interface{}) error {
+	endpoint := b.URL
+	if endpoint == "" {
+		endpoint = "https://api.github.com"
+	}
+	req, err := http.NewRequest("GET", strings.TrimSuffix(endpoint, "/")+"/repos/"+b.Repo+path, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	if b.Token != "" {
+		req.Header.Set("Authorization", "token "+b.Token)
+	}
+	return getJSON(b.HTTP, req, res)
+}
+
+func (b *githubBackend) IsGreen(sha string) (bool, error) {
+	var status struct {
+		State    string `json:"state"`
+		Statuses []struct {
+			Context string `json:"context"`
+			State   string `json:"state"`
+		} `json:"statuses"`
+	}
+	if err := b.get("/commits/"+sha+"/status", &status); err != nil {
+		return false, err
+	}
+	if len(status.Statuses) > 0 && status.State != "success" {
+		return false, nil
+	}
+
+	var checks struct {
+		CheckRuns []struct {
+			Name       string `json:"name"`
+			Status     string `json:"status"`
+			Conclusion string `json:"conclusion"`
+		} `json:"check_runs"`
+	}
+	if err := b.get("/commits/"+sha+"/check-runs", &checks); err != nil {
+		return false, err
+	}
+	for _, run := range checks.CheckRuns {
+		if run.Status != "completed" {
+			return false, nil
+		}
+		switch run.Conclusion {
+		case "success", "neutral", "skipped":
+		default:
+			return false, nil
+		}
+	}
+
+	return len(status.Statuses) > 0 || len(checks.CheckRuns) > 0, nil
+}
+
+// fileStatusBackend keeps one file per green commit in a local directory,
+// handy for CI workers with a persistent cache directory
+type fileStatusBackend struct {
+	Dir string
+}
+
+type fileStatus struct {
+	SHA    string    `json:"sha"`
+	Result string    `json:"result"`
+	Time   time.Time `json:"time"`
+}
+
+func (b *fileStatusBackend) Name() string {
+	return "file"
+}
+
+func (b *fileStatusBackend) path(sha string) string {
+	return filepath.Join(b.Dir, sha+".json")
+}
+
+func (b *fileStatusBackend) IsGreen(sha string) (bool, error) {
+	content, err := ioutil.ReadFile(b.path(sha))
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	var status fileStatus
+	if err := json.Unmarshal(content, &status); err != nil {
+		return false, fmt.Errorf("corrupted status file %s: %v", b.path(sha), err)
+	}
+	return status.SHA == sha && status.Result == "success", nil
+}
+
+func (b *fileStatusBackend) MarkGreen(sha string) error {
+	if err := os.MkdirAll(b.Dir, 0755); err != nil {
+		return err
+	}
+	content, err := json.Marshal(fileStatus{SHA: sha, Result: "success", Time: time.Now().UTC()})
+	if err != nil {
+		return err
+	}
+	tmp := b.path(sha) + ".tmp"
+	if err := ioutil.WriteFile(tmp, content, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, b.path(sha))
+}
+
+func getJSON(client *http.Client, req *http.Request, res interface{}) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s failed: %s", req.URL, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(res)
+}
+
+var disableGreenCheck = regexp.MustCompile(`^(true|TRUE|1)$`)
+var fullSHA = regexp.MustCompile(`^[0-9a-f]{40}$`)
+
+// Implements "gdc green", exits 0 if the SHA already has a green build
+// and 1 otherwise, so it can replace build_already_green in shell scripts
+func greenCommand(args []string) {
+	gc := getConfig().Green
+	fs := flag.NewFlagSet("green", flag.ExitOnError)
+	fs.StringVar(&gc.Backend, "backend", gc.Backend, "build status backend: travis, github or file")
+	fs.StringVar(&gc.Repo, "repo", gc.Repo, "repo as owner/name")
+	mark := fs.Bool("mark", false, "record the SHA as green instead of checking it (file backend only)")
+	fs.Usage = func() {
+		fmt.Println("Usage: gdc green [-backend travis|github|file] [-repo owner/name] [-mark] <sha>")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(1)
+	}
+	if err := gc.setDefaults(); err != nil {
+		fmt.Printf("ERROR! %v\n", err)
+		os.Exit(1)
+	}
+	sha := fs.Arg(0)
+	if !fullSHA.MatchString(sha) {
+		sha = expandSHA(sha)
+	}
+
+	if !*mark && disableGreenCheck.MatchString(os.Getenv("CI_DISABLE_SHA_GREEN_CHECK")) {
+		fmt.Println("WARNING!!! CI_DISABLE_SHA_GREEN_CHECK is set, so always running tests")
+		os.Exit(1)
+	}
+
+	backend, err := newStatusBackend(gc)
+	if err != nil {
+		fmt.Printf("WARNING!!!!! %v\n", err)
+		os.Exit(1)
+	}
+
+	if *mark {
+		recorder, ok := backend.(statusRecorder)
+		if !ok {
+			fmt.Printf("ERROR! The %s backend can't record build statuses\n", backend.Name())
+			os.Exit(1)
+		}
+		if err := recorder.MarkGreen(sha); err != nil {
+			fmt.Printf("ERROR! %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Recorded SHA %s as green\n", sha)
+		return
+	}
+
+	green, err := backend.IsGreen(sha)
+	if err != nil {
+		fmt.Printf("WARNING! Cannot get build status of %s from %s: %v\n", sha, backend.Name(), err)
+		os.Exit(1)
+	}
+	if !green {
+		if Verbose {
+			fmt.Printf("SHA %s has no green build in %s\n", sha, backend.Name())
+		}
+		os.Exit(1)
+	}
+
+	fmt.Println("***********************************************************************************")
+	fmt.Println("***********************************************************************************")
+	fmt.Printf(" WARNING!! Skipping tests since SHA %s has already been tested with green status\n", sha)
+	fmt.Println("***********************************************************************************")
+	fmt.Println("***********************************************************************************")
+}
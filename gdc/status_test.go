@@ -0,0 +1,94 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+const greenSHA = "1111111111111111111111111111111111111111"
+const redSHA = "2222222222222222222222222222222222222222"
+
+func TestTravisBackend(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/repos/rightscale/app/builds" || r.Header.Get("Authorization") != "token secret" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(`[
+			{"commit":"` + greenSHA + `","state":"finished","result":0,"branch":"master"},
+			{"commit":"` + redSHA + `","state":"finished","result":1,"branch":"master"},
+			{"commit":"` + redSHA + `","state":"started","result":null,"branch":"other"}
+		]`))
+	}))
+	defer srv.Close()
+
+	b := &travisBackend{URL: srv.URL, Repo: "rightscale/app", Token: "secret", HTTP: srv.Client()}
+	if green, err := b.IsGreen(greenSHA); err != nil || !green {
+		t.Error("finished build with result 0 should be green, got", green, err)
+	}
+	if green, err := b.IsGreen(redSHA); err != nil || green {
+		t.Error("failed build should not be green, got", green, err)
+	}
+
+	b.Token = "wrong"
+	if _, err := b.IsGreen(greenSHA); err == nil {
+		t.Error("an API error should be returned")
+	}
+}
+
+func TestGithubBackend(t *testing.T) {
+	responses := map[string]string{
+		"/repos/org/app/commits/" + greenSHA + "/status":     `{"state":"success","statuses":[{"context":"ci","state":"success"}]}`,
+		"/repos/org/app/commits/" + greenSHA + "/check-runs": `{"check_runs":[{"name":"lint","status":"completed","conclusion":"neutral"}]}`,
+		"/repos/org/app/commits/" + redSHA + "/status":       `{"state":"pending","statuses":[]}`,
+		"/repos/org/app/commits/" + redSHA + "/check-runs":   `{"check_runs":[{"name":"test","status":"completed","conclusion":"failure"}]}`,
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, ok := responses[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(body))
+	}))
+	defer srv.Close()
+
+	b := &githubBackend{URL: srv.URL, Repo: "org/app", HTTP: srv.Client()}
+	if green, err := b.IsGreen(greenSHA); err != nil || !green {
+		t.Error("successful statuses and checks should be green, got", green, err)
+	}
+	if green, err := b.IsGreen(redSHA); err != nil || green {
+		t.Error("failed check run should not be green, got", green, err)
+	}
+
+	// A commit without any status nor check has not been built
+	responses["/repos/org/app/commits/"+redSHA+"/check-runs"] = `{"check_runs":[]}`
+	if green, err := b.IsGreen(redSHA); err != nil || green {
+		t.Error("commit without statuses should not be green, got", green, err)
+	}
+}
+
+func TestFileStatusBackend(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gdc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	b := &fileStatusBackend{Dir: dir + "/green"}
+	if green, err := b.IsGreen(greenSHA); err != nil || green {
+		t.Error("empty store should not be green, got", green, err)
+	}
+	if err := b.MarkGreen(greenSHA); err != nil {
+		t.Fatal(err)
+	}
+	if green, err := b.IsGreen(greenSHA); err != nil || !green {
+		t.Error("marked SHA should be green, got", green, err)
+	}
+	if green, err := b.IsGreen(redSHA); err != nil || green {
+		t.Error("other SHA should not be green, got", green, err)
+	}
+}
@@ -0,0 +1,81 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2017 RightScale, Inc, All Rights Reserved Worldwide.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/rightscale/ci/gdc/graph"
+	"github.com/rightscale/ci/gdc/impact"
+)
+
+// Returns the -run regex selecting tests
+func runRegex(tests []string) string {
+	return "^(" + strings.Join(tests, "|") + ")$"
+}
+
+// Implements "gdc tests"
+func testsCommand(sha1, sha2 string, args []string) {
+	fs := flag.NewFlagSet("tests", flag.ExitOnError)
+	algo := fs.String("algo", "rta", "call graph algorithm: cha or rta")
+	fs.Usage = func() {
+		fmt.Println("Usage: gdc tests [-algo cha|rta] [<sha1>..<sha2>]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	sha1, sha2 = rangeArg(fs, sha1, sha2)
+
+	affected := getAffectedPackages(sha1, sha2, impact.Options{Tests: true})
+	g, dirs := affected.Graph, affected.Packages
+	if len(dirs) == 0 {
+		return
+	}
+	patterns, _ := formatPackages(g, dirs, "import")
+	pkgs, err := impact.LoadTestPackages(context.Background(), getRepoPath(), patterns)
+	if err != nil {
+		fmt.Printf("ERROR! Cannot load packages: %v\n", err)
+		os.Exit(1)
+	}
+	changes := impact.ChangedFunctions(g, newTreeSource(sha1), newTreeSource(sha2), affected.Changed, getConfig().Inputs)
+	selected, err := impact.SelectTests(pkgs, *algo, changes)
+	if err != nil {
+		fmt.Printf("ERROR! %v\n", err)
+		os.Exit(1)
+	}
+	printSelectedTests(selected)
+}
+
+// Prints the selected tests as "<package> <-run regex>" lines, sorted by package
+func printSelectedTests(selected map[string][]string) {
+	pkgs := make(map[string]struct{})
+	for pkg := range selected {
+		pkgs[pkg] = struct{}{}
+	}
+	for _, pkg := range graph.GetSortedKeys(pkgs) {
+		fmt.Printf("%s %s\n", pkg, runRegex(selected[pkg]))
+	}
+}
@@ -0,0 +1,9 @@
+package main
+
+import "testing"
+
+func TestRunRegex(t *testing.T) {
+	if res := runRegex([]string{"TestA", "TestB"}); res != "^(TestA|TestB)$" {
+		t.Error("unexpected -run regex", res)
+	}
+}
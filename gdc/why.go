@@ -0,0 +1,208 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2017 RightScale, Inc, All Rights Reserved Worldwide.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/rightscale/ci/gdc/graph"
+)
+
+// whyReason tells why a changed file affects a target
+type whyReason struct {
+	File    string   `json:"file"`
+	Rule    string   `json:"rule"`              // root file, global input, extra input, target, dockerfile or dependency
+	Pattern string   `json:"pattern,omitempty"` // input pattern matching the file
+	Chain   []string `json:"chain,omitempty"`   // nodes from the target to the one made of the file, for a dependency
+	Via     string   `json:"via,omitempty"`     // go.mod or generator, when the file changes through them, see ResolveGoModChanges and GenerateRule
+}
+
+// Returns the shortest chain of nodes from one of from to one of to, through
+// edges, nil if there is none. Like graph.DependencyNodes, test edges are only
+// followed from the starting nodes
+func shortestChain(g *graph.Graph, from []string, to map[string]bool) []string {
+	deps := make(map[string][]graph.Edge)
+	for _, e := range g.Edges {
+		deps[e.From] = append(deps[e.From], e)
+	}
+	parent := make(map[string]string)
+	start := make(map[string]bool)
+	for _, id := range from {
+		start[id] = true
+	}
+	queue := append([]string{}, from...)
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		if to[id] {
+			chain := []string{id}
+			for !start[id] {
+				id = parent[id]
+				chain = append([]string{id}, chain...)
+			}
+			return chain
+		}
+		for _, e := range deps[id] {
+			if _, seen := parent[e.To]; seen || start[e.To] || e.Test && !start[id] {
+				continue
+			}
+			parent[e.To] = id
+			queue = append(queue, e.To)
+		}
+	}
+	return nil
+}
+
+// Returns why each changed file affects target, the way check and travis
+// decide it, skipping the files that don't. dockerFiles are the files the
+// Dockerfile of the target copies
+func explain(g *graph.Graph, target string, changed []string, ic graph.Inputs, dockerFiles []string) []whyReason {
+	target = path.Clean(filepath.ToSlash(target))
+	targets := g.TargetNodes(target)
+	var res []whyReason
+	for _, file := range changed {
+		r := whyReason{File: file}
+		if graph.IsRootFile(file) {
+			r.Rule = "root file"
+		} else if pattern := matchingInput(ic.Global, file); pattern != "" {
+			r.Rule, r.Pattern = "global input", pattern
+		} else if pattern := matchingInput(ic.Targets[target], file); pattern != "" {
+			r.Rule, r.Pattern = "extra input", pattern
+		} else if target == "." || strings.HasPrefix(file, target+"/") {
+			r.Rule = "target"
+		} else if contains(dockerFiles, file) {
+			r.Rule = "dockerfile"
+		} else if chain := dependencyChain(g, targets, file); chain != nil {
+			r.Rule, r.Chain = "dependency", chain
+		} else {
+			continue
+		}
+		res = append(res, r)
+	}
+	return res
+}
+
+// Returns the shortest chain from the target nodes to a node made of file.
+// Imported Go packages are only made of their Go files and of what they
+// embed or include. A vendored file ends the chain of the package importing it
+func dependencyChain(g *graph.Graph, targets []string, file string) []string {
+	to := make(map[string]bool)
+	for _, id := range g.NodesOf(file) {
+		if node := g.Nodes[id]; node.Kind == graph.GoKind {
+			pkg := g.Packages[node.Path]
+			if !(path.Dir(file) == pkg.Dir && strings.HasSuffix(file, ".go")) && !contains(pkg.Inputs(false), file) {
+				continue
+			}
+		}
+		to[id] = true
+	}
+	vendorDir := ""
+	if graph.IsVendored(path.Dir(file)) {
+		if vendorDir = g.OwningVendorPackage(file); vendorDir != "" {
+			for _, dir := range g.VendorImporters(vendorDir) {
+				to[graph.NodeID(graph.GoKind, dir)] = true
+			}
+		}
+	}
+	chain := shortestChain(g, targets, to)
+	if chain != nil && vendorDir != "" && !contains(g.NodesOf(file), chain[len(chain)-1]) {
+		chain = append(chain, vendorDir)
+	}
+	return chain
+}
+
+// Returns the first pattern matching file, "" if none does
+func matchingInput(patterns []string, file string) string {
+	for _, pattern := range patterns {
+		if file == pattern || graph.MatchesInput(pattern, file) {
+			return pattern
+		}
+	}
+	return ""
+}
+
+// Implements "gdc why"
+func whyCommand(sha1, sha2 string, args []string) {
+	fs := flag.NewFlagSet("why", flag.ExitOnError)
+	format := fs.String("format", "text", "output format: text or json")
+	fs.Usage = func() {
+		fmt.Println("Usage: gdc why [-format text|json] <target> [<sha1>..<sha2>]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(1)
+	}
+	target := fs.Arg(0)
+	if fs.NArg() > 1 {
+		var err error
+		sha1, sha2, err = parseRange(fs.Arg(1))
+		exitOnError(err)
+	}
+
+	g := getRepoGraph()
+	changes := getChanges(g, sha1, sha2)
+	dockerFiles, _ := getDockerfileDependencies(target)
+	reasons := explain(g, target, changes.Changed, getConfig().Inputs, dockerFiles)
+	for i, r := range reasons {
+		if contains(changes.Generated, r.File) {
+			reasons[i].Via = "generator"
+		} else if !contains(changes.Raw, r.File) {
+			reasons[i].Via = "go.mod"
+		}
+	}
+
+	if *format == "json" {
+		printJSON(struct {
+			Target  string      `json:"target"`
+			Reasons []whyReason `json:"reasons"`
+		}{target, append([]whyReason{}, reasons...)})
+		return
+	}
+	if len(reasons) == 0 {
+		fmt.Printf("%s is not affected\n", target)
+		return
+	}
+	fmt.Printf("%s is affected by:\n", target)
+	for _, r := range reasons {
+		var why string
+		switch {
+		case r.Chain != nil:
+			why = strings.Join(r.Chain, " -> ")
+		case r.Pattern != "":
+			why = r.Rule + " " + r.Pattern
+		default:
+			why = r.Rule
+		}
+		if r.Via != "" {
+			why += " (through " + r.Via + ")"
+		}
+		fmt.Printf("  %s: %s\n", r.File, why)
+	}
+}
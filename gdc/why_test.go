@@ -0,0 +1,54 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/rightscale/ci/gdc/graph"
+)
+
+var vendorRepo = graph.MapSource{
+	"vendor/github.com/x/y/y.go":     "package y\n\nimport \"github.com/x/z\"\n",
+	"vendor/github.com/x/y/LICENSE":  "",
+	"vendor/github.com/x/z/z.go":     "package z\n",
+	"svc/main.go":                    "package main\n\nimport \"github.com/x/y\"\n",
+	"svc/sub/sub.go":                 "package sub\n\nimport \"github.com/x/z\"\n",
+	"svc/vendor/github.com/x/z/z.go": "package z\n",
+	"lib/lib.go":                     "package lib\n",
+	"lib/lib_test.go":                "package lib\n\nimport \"github.com/x/z\"\n",
+	"other/other.go":                 "package other\n",
+}
+
+func TestExplain(t *testing.T) {
+	g := buildGraph(testRepo, "github.com/org/repo")
+	ic := graph.Inputs{Global: []string{"config/*.yml"}, Targets: map[string][]string{"svc": {"config/other.txt"}}}
+	changed := []string{"glide.yaml", "config/app.yml", "config/other.txt", "svc/sub/sub.go", "lib/b/b.go", "lib/c/c.go", "lib/a/data.json", "lib/testutil/util.go", "vendor/x/y/y.go"}
+
+	expected := []whyReason{
+		{File: "glide.yaml", Rule: "root file"},
+		{File: "config/app.yml", Rule: "global input", Pattern: "config/*.yml"},
+		{File: "config/other.txt", Rule: "extra input", Pattern: "config/other.txt"},
+		{File: "svc/sub/sub.go", Rule: "target"},
+		{File: "lib/b/b.go", Rule: "dependency", Chain: []string{"go:svc", "go:lib/a", "go:lib/b"}},
+		// The tests of svc import testutil, the tests of lib/a are not followed
+		{File: "lib/testutil/util.go", Rule: "dependency", Chain: []string{"go:svc", "go:lib/testutil"}},
+	}
+	if res := explain(g, "svc", changed, ic, nil); !reflect.DeepEqual(res, expected) {
+		t.Errorf("reasons should be\n%+v\nbut got\n%+v", expected, res)
+	}
+
+	if res := explain(g, "other", []string{"lib/c/c.go", "svc/Dockerfile"}, graph.Inputs{}, []string{"svc/Dockerfile"}); !reflect.DeepEqual(res, []whyReason{
+		{File: "lib/c/c.go", Rule: "dependency", Chain: []string{"go:other", "go:lib/c"}},
+		{File: "svc/Dockerfile", Rule: "dockerfile"},
+	}) {
+		t.Error("unexpected reasons for other:", res)
+	}
+
+	// Vendored packages are not nodes, the chain ends with the vendored package
+	g = buildGraph(vendorRepo, "github.com/org/repo")
+	if res := explain(g, "svc", []string{"vendor/github.com/x/z/z.go"}, graph.Inputs{}, nil); !reflect.DeepEqual(res, []whyReason{
+		{File: "vendor/github.com/x/z/z.go", Rule: "dependency", Chain: []string{"go:svc", "vendor/github.com/x/z"}},
+	}) {
+		t.Error("unexpected reasons for a vendored file:", res)
+	}
+}
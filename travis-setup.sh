@@ -163,6 +163,14 @@ function build_already_green {
     return 1
   fi
 
+  # If $gdc points to a gdc binary, let it check the build status with the
+  # backend configured in its .gdc.yml (travis, github or file)
+  if [ -n "$gdc" ] && [ -x "$gdc" ]
+  then
+    $gdc green -repo $1 $2
+    return $?
+  fi
+
   if [ -z "${TRAVIS_PRO_TOKEN}" ]
   then
     echo "WARNING!!!!! Need TRAVIS_PRO_TOKEN defined to be able to use green-SHA-skip-tests feature"